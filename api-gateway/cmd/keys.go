@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// defaultKeysMaxAge is used when the auth service doesn't say how long keys may be cached
+	defaultKeysMaxAge = 5 * time.Minute
+	// minKeysRefreshInterval limits forced refreshes triggered by tokens with unknown key ids
+	minKeysRefreshInterval = 10 * time.Second
+	// authFetchTimeout bounds the calls the caches make to the auth service
+	authFetchTimeout = 5 * time.Second
+)
+
+// KeyCache caches the token verification keys published by the auth service
+type KeyCache struct {
+	sync.Mutex
+	client gen.AuthServiceClient
+	// fetches collapses concurrent fetches into one call, the lock isn't held while it's in flight
+	fetches   singleflight.Group
+	keys      []auth.VerificationKey
+	fetchedAt time.Time
+	expiresAt time.Time
+}
+
+// NewKeyCache creates a new key cache backed by the given auth service client
+func NewKeyCache(client gen.AuthServiceClient) *KeyCache {
+	return &KeyCache{client: client}
+}
+
+// Get returns the cached keys, fetching them from the auth service once they are stale
+func (c *KeyCache) Get(ctx context.Context) ([]auth.VerificationKey, error) {
+	c.Lock()
+	cached, expiresAt := c.keys, c.expiresAt
+	c.Unlock()
+	if cached != nil && time.Now().Before(expiresAt) {
+		return cached, nil
+	}
+	keys, err := c.fetch(ctx)
+	if err != nil && cached != nil {
+		// Keep verifying with the stale keys rather than failing every request
+		log.Println("Error refreshing signing keys:", err)
+		return cached, nil
+	}
+	return keys, err
+}
+
+// Refresh fetches the keys from the auth service ahead of their expiry,
+// e.g. when a token refers to a key id the cache doesn't know yet
+func (c *KeyCache) Refresh(ctx context.Context) ([]auth.VerificationKey, error) {
+	c.Lock()
+	cached, fetchedAt := c.keys, c.fetchedAt
+	c.Unlock()
+	if cached != nil && time.Since(fetchedAt) < minKeysRefreshInterval {
+		return cached, nil
+	}
+	return c.fetch(ctx)
+}
+
+// fetch fetches the keys from the auth service, requests arriving while a fetch is in flight share its result
+func (c *KeyCache) fetch(ctx context.Context) ([]auth.VerificationKey, error) {
+	keys, err, _ := c.fetches.Do("keys", func() (any, error) {
+		// The fetch is shared, so it mustn't be cancelled along with the request that started it
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), authFetchTimeout)
+		defer cancel()
+		return c.load(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys.([]auth.VerificationKey), nil
+}
+
+func (c *KeyCache) load(ctx context.Context) ([]auth.VerificationKey, error) {
+	resp, err := c.client.GetSigningKeys(ctx, &gen.SigningKeysRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]auth.VerificationKey, 0, len(resp.GetKeys()))
+	for _, k := range resp.GetKeys() {
+		key, err := auth.ParseVerificationKey(k.GetKid(), k.GetAlg(), k.GetKey())
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	maxAge := time.Duration(resp.GetMaxAge()) * time.Second
+	if maxAge <= 0 {
+		maxAge = defaultKeysMaxAge
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.expiresAt = c.fetchedAt.Add(maxAge)
+	return keys, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+
+	"google.golang.org/grpc"
+)
+
+// slowAuthClient serves a signing key and revoked sessions once released
+type slowAuthClient struct {
+	gen.AuthServiceClient
+	key     *gen.SigningKey
+	release chan struct{}
+	// ttl is the token lifetime reported along with revoked sessions, in seconds
+	ttl      int64
+	keyCalls atomic.Int32
+	revCalls atomic.Int32
+}
+
+func (c *slowAuthClient) GetSigningKeys(ctx context.Context, _ *gen.SigningKeysRequest, _ ...grpc.CallOption) (*gen.SigningKeysResponse, error) {
+	c.keyCalls.Add(1)
+	select {
+	case <-c.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &gen.SigningKeysResponse{Keys: []*gen.SigningKey{c.key}, MaxAge: 60}, nil
+}
+
+func (c *slowAuthClient) ListRevokedSessions(ctx context.Context, _ *gen.RevokedSessionsRequest, _ ...grpc.CallOption) (*gen.RevokedSessionsResponse, error) {
+	c.revCalls.Add(1)
+	select {
+	case <-c.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &gen.RevokedSessionsResponse{Sessions: []*gen.RevokedSession{{SessionId: "s1", RevokedAt: time.Now().Unix()}}, TokenTtl: c.ttl}, nil
+}
+
+func newSlowAuthClient(t *testing.T) *slowAuthClient {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+	der, err := key.VerificationKey().MarshalPublicKey()
+	if err != nil {
+		t.Fatalf("Error marshaling key: %v", err)
+	}
+	return &slowAuthClient{key: &gen.SigningKey{Kid: key.ID, Alg: key.Method.Alg(), Key: der}, release: make(chan struct{}), ttl: 60}
+}
+
+// waitFor polls until the condition holds
+func waitFor(t *testing.T, cond func() bool) {
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	ctx := context.Background()
+	client := newSlowAuthClient(t)
+	cache := NewKeyCache(client)
+
+	// Test concurrent requests share a single fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if keys, err := cache.Get(ctx); err != nil || len(keys) != 1 {
+				t.Errorf("Expected the key, got %v, %v", keys, err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return client.keyCalls.Load() == 1 })
+	close(client.release)
+	wg.Wait()
+	if n := client.keyCalls.Load(); n != 1 {
+		t.Errorf("Expected a single fetch, got %d", n)
+	}
+
+	// Test cached keys are served while a refresh is in flight
+	client.release = make(chan struct{})
+	cache.Lock()
+	cache.fetchedAt = time.Now().Add(-minKeysRefreshInterval)
+	cache.Unlock()
+	refreshed := make(chan error)
+	go func() {
+		_, err := cache.Refresh(ctx)
+		refreshed <- err
+	}()
+	waitFor(t, func() bool { return client.keyCalls.Load() == 2 })
+	got := make(chan error)
+	go func() {
+		_, err := cache.Get(ctx)
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Errorf("Error getting keys: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the cached keys while the refresh is in flight")
+	}
+	close(client.release)
+	if err := <-refreshed; err != nil {
+		t.Errorf("Error refreshing keys: %v", err)
+	}
+}
+
+func TestRevocationCache(t *testing.T) {
+	ctx := context.Background()
+	client := newSlowAuthClient(t)
+	cache := NewRevocationCache(client)
+
+	// Test concurrent requests share a single sync
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if revoked, err := cache.IsRevoked(ctx, "s1"); err != nil || !revoked {
+				t.Errorf("Expected s1 to be revoked, got %v, %v", revoked, err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return client.revCalls.Load() == 1 })
+	close(client.release)
+	wg.Wait()
+	if n := client.revCalls.Load(); n != 1 {
+		t.Errorf("Expected a single sync, got %d", n)
+	}
+}
+
+func TestRevocationCacheWithoutTTL(t *testing.T) {
+	ctx := context.Background()
+	client := newSlowAuthClient(t)
+	client.ttl = 0
+	close(client.release)
+	cache := NewRevocationCache(client)
+
+	// Test revocations outlive syncs that don't report the token lifetime
+	for i := 0; i < 2; i++ {
+		cache.Lock()
+		cache.refreshedAt = time.Time{}
+		cache.Unlock()
+		if revoked, err := cache.IsRevoked(ctx, "s1"); err != nil || !revoked {
+			t.Errorf("Expected s1 to be revoked after sync %d, got %v, %v", i+1, revoked, err)
+		}
+	}
+}
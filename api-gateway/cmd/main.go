@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"errors"
-	"io"
+	"expvar"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
 	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
 
 	"github.com/IBM/sarama"
@@ -26,6 +27,9 @@ type customString string
 
 var userString customString = "user"
 
+// defaultMetricsAddr is where metrics are served unless METRICS_ADDR is set, only reachable from the host
+const defaultMetricsAddr = "localhost:9090"
+
 var (
 	ErrNoMetadata   = errors.New("no metadata found in context")
 	ErrInvalidToken = errors.New("invalid token")
@@ -43,46 +47,35 @@ type RouteHandler interface {
 	ServeHTTP(rw http.ResponseWriter, req *http.Request)
 }
 
-// KafkaMessageProducer represents a Kafka message producer handler
-type KafkaMessageProducer struct {
-	KafkaTopic string
-	Producer   sarama.AsyncProducer
-}
-
-func (kafkaProducer *KafkaMessageProducer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	message := &sarama.ProducerMessage{
-		Topic: kafkaProducer.KafkaTopic,
-		Value: sarama.StringEncoder(body),
-	}
-
-	kafkaProducer.Producer.BeginTxn()
-	kafkaProducer.Producer.Input() <- message
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Message produced successfully"))
-}
-
 // Gateway represents the API gateway
 type Gateway struct {
 	Routes          []*Route
 	SecureRoutes    []*Route
 	AuthServiceAddr string
+	authClient      gen.AuthServiceClient
+	keys            *KeyCache
+	revocations     *RevocationCache
 }
 
 // NewGateway initializes a new API gateway
-func NewGateway(authServiceAddr string) *Gateway {
+func NewGateway(authServiceAddr string) (*Gateway, error) {
+	conn, err := grpc.Dial(
+		authServiceAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	client := gen.NewAuthServiceClient(conn)
+
 	return &Gateway{
 		Routes:          []*Route{},
 		SecureRoutes:    []*Route{},
 		AuthServiceAddr: authServiceAddr,
-	}
+		authClient:      client,
+		keys:            NewKeyCache(client),
+		revocations:     NewRevocationCache(client),
+	}, nil
 }
 
 // AddRoute adds a route to the gateway
@@ -133,21 +126,43 @@ func (gateway *Gateway) authenticate(r *http.Request) (*model.User, error) {
 	return gateway.ValidateToken(r.Context(), token)
 }
 
-// ValidateToken calls the authentication service to validate the token
+// ValidateToken verifies the token locally against the cached signing keys and
+// revoked sessions, falling back to the authentication service if either can't be fetched
 func (gateway *Gateway) ValidateToken(ctx context.Context, token string) (*model.User, error) {
-	conn, err := grpc.Dial(
-		gateway.AuthServiceAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	keys, err := gateway.keys.Get(ctx)
 	if err != nil {
-		return nil, err
+		log.Println("Error fetching signing keys, validating remotely:", err)
+		return gateway.validateTokenRemote(ctx, token)
 	}
-	defer conn.Close()
-	client := gen.NewAuthServiceClient(conn)
 
+	claims, err := auth.ParseToken(token, keys)
+	if errors.Is(err, auth.ErrUnknownKey) {
+		// The keys may have been rotated since they were cached
+		if keys, err = gateway.keys.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		claims, err = auth.ParseToken(token, keys)
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := gateway.revocations.IsRevoked(ctx, claims.SessionID)
+	if err != nil {
+		log.Println("Error syncing revoked sessions, validating remotely:", err)
+		return gateway.validateTokenRemote(ctx, token)
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	return &model.User{ID: claims.UserID, Email: claims.Email, Verified: claims.Verified}, nil
+}
+
+// validateTokenRemote calls the authentication service to validate the token
+func (gateway *Gateway) validateTokenRemote(ctx context.Context, token string) (*model.User, error) {
 	const maxRetries = 5
 	for i := 0; i < maxRetries; i++ {
-		resp, err := client.ValidateToken(ctx, &gen.TokenRequest{Token: token})
+		resp, err := gateway.authClient.ValidateToken(ctx, &gen.TokenRequest{Token: token})
 		if err != nil {
 			if shouldRetry(err) {
 				log.Println("retrying due to error: ", err)
@@ -177,11 +192,15 @@ func main() {
 	notificationService := os.Getenv("NOTIFICATION_SERVICE_URL")
 	authService := os.Getenv("AUTH_SERVICE_ADDR")
 	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
-	gateway := NewGateway(authService)
+	gateway, err := NewGateway(authService)
+	if err != nil {
+		log.Fatalf("Failed to connect to auth service: %v", err)
+	}
 
 	// Kafka producer setup
 	kafkaConfig := sarama.NewConfig()
 	kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll         // Wait for all replicas to acknowledge the record
+	kafkaConfig.Producer.Return.Successes = true                  // Report acknowledgements back to the requests
 	kafkaConfig.Producer.Compression = sarama.CompressionSnappy   // Compress messages
 	kafkaConfig.Producer.Flush.Frequency = 100 * time.Millisecond // Flush batches every 100ms
 	kafkaConfig.Producer.Idempotent = true                        // Idempotent producer
@@ -199,12 +218,32 @@ func main() {
 
 	// Routes
 	gateway.AddRoute("/user", userService, strings.EqualFold, false, httputil.NewSingleHostReverseProxy(MustParse(userService)))
+	gateway.AddRoute("/user/receivers", userService, strings.HasPrefix, true, httputil.NewSingleHostReverseProxy(MustParse(userService)))
 	gateway.AddRoute("/auth", userService, strings.HasPrefix, false, httputil.NewSingleHostReverseProxy(MustParse(userService)))
-	gateway.AddRoute("/notification", notificationService, strings.EqualFold, true, &KafkaMessageProducer{KafkaTopic: "notifications", Producer: kafkaProducer})
+	gateway.AddRoute("/notification", notificationService, strings.EqualFold, true, NewKafkaMessageProducer("notifications", kafkaProducer, produceTimeout, gateway.authClient))
+	gateway.AddRoute("/notification/", notificationService, strings.HasPrefix, true, httputil.NewSingleHostReverseProxy(MustParse(notificationService)))
 	gateway.AddRoute("/history", notificationService, strings.EqualFold, true, httputil.NewSingleHostReverseProxy(MustParse(notificationService)))
+	// The VAPID public key is public, browsers need it before subscribing
+	gateway.AddRoute("/push/key", notificationService, strings.EqualFold, false, httputil.NewSingleHostReverseProxy(MustParse(notificationService)))
+	gateway.AddRoute("/push/subscriptions", notificationService, strings.EqualFold, true, httputil.NewSingleHostReverseProxy(MustParse(notificationService)))
+
+	// Twilio authenticates its status callbacks by signing them, which the notification service validates
+	gateway.AddRoute("/twilio/status", notificationService, strings.EqualFold, false, httputil.NewSingleHostReverseProxy(MustParse(notificationService)))
+
+	// Metrics are served on their own listener, only the gateway's routes are public
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = defaultMetricsAddr
+	}
+	metrics := http.NewServeMux()
+	metrics.Handle("/debug/vars", expvar.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(metricsAddr, metrics))
+	}()
 
-	http.Handle("/", CORSHandler(gateway))
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	mux := http.NewServeMux()
+	mux.Handle("/", CORSHandler(gateway))
+	log.Fatal(http.ListenAndServe(":8080", mux))
 }
 
 func MustParse(backendURL string) *url.URL {
@@ -219,7 +258,7 @@ func CORSHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 		w.Header().Set("Access-Control-Expose-Headers", "Content-Type, Authorization")
 
 		if r.Method == http.MethodOptions {
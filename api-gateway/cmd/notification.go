@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// maxNotificationBody caps the size of notification requests
+	maxNotificationBody = 16 << 10
+	// maxMessageLength caps the length of a posted message
+	maxMessageLength = 4096
+	// maxChatReceivers caps how many users a chat can be started with
+	maxChatReceivers = 100
+	// maxIdempotencyKeyLength caps the length of idempotency keys
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyKeyHeader carries the key clients retry a request with, the notification service
+// performs requests with the same key only once
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrMalformedRequest is returned for notification requests that don't match the schema
+var ErrMalformedRequest = errors.New("malformed request")
+
+// notificationRequest posts a message to a chat, or starts a new chat when it has no chat_id
+type notificationRequest struct {
+	// Sender is accepted for older clients but ignored, the authenticated user is the sender
+	Sender    string    `json:"sender"`
+	ChatID    *string   `json:"chat_id"`
+	Msg       string    `json:"msg"`
+	Receivers receivers `json:"receivers"`
+}
+
+// parseNotificationRequest decodes a single notification request and validates it against the schema
+func parseNotificationRequest(body io.Reader) (*notificationRequest, error) {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	var req notificationRequest
+	if err := dec.Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrMalformedRequest, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: unexpected data after the request", ErrMalformedRequest)
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// validate checks the request carries exactly the fields its kind needs
+func (req *notificationRequest) validate() error {
+	if req.ChatID == nil {
+		if len(req.Receivers) == 0 {
+			return fmt.Errorf("%w: receivers are required to start a chat", ErrMalformedRequest)
+		}
+		if len(req.Receivers) > maxChatReceivers {
+			return fmt.Errorf("%w: a chat can't have more than %d receivers", ErrMalformedRequest, maxChatReceivers)
+		}
+		for _, r := range req.Receivers {
+			if strings.TrimSpace(r) == "" {
+				return fmt.Errorf("%w: receivers can't be empty", ErrMalformedRequest)
+			}
+		}
+		if req.Msg != "" {
+			return fmt.Errorf("%w: msg can't be sent when starting a chat", ErrMalformedRequest)
+		}
+		return nil
+	}
+	if strings.TrimSpace(*req.ChatID) == "" {
+		return fmt.Errorf("%w: chat_id can't be empty", ErrMalformedRequest)
+	}
+	if strings.TrimSpace(req.Msg) == "" {
+		return fmt.Errorf("%w: msg is required", ErrMalformedRequest)
+	}
+	if len(req.Msg) > maxMessageLength {
+		return fmt.Errorf("%w: msg can't be longer than %d bytes", ErrMalformedRequest, maxMessageLength)
+	}
+	if len(req.Receivers) > 0 {
+		return fmt.Errorf("%w: receivers can only be given when starting a chat", ErrMalformedRequest)
+	}
+	return nil
+}
+
+// parseIdempotencyKey returns the idempotency key of the request, empty if there is none
+func parseIdempotencyKey(header http.Header) (string, error) {
+	key := header.Get(IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("%w: %s can't be longer than %d bytes", ErrMalformedRequest, IdempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+	for _, c := range key {
+		if c < ' ' || c > '~' {
+			return "", fmt.Errorf("%w: %s must be printable ASCII", ErrMalformedRequest, IdempotencyKeyHeader)
+		}
+	}
+	return key, nil
+}
+
+// idempotencyNamespace is the namespace event ids are derived from idempotency keys in
+var idempotencyNamespace = uuid.MustParse("0edae0b0-120e-4611-8e21-be9bcaca725c")
+
+// eventID returns the id of the sender's request, derived from its idempotency key so that replays are
+// answered with the id of the original request, or a new id for requests without a key
+func eventID(sender, idempotencyKey string) string {
+	if idempotencyKey == "" {
+		return uuid.New().String()
+	}
+	return uuid.NewSHA1(idempotencyNamespace, []byte(sender+"\x00"+idempotencyKey)).String()
+}
+
+// event returns the event publishing the request on behalf of the sender, timestamped now
+func (req *notificationRequest) event(id, sender, idempotencyKey string) proto.Message {
+	now := timestamppb.Now()
+	if req.ChatID == nil {
+		return &eventsv1.ChatCreated{Id: id, Sender: sender, Receivers: req.Receivers, CreatedAt: now, IdempotencyKey: idempotencyKey}
+	}
+	return &eventsv1.MessagePosted{Id: id, Sender: sender, ChatId: *req.ChatID, Msg: req.Msg, CreatedAt: now, IdempotencyKey: idempotencyKey}
+}
+
+// receivers are the users a chat is started with, a single receiver may be given as a string
+type receivers []string
+
+func (r *receivers) UnmarshalJSON(b []byte) error {
+	var receiver string
+	if err := json.Unmarshal(b, &receiver); err == nil {
+		*r = receivers{receiver}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(r))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+)
+
+func TestNotificationRequest(t *testing.T) {
+	// Test requests matching the schema are accepted and sent by the authenticated user
+	t.Run("TestValidRequest", func(t *testing.T) {
+		req, err := parseNotificationRequest(strings.NewReader(`{"sender": "mallory", "chat_id": "chat", "msg": "Wuphf"}`))
+		if err != nil {
+			t.Fatalf("Error parsing request: %v", err)
+		}
+		posted, ok := req.event("m1", "alice", "").(*eventsv1.MessagePosted)
+		if !ok || posted.Sender != "alice" || posted.ChatId != "chat" || posted.Msg != "Wuphf" {
+			t.Errorf("Expected a message posted by alice, got %v", req.event("m1", "alice", ""))
+		}
+		if posted.Id != "m1" || !posted.CreatedAt.IsValid() {
+			t.Errorf("Expected an id and timestamp, got %v", posted)
+		}
+
+		req, err = parseNotificationRequest(strings.NewReader(`{"receivers": "bob"}`))
+		if err != nil {
+			t.Fatalf("Error parsing request: %v", err)
+		}
+		created, ok := req.event("m1", "alice", "").(*eventsv1.ChatCreated)
+		if !ok || created.Sender != "alice" || len(created.Receivers) != 1 || created.Receivers[0] != "bob" {
+			t.Errorf("Expected a chat created by alice with bob, got %v", req.event("m1", "alice", ""))
+		}
+	})
+
+	// Test requests not matching the schema are rejected
+	t.Run("TestMalformedRequest", func(t *testing.T) {
+		bodies := []string{
+			``,
+			`{"chat_id": "chat", "msg": "Wuphf"`,
+			`{"chat_id": "chat", "msg": "Wuphf"} {}`,
+			`{"chat_id": "chat", "msg": "Wuphf", "priority": 1}`,
+			`{"chat_id": "chat", "msg": 1}`,
+			`{"chat_id": "", "msg": "Wuphf"}`,
+			`{"chat_id": "chat"}`,
+			`{"chat_id": "chat", "msg": "` + strings.Repeat("a", maxMessageLength+1) + `"}`,
+			`{"chat_id": "chat", "msg": "Wuphf", "receivers": ["bob"]}`,
+			`{"receivers": []}`,
+			`{"receivers": ["bob", " "]}`,
+			`{"receivers": ["bob"], "msg": "Wuphf"}`,
+		}
+		for _, body := range bodies {
+			if _, err := parseNotificationRequest(strings.NewReader(body)); !errors.Is(err, ErrMalformedRequest) {
+				t.Errorf("Expected %v for %.50s, got %v", ErrMalformedRequest, body, err)
+			}
+		}
+	})
+
+	// Test idempotency keys are carried by the event, malformed ones are rejected
+	t.Run("TestIdempotencyKey", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(IdempotencyKeyHeader, "retry-1")
+		key, err := parseIdempotencyKey(header)
+		if err != nil {
+			t.Fatalf("Error parsing idempotency key: %v", err)
+		}
+		req := &notificationRequest{Receivers: receivers{"bob"}}
+		if created := req.event("m1", "alice", key).(*eventsv1.ChatCreated); created.IdempotencyKey != "retry-1" {
+			t.Errorf("Expected the idempotency key, got %v", created)
+		}
+
+		if eventID("alice", key) != eventID("alice", key) {
+			t.Errorf("Expected replays to get the same id")
+		}
+		if eventID("alice", key) == eventID("bob", key) || eventID("alice", "") == eventID("alice", "") {
+			t.Errorf("Expected other senders and requests without a key to get new ids")
+		}
+
+		for _, key := range []string{strings.Repeat("a", maxIdempotencyKeyLength+1), "retry\t1", "retry-ü"} {
+			header.Set(IdempotencyKeyHeader, key)
+			if _, err := parseIdempotencyKey(header); !errors.Is(err, ErrMalformedRequest) {
+				t.Errorf("Expected %v for %.50s, got %v", ErrMalformedRequest, key, err)
+			}
+		}
+	})
+
+	// Test oversize requests are rejected before they're decoded
+	t.Run("TestOversizeRequest", func(t *testing.T) {
+		body := `{"chat_id": "chat", "msg": "` + strings.Repeat("a", maxNotificationBody) + `"}`
+		r := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(body)), maxNotificationBody)
+		var tooLarge *http.MaxBytesError
+		if _, err := parseNotificationRequest(r); !errors.As(err, &tooLarge) {
+			t.Errorf("Expected the request to be too large, got %v", err)
+		}
+	})
+}
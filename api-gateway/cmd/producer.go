@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/events"
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+
+	"github.com/IBM/sarama"
+)
+
+// produceTimeout is how long a request waits for the brokers to acknowledge its message
+const produceTimeout = 10 * time.Second
+
+// ErrProduceTimeout is returned when the brokers don't acknowledge a message in time
+var ErrProduceTimeout = errors.New("timed out waiting for the message to be acknowledged")
+
+// producerMetrics counts how produced messages fared, they're served under /debug/vars on the metrics listener
+var producerMetrics = expvar.NewMap("kafka_producer")
+
+// KafkaMessageProducer publishes notification requests to Kafka and reports whether the brokers accepted them
+type KafkaMessageProducer struct {
+	KafkaTopic string
+	Producer   sarama.AsyncProducer
+	// Timeout is how long a request waits for its message to be acknowledged
+	Timeout time.Duration
+	// Users tells whether users whose token claims they're unverified have verified since it was issued
+	Users gen.AuthServiceClient
+}
+
+// NewKafkaMessageProducer creates the handler and starts draining the producer's acknowledgements and errors,
+// the producer has to be configured to return successes
+func NewKafkaMessageProducer(topic string, producer sarama.AsyncProducer, timeout time.Duration, users gen.AuthServiceClient) *KafkaMessageProducer {
+	kafkaProducer := &KafkaMessageProducer{KafkaTopic: topic, Producer: producer, Timeout: timeout, Users: users}
+	go kafkaProducer.drain()
+	return kafkaProducer
+}
+
+// verified asks the authentication service whether the user has verified their email
+func (kafkaProducer *KafkaMessageProducer) verified(ctx context.Context, userID string) (bool, error) {
+	if kafkaProducer.Users == nil {
+		return false, nil
+	}
+	resp, err := kafkaProducer.Users.GetUser(ctx, &gen.GetUserRequest{Id: userID})
+	if err != nil {
+		return false, err
+	}
+	return resp.GetUser().GetVerified(), nil
+}
+
+// produced is the outcome of producing a message
+type produced struct {
+	Partition int32 `json:"partition"`
+	Offset    int64 `json:"offset"`
+	err       error
+}
+
+func (kafkaProducer *KafkaMessageProducer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userString).(*model.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer r.Body.Close()
+
+	req, err := parseNotificationRequest(http.MaxBytesReader(w, r.Body, maxNotificationBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idempotencyKey, err := parseIdempotencyKey(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !user.Verified && req.ChatID == nil {
+		// The claim is as old as the access token, the user may have verified since
+		verified, err := kafkaProducer.verified(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error checking whether %s is verified: %v\n", user.ID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			http.Error(w, "Verify your email before creating chats", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Messages are always sent by the authenticated user, whatever sender the client claims
+	id := eventID(user.ID, idempotencyKey)
+	event := req.event(id, user.ID, idempotencyKey)
+	payload, err := events.Marshal(event)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// Keying by sender keeps a user's messages in order, and their retries from being processed concurrently
+	message := &sarama.ProducerMessage{
+		Topic: kafkaProducer.KafkaTopic,
+		Key:   sarama.StringEncoder(user.ID),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(events.TypeHeader), Value: []byte(events.Type(event))},
+			{Key: []byte(events.VersionHeader), Value: []byte(events.Version)},
+		},
+		Value: sarama.ByteEncoder(payload),
+	}
+
+	res, err := kafkaProducer.produce(r.Context(), message)
+	if err != nil {
+		log.Printf("Error producing message %s: %v\n", id, err)
+		http.Error(w, "Failed to produce message", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct {
+		ID string `json:"id"`
+		produced
+	}{id, res})
+}
+
+// produce sends the message and waits until the brokers acknowledged it
+func (kafkaProducer *KafkaMessageProducer) produce(ctx context.Context, message *sarama.ProducerMessage) (produced, error) {
+	// The buffer lets drain hand over the outcome even when the request gave up waiting
+	done := make(chan produced, 1)
+	message.Metadata = done
+
+	ctx, cancel := context.WithTimeout(ctx, kafkaProducer.Timeout)
+	defer cancel()
+	select {
+	case kafkaProducer.Producer.Input() <- message:
+	case <-ctx.Done():
+		producerMetrics.Add("timed_out", 1)
+		return produced{}, ErrProduceTimeout
+	}
+	select {
+	case res := <-done:
+		return res, res.err
+	case <-ctx.Done():
+		producerMetrics.Add("timed_out", 1)
+		return produced{}, ErrProduceTimeout
+	}
+}
+
+// drain hands the producer's acknowledgements and errors to the requests waiting for them until the
+// producer is closed. Both have to be drained, a producer stops producing once either channel fills up.
+func (kafkaProducer *KafkaMessageProducer) drain() {
+	successes, errs := kafkaProducer.Producer.Successes(), kafkaProducer.Producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case message, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			producerMetrics.Add("acknowledged", 1)
+			reply(message, produced{Partition: message.Partition, Offset: message.Offset})
+		case perr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			producerMetrics.Add("failed", 1)
+			log.Printf("Error producing to %s: %v\n", kafkaProducer.KafkaTopic, perr.Err)
+			reply(perr.Msg, produced{err: perr.Err})
+		}
+	}
+}
+
+// reply hands the outcome to the request that produced the message
+func reply(message *sarama.ProducerMessage, res produced) {
+	if message == nil {
+		return
+	}
+	if done, ok := message.Metadata.(chan produced); ok {
+		done <- res
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/events"
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"google.golang.org/grpc"
+)
+
+func TestKafkaMessageProducer(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	defer producer.Close()
+	h := NewKafkaMessageProducer("notifications", producer, time.Second, nil)
+
+	// post sends the body as alice
+	post := func(h http.Handler, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/notification", strings.NewReader(body))
+		r.Header.Set(IdempotencyKeyHeader, "retry-1")
+		r = r.WithContext(context.WithValue(r.Context(), userString, &model.User{ID: "alice", Verified: true}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// count returns the value of a producer metric
+	count := func(key string) int64 {
+		if v, ok := producerMetrics.Get(key).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+
+	// Test acknowledged messages are reported with their position, sent by the authenticated user
+	// with the idempotency key they were retried with
+	t.Run("TestAcknowledged", func(t *testing.T) {
+		producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			payload, err := msg.Value.Encode()
+			if err != nil {
+				return err
+			}
+			event, err := events.Unmarshal("MessagePosted", events.Version, payload)
+			if err != nil {
+				return err
+			}
+			if sender := event.(*eventsv1.MessagePosted).Sender; sender != "alice" {
+				return errors.New("expected alice to send the message, got " + sender)
+			}
+			if key := event.(*eventsv1.MessagePosted).IdempotencyKey; key != "retry-1" {
+				return errors.New("expected the idempotency key, got " + key)
+			}
+			return nil
+		})
+		w := post(h, `{"sender": "mallory", "chat_id": "chat", "msg": "Wuphf"}`)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected %d, got %d: %s", http.StatusAccepted, w.Code, w.Body)
+		}
+		var res struct {
+			ID     string `json:"id"`
+			Offset int64  `json:"offset"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		if res.ID == "" || res.Offset != 1 {
+			t.Errorf("Expected the message id and offset 1, got %+v", res)
+		}
+	})
+
+	// Test replays with the same idempotency key are answered with the id of the original request
+	t.Run("TestReplay", func(t *testing.T) {
+		ids := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			producer.ExpectInputAndSucceed()
+			w := post(h, `{"chat_id": "chat", "msg": "Wuphf"}`)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("Expected %d, got %d: %s", http.StatusAccepted, w.Code, w.Body)
+			}
+			var res struct {
+				ID string `json:"id"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			ids[res.ID] = true
+		}
+		if len(ids) != 1 {
+			t.Errorf("Expected the same id for both requests, got %v", ids)
+		}
+	})
+
+	// Test failed messages are reported as unavailable
+	t.Run("TestFailed", func(t *testing.T) {
+		failed := count("failed")
+		producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+		if w := post(h, `{"chat_id": "chat", "msg": "Wuphf"}`); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected %d, got %d: %s", http.StatusServiceUnavailable, w.Code, w.Body)
+		}
+		if count("failed") != failed+1 {
+			t.Errorf("Expected the failure to be counted")
+		}
+	})
+
+	// Test messages that aren't acknowledged in time are reported as unavailable
+	t.Run("TestTimeout", func(t *testing.T) {
+		config := mocks.NewTestConfig()
+		silent := mocks.NewAsyncProducer(t, config)
+		defer silent.Close()
+		silent.ExpectInputAndSucceed()
+		h := NewKafkaMessageProducer("notifications", silent, 10*time.Millisecond, nil)
+		if w := post(h, `{"chat_id": "chat", "msg": "Wuphf"}`); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected %d, got %d: %s", http.StatusServiceUnavailable, w.Code, w.Body)
+		}
+	})
+
+	// Test users whose token predates their verification can create chats
+	t.Run("TestVerifiedSinceToken", func(t *testing.T) {
+		users := &verifiedUsersClient{verified: map[string]bool{}}
+		h := NewKafkaMessageProducer("notifications", producer, time.Second, users)
+		post := func() int {
+			r := httptest.NewRequest(http.MethodPost, "/notification", strings.NewReader(`{"receivers": ["bob"]}`))
+			r = r.WithContext(context.WithValue(r.Context(), userString, &model.User{ID: "carol"}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w.Code
+		}
+		if code := post(); code != http.StatusForbidden {
+			t.Errorf("Expected %d before verifying, got %d", http.StatusForbidden, code)
+		}
+		users.verified["carol"] = true
+		producer.ExpectInputAndSucceed()
+		if code := post(); code != http.StatusAccepted {
+			t.Errorf("Expected %d after verifying, got %d", http.StatusAccepted, code)
+		}
+	})
+
+	// Test malformed requests never reach the producer
+	t.Run("TestMalformed", func(t *testing.T) {
+		if w := post(h, `{"chat_id": "chat"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+		}
+	})
+}
+
+// verifiedUsersClient reports users as verified from a map
+type verifiedUsersClient struct {
+	gen.AuthServiceClient
+	verified map[string]bool
+}
+
+func (c *verifiedUsersClient) GetUser(_ context.Context, req *gen.GetUserRequest, _ ...grpc.CallOption) (*gen.UserResponse, error) {
+	return &gen.UserResponse{User: &gen.User{Id: req.GetId(), Verified: c.verified[req.GetId()]}}, nil
+}
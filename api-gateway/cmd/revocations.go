@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// revocationsRefreshInterval is how often revoked sessions are synced from the auth service
+	revocationsRefreshInterval = 15 * time.Second
+	// revocationsOverlap re-requests a short window on every sync so revocations aren't missed at the boundary
+	revocationsOverlap = 5 * time.Second
+	// initialRevocationsLookback is used on the first sync, before the auth service reports the token lifetime
+	initialRevocationsLookback = 24 * time.Hour
+)
+
+// RevocationCache mirrors the sessions revoked by the auth service so tokens
+// can be checked for revocation without a round-trip per request
+type RevocationCache struct {
+	sync.Mutex
+	client gen.AuthServiceClient
+	// syncs collapses concurrent syncs into one call, the lock isn't held while it's in flight
+	syncs       singleflight.Group
+	revoked     map[string]time.Time
+	syncedAt    time.Time
+	refreshedAt time.Time
+	// tokenTTL is how long revocations are kept when the auth service doesn't report the token lifetime
+	tokenTTL time.Duration
+}
+
+// NewRevocationCache creates a new revocation cache backed by the given auth service client
+func NewRevocationCache(client gen.AuthServiceClient) *RevocationCache {
+	return &RevocationCache{client: client, revoked: map[string]time.Time{}, tokenTTL: auth.AccessTokenTTL}
+}
+
+// IsRevoked reports whether the session has been revoked, syncing with the auth service when due
+func (c *RevocationCache) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	c.Lock()
+	due := time.Since(c.refreshedAt) >= revocationsRefreshInterval
+	c.Unlock()
+	if due {
+		_, err, _ := c.syncs.Do("revocations", func() (any, error) {
+			// The sync is shared, so it mustn't be cancelled along with the request that started it
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), authFetchTimeout)
+			defer cancel()
+			return nil, c.refresh(ctx)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.revoked[sessionID]
+	return ok, nil
+}
+
+func (c *RevocationCache) refresh(ctx context.Context) error {
+	now := time.Now()
+	c.Lock()
+	since := c.syncedAt
+	c.Unlock()
+	if since.IsZero() {
+		since = now.Add(-initialRevocationsLookback)
+	}
+
+	resp, err := c.client.ListRevokedSessions(ctx, &gen.RevokedSessionsRequest{Since: since.Unix()})
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for _, s := range resp.GetSessions() {
+		c.revoked[s.GetSessionId()] = time.Unix(s.GetRevokedAt(), 0)
+	}
+
+	// Tokens of sessions revoked longer ago than their lifetime have expired anyway
+	ttl := time.Duration(resp.GetTokenTtl()) * time.Second
+	if ttl <= 0 {
+		ttl = c.tokenTTL
+	}
+	for id, revokedAt := range c.revoked {
+		if now.Sub(revokedAt) > ttl {
+			delete(c.revoked, id)
+		}
+	}
+
+	c.syncedAt = now.Add(-revocationsOverlap)
+	c.refreshedAt = now
+	return nil
+}
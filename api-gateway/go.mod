@@ -3,16 +3,20 @@ module github.com/Azanul/wuphf-dot-com/api-gateway
 go 1.21.3
 
 require (
-	github.com/Azanul/wuphf-dot-com/user v0.0.0-20240211154327-2427126e53d0
-	github.com/IBM/sarama v1.42.2
+	github.com/Azanul/wuphf-dot-com/events v0.0.0-00010101000000-000000000000
+	github.com/Azanul/wuphf-dot-com/user v0.0.0-00010101000000-000000000000
+	github.com/IBM/sarama v1.43.2
+	github.com/google/uuid v1.6.0
+	golang.org/x/sync v0.7.0
 	google.golang.org/grpc v1.61.0
+	google.golang.org/protobuf v1.32.0
 )
 
-require github.com/google/uuid v1.6.0 // indirect
+require github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/eapache/go-resiliency v1.5.0 // indirect
+	github.com/eapache/go-resiliency v1.6.0 // indirect
 	github.com/eapache/go-xerial-snappy v0.0.0-20230731223053-c322873962e3 // indirect
 	github.com/eapache/queue v1.1.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
@@ -25,13 +29,17 @@ require (
 	github.com/jcmturner/gofork v1.7.6 // indirect
 	github.com/jcmturner/gokrb5/v8 v8.4.4 // indirect
 	github.com/jcmturner/rpc/v2 v2.0.3 // indirect
-	github.com/klauspost/compress v1.16.7 // indirect
+	github.com/klauspost/compress v1.17.8 // indirect
 	github.com/pierrec/lz4/v4 v4.1.21 // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475 // indirect
-	golang.org/x/crypto v0.19.0 // indirect
-	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/crypto v0.22.0 // indirect
+	golang.org/x/net v0.24.0 // indirect
+	golang.org/x/sys v0.19.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
-	google.golang.org/protobuf v1.32.0 // indirect
+)
+
+replace (
+	github.com/Azanul/wuphf-dot-com/events => ../events
+	github.com/Azanul/wuphf-dot-com/user => ../user
 )
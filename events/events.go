@@ -0,0 +1,102 @@
+// Package events defines the events services publish to Kafka. Events are Protobuf messages,
+// the Kafka headers carry their type and the version of the schema they were encoded with.
+package events
+
+import (
+	"errors"
+	"fmt"
+
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// TypeHeader is the Kafka header carrying the event type, e.g. MessagePosted
+	TypeHeader = "event-type"
+	// VersionHeader is the Kafka header carrying the schema version the event was encoded with
+	VersionHeader = "event-version"
+	// Version is the schema version events are published with
+	Version = "1"
+)
+
+var (
+	// ErrUnknownEvent is returned for events of an unknown type or schema version
+	ErrUnknownEvent = errors.New("unknown event")
+	// ErrMalformedEvent is returned for events that can't be decoded or lack required fields
+	ErrMalformedEvent = errors.New("malformed event")
+)
+
+// schemas holds a constructor for every event type of every supported schema version
+var schemas = map[string]map[string]func() proto.Message{
+	"1": {
+		"ChatCreated":    func() proto.Message { return &eventsv1.ChatCreated{} },
+		"MessagePosted":  func() proto.Message { return &eventsv1.MessagePosted{} },
+		"UserRegistered": func() proto.Message { return &eventsv1.UserRegistered{} },
+		"AccountMessage": func() proto.Message { return &eventsv1.AccountMessage{} },
+	},
+}
+
+// Type returns the type an event is published as
+func Type(event proto.Message) string {
+	return string(event.ProtoReflect().Descriptor().Name())
+}
+
+// Marshal validates and encodes an event of the current schema version
+func Marshal(event proto.Message) ([]byte, error) {
+	if _, ok := schemas[Version][Type(event)]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, Type(event))
+	}
+	if err := validate(event); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(event)
+}
+
+// Unmarshal decodes and validates an event of the given type and schema version
+func Unmarshal(eventType, version string, payload []byte) (proto.Message, error) {
+	newEvent, ok := schemas[version][eventType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q version %q", ErrUnknownEvent, eventType, version)
+	}
+	event := newEvent()
+	if err := proto.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	if err := validate(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// validate checks the event carries the fields consumers rely on
+func validate(event proto.Message) error {
+	var missing string
+	switch e := event.(type) {
+	case *eventsv1.ChatCreated:
+		if e.Sender == "" {
+			missing = "sender"
+		} else if len(e.Receivers) == 0 {
+			missing = "receivers"
+		}
+	case *eventsv1.MessagePosted:
+		if e.Sender == "" {
+			missing = "sender"
+		} else if e.ChatId == "" {
+			missing = "chat_id"
+		}
+	case *eventsv1.UserRegistered:
+		if e.UserId == "" {
+			missing = "user_id"
+		}
+	case *eventsv1.AccountMessage:
+		if e.Type == "" {
+			missing = "type"
+		} else if e.Receiver == "" {
+			missing = "receiver"
+		}
+	}
+	if missing != "" {
+		return fmt.Errorf("%w: %s without %s", ErrMalformedEvent, Type(event), missing)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEvents(t *testing.T) {
+	posted := &eventsv1.MessagePosted{Id: "m1", Sender: "alice", ChatId: "chat", Msg: "Wuphf", CreatedAt: timestamppb.Now()}
+
+	// Test events survive encoding
+	t.Run("TestRoundTrip", func(t *testing.T) {
+		payload, err := Marshal(posted)
+		if err != nil {
+			t.Fatalf("Error marshaling event: %v", err)
+		}
+		event, err := Unmarshal(Type(posted), Version, payload)
+		if err != nil {
+			t.Fatalf("Error unmarshaling event: %v", err)
+		}
+		if !proto.Equal(event, posted) {
+			t.Errorf("Expected %v, got %v", posted, event)
+		}
+	})
+
+	// Test unknown types and versions are rejected
+	t.Run("TestUnknownEvent", func(t *testing.T) {
+		payload, err := Marshal(posted)
+		if err != nil {
+			t.Fatalf("Error marshaling event: %v", err)
+		}
+		if _, err := Unmarshal("MessageDeleted", Version, payload); !errors.Is(err, ErrUnknownEvent) {
+			t.Errorf("Expected %v, got %v", ErrUnknownEvent, err)
+		}
+		if _, err := Unmarshal(Type(posted), "", payload); !errors.Is(err, ErrUnknownEvent) {
+			t.Errorf("Expected %v, got %v", ErrUnknownEvent, err)
+		}
+	})
+
+	// Test undecodable events and events without required fields are rejected
+	t.Run("TestMalformedEvent", func(t *testing.T) {
+		if _, err := Unmarshal(Type(posted), Version, []byte(`{"sender": "alice"}`)); !errors.Is(err, ErrMalformedEvent) {
+			t.Errorf("Expected %v, got %v", ErrMalformedEvent, err)
+		}
+		payload, err := proto.Marshal(&eventsv1.ChatCreated{Sender: "alice"})
+		if err != nil {
+			t.Fatalf("Error marshaling event: %v", err)
+		}
+		if _, err := Unmarshal("ChatCreated", Version, payload); !errors.Is(err, ErrMalformedEvent) {
+			t.Errorf("Expected %v, got %v", ErrMalformedEvent, err)
+		}
+		if _, err := Marshal(&eventsv1.MessagePosted{Sender: "alice"}); !errors.Is(err, ErrMalformedEvent) {
+			t.Errorf("Expected %v, got %v", ErrMalformedEvent, err)
+		}
+	})
+}
@@ -0,0 +1,5 @@
+module github.com/Azanul/wuphf-dot-com/events
+
+go 1.21.3
+
+require google.golang.org/protobuf v1.32.0
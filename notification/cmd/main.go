@@ -5,56 +5,191 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Azanul/wuphf-dot-com/notification/internal/controller/notification"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/deadletter"
 	httphandler "github.com/Azanul/wuphf-dot-com/notification/internal/handler/http"
 	"github.com/Azanul/wuphf-dot-com/notification/internal/handler/kafka"
+	httpwebhook "github.com/Azanul/wuphf-dot-com/notification/internal/integration/http-webhook"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/httpclient"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/slack"
+	smtpemail "github.com/Azanul/wuphf-dot-com/notification/internal/integration/smtp-email"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/teams"
 	twiliosms "github.com/Azanul/wuphf-dot-com/notification/internal/integration/twilio-sms"
+	webpush "github.com/Azanul/wuphf-dot-com/notification/internal/integration/web-push"
 	"github.com/Azanul/wuphf-dot-com/notification/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/client"
 
 	"github.com/IBM/sarama"
 )
 
+// shutdownTimeout is how long queued deliveries get to finish when the service is stopped
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
 
 	log.Println("Starting the notification service")
 	repo := memory.New()
 
-	twilioIntegration := twiliosms.New()
-	ctrl := notification.New(repo)
-	ctrl.AddIntegration(twilioIntegration)
+	users, err := client.New(os.Getenv("AUTH_SERVICE_ADDR"))
+	if err != nil {
+		log.Fatalf("Failed to connect to the user service: %v", err)
+	}
+	defer users.Close()
+
+	twilioIntegration := twiliosms.New(os.Getenv("TWILIO_STATUS_CALLBACK_URL"))
+	ctrl := notification.New(repo, users)
+	if window := os.Getenv("IDEMPOTENCY_WINDOW"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			log.Fatalf("Failed to parse IDEMPOTENCY_WINDOW: %v", err)
+		}
+		ctrl.SetIdempotencyWindow(d)
+	}
+	go pruneIdempotencyRecords(ctx, ctrl)
+
+	producerConfig := sarama.NewConfig()
+	producerConfig.Producer.Return.Successes = true
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	dlqProducer, err := sarama.NewSyncProducer(strings.Split(kafkaBrokers, ","), producerConfig)
+	if err != nil {
+		log.Fatalf("Error creating Kafka producer: %v", err)
+	}
+	defer dlqProducer.Close()
+	ctrl.SetDeadLetterPublisher(deadletter.NewKafkaPublisher(dlqProducer, deadletter.Topic))
+
+	ctrl.AddIntegrationWithLimits(twilioIntegration, notification.Limits{Workers: 4, Queue: 100, Timeout: 15 * time.Second})
+	ctrl.AddIntegrationWithLimits(slack.New(httpclient.DefaultTimeout), notification.Limits{Workers: 8, Queue: 100, Timeout: httpclient.DefaultTimeout})
+	ctrl.AddIntegrationWithLimits(teams.New(httpclient.DefaultTimeout), notification.Limits{Workers: 8, Queue: 100, Timeout: httpclient.DefaultTimeout})
 
-	h := httphandler.New(ctrl)
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		emailIntegration, err := smtpemail.New(smtpAddr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM"))
+		if err != nil {
+			log.Fatalf("Failed to configure the SMTP email integration: %v", err)
+		}
+		ctrl.AddIntegrationWithLimits(emailIntegration, notification.Limits{Workers: 4, Queue: 100, Timeout: 30 * time.Second})
+	}
+
+	ctrl.AddIntegrationWithLimits(httpwebhook.New(httpclient.DefaultTimeout), notification.Limits{Workers: 8, Queue: 100, Timeout: httpclient.DefaultTimeout})
+
+	vapidKeys, err := loadVAPIDKeys(os.Getenv("VAPID_PRIVATE_KEY"))
+	if err != nil {
+		log.Fatalf("Failed to load VAPID keys: %v", err)
+	}
+	pushIntegration := webpush.New(vapidKeys, os.Getenv("VAPID_SUBJECT"), httpclient.DefaultTimeout)
+	ctrl.AddIntegrationWithLimits(pushIntegration, notification.Limits{Workers: 16, Queue: 500, Timeout: httpclient.DefaultTimeout})
+
+	// Deliveries pending when the service stopped are resumed before consuming more messages
+	resumed, err := ctrl.ResumeDeliveries(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to resume pending deliveries: %v", err)
+	}
+	log.Printf("Resumed %d pending deliveries\n", resumed)
+
+	twilioCallbacks := twiliosms.NewStatusCallbacks(os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_STATUS_CALLBACK_URL"))
+	h := httphandler.New(ctrl, pushIntegration.PublicKey(), os.Getenv("ADMIN_TOKEN"), twilioCallbacks)
 
 	topics := []string{"chats", "notifications"}
 
-	// Start Kafka consumer
+	// Start Kafka consumer, it stops consuming once the service is stopped
+	consumed := make(chan struct{})
 	go func() {
-		ctx := context.Background()
+		defer close(consumed)
 		config := sarama.NewConfig()
 		config.Consumer.IsolationLevel = sarama.ReadCommitted
+		// Offsets are committed by the handler once a message is processed
+		config.Consumer.Offsets.AutoCommit.Enable = false
+		config.Consumer.Return.Errors = true
 		consumerGroup, err := sarama.NewConsumerGroup(strings.Split(kafkaBrokers, ","), "notification_consumer_group", config)
 		if err != nil {
 			log.Fatalf("Error creating Kafka consumer group: %v", err)
 		}
 		defer consumerGroup.Close()
 
+		go func() {
+			for err := range consumerGroup.Errors() {
+				log.Printf("Error consuming: %v\n", err)
+			}
+		}()
+
 		consumer := kafka.New(ctrl)
-		err = consumerGroup.Consume(ctx, topics, consumer)
-		if err != nil {
-			log.Fatalf("Error consuming topic: %v", err)
+		for ctx.Err() == nil {
+			if err := consumerGroup.Consume(ctx, topics, consumer); err != nil {
+				log.Fatalf("Error consuming topic: %v", err)
+			}
+			// Consuming stops on rebalances and when a message failed, which is retried after rejoining
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
 		}
 	}()
 
 	// Endpoints
-	http.Handle("/notification", http.HandlerFunc(h.Notification))
-	http.Handle("/history", http.HandlerFunc(h.History))
+	mux := http.NewServeMux()
+	mux.Handle("/notification", http.HandlerFunc(h.Notification))
+	mux.Handle("/notification/", http.HandlerFunc(h.Deliveries))
+	mux.Handle("/history", http.HandlerFunc(h.History))
+	mux.Handle("/push/", http.HandlerFunc(h.Push))
+	mux.Handle("/twilio/status", http.HandlerFunc(h.TwilioStatus))
+	mux.Handle("/admin/dlq", http.HandlerFunc(h.DeadLetters))
+	mux.Handle("/admin/dlq/", http.HandlerFunc(h.DeadLetters))
+
+	srv := &http.Server{Addr: ":8082", Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Stopping the notification service")
 
-	if err := http.ListenAndServe(":8082", nil); err != nil {
-		log.Fatal(err)
+	// Stop taking new messages before draining the deliveries already queued
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error stopping the HTTP server: %v\n", err)
 	}
+	<-consumed
+	if err := ctrl.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error draining deliveries: %v\n", err)
+	}
+}
+
+// pruneIdempotencyRecords periodically forgets the idempotency keys that fell out of the window
+func pruneIdempotencyRecords(ctx context.Context, ctrl *notification.Controller) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ctrl.PruneIdempotencyRecords(ctx); err != nil {
+				log.Printf("Error pruning idempotency records: %v\n", err)
+			}
+		}
+	}
+}
 
-	<-make(chan struct{})
+// loadVAPIDKeys parses the configured VAPID private key, or generates a key pair when none is configured.
+// Browsers have to subscribe again whenever the key changes, so generated keys are only fit for development.
+func loadVAPIDKeys(private string) (*webpush.VAPIDKeys, error) {
+	if private != "" {
+		return webpush.ParseVAPIDKeys(private)
+	}
+	keys, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return nil, err
+	}
+	log.Println("No VAPID_PRIVATE_KEY configured, generated a key pair that won't survive restarts")
+	return keys, nil
 }
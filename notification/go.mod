@@ -2,11 +2,24 @@ module github.com/Azanul/wuphf-dot-com/notification
 
 go 1.21.3
 
-require github.com/IBM/sarama v1.43.2
+require (
+	github.com/Azanul/wuphf-dot-com/events v0.0.0-00010101000000-000000000000
+	github.com/Azanul/wuphf-dot-com/user v0.0.0-00010101000000-000000000000
+	github.com/IBM/sarama v1.43.2
+	github.com/emersion/go-smtp v0.15.0
+	google.golang.org/protobuf v1.32.0
+)
 
 require (
+	github.com/emersion/go-sasl v0.0.0-20200509203442-7bfe0ed36a21 // indirect
 	github.com/golang/mock v1.6.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.19.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
+	google.golang.org/grpc v1.61.0 // indirect
 )
 
 require (
@@ -31,3 +44,8 @@ require (
 	golang.org/x/crypto v0.22.0 // indirect
 	golang.org/x/net v0.24.0 // indirect
 )
+
+replace (
+	github.com/Azanul/wuphf-dot-com/events => ../events
+	github.com/Azanul/wuphf-dot-com/user => ../user
+)
@@ -3,43 +3,93 @@ package notification
 import (
 	"context"
 	"crypto/sha256"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
 )
 
 type notificationIntegration interface {
 	Name() string
-	Notify(receiver, message string) (string, error)
+	// Channel is the kind of user receiver the integration delivers to, e.g. "sms"
+	Channel() string
+	// Notify delivers the message to the recipient's address and reports the outcome,
+	// failures are reported in the result rather than as an error
+	Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult
+}
+
+type userResolver interface {
+	BatchGetUsers(ctx context.Context, ids []string) (map[string]*usermodel.User, error)
+	ValidateToken(ctx context.Context, token string) (*usermodel.User, error)
 }
 
 type notificationRepository interface {
 	Get(ctx context.Context, id string) (*model.Notification, error)
 	Post(ctx context.Context, chatId string, n *model.Notification) (int, error)
+	PutDelivery(ctx context.Context, d *model.Delivery) error
+	ListDeliveries(ctx context.Context, notificationID string) ([]*model.Delivery, error)
+	ListChatDeliveries(ctx context.Context, chatID string) ([]*model.Delivery, error)
+	ListPendingDeliveries(ctx context.Context) ([]*model.Delivery, error)
+	GetDeliveryByProviderID(ctx context.Context, integration, providerID string) (*model.Delivery, error)
+	IsProcessed(ctx context.Context, messageID string) (bool, error)
+	MarkProcessed(ctx context.Context, messageID string) error
+	GetIdempotencyRecord(ctx context.Context, sender, key string) (*model.IdempotencyRecord, error)
+	ReserveIdempotencyKey(ctx context.Context, rec *model.IdempotencyRecord, expired, abandoned time.Time) (bool, error)
+	CompleteIdempotencyRecord(ctx context.Context, sender, key, result string) error
+	ReleaseIdempotencyKey(ctx context.Context, sender, key string) error
+	DeleteIdempotencyRecords(ctx context.Context, before time.Time) error
 	List(ctx context.Context, chatId string) ([]*model.Notification, error)
 	AssociateUserWithChat(ctx context.Context, userId, chatId string)
 	ListChats(ctx context.Context, userId string) ([]string, error)
 	ListUsers(ctx context.Context, chatId string) ([]string, error)
+	PostPushSubscription(ctx context.Context, sub *model.PushSubscription) error
+	ListPushSubscriptions(ctx context.Context, userID string) ([]*model.PushSubscription, error)
+	DeletePushSubscription(ctx context.Context, id string) error
+	DeletePushSubscriptionByEndpoint(ctx context.Context, userID, endpoint string) error
+	PostDeadLetter(ctx context.Context, dl *model.DeadLetter) error
+	GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error)
+	ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id string) error
 }
 
 // Controller defines a notification service controller
 type Controller struct {
-	repo         notificationRepository
-	integrations []notificationIntegration
+	repo       notificationRepository
+	users      userResolver
+	dispatcher *dispatcher
+	// deadLetters, when set, is told about deliveries that failed for good
+	deadLetters deadLetterPublisher
+	// idempotencyWindow is how long replays of a request are recognized by its idempotency key
+	idempotencyWindow time.Duration
 }
 
-// New creates a notification service controller
-func New(repo notificationRepository) *Controller {
-	return &Controller{repo, []notificationIntegration{}}
+// New creates a notification service controller, users resolves user ids into their receivers
+func New(repo notificationRepository, users userResolver) *Controller {
+	c := &Controller{repo: repo, users: users, idempotencyWindow: DefaultIdempotencyWindow}
+	c.dispatcher = newDispatcher(c.recordDelivery, c.recordRetry)
+	return c
 }
 
+// AddIntegration adds an integration delivering with the DefaultLimits
 func (c *Controller) AddIntegration(ni notificationIntegration) {
-	c.integrations = append(c.integrations, ni)
+	c.AddIntegrationWithLimits(ni, DefaultLimits)
+}
+
+// AddIntegrationWithLimits adds an integration and starts its pool of delivery workers
+func (c *Controller) AddIntegrationWithLimits(ni notificationIntegration, limits Limits) {
+	c.dispatcher.add(ni, limits)
+}
+
+// Shutdown stops accepting deliveries and waits for the queued and in-flight ones to finish.
+// If ctx is done first the remaining deliveries are cancelled and ctx's error is returned.
+func (c *Controller) Shutdown(ctx context.Context) error {
+	return c.dispatcher.shutdown(ctx)
 }
 
 // Create new chat
@@ -58,8 +108,9 @@ func (c *Controller) PostChat(ctx context.Context, sender string, receivers []st
 	return chatId
 }
 
-// Post new notification
-func (c *Controller) Post(ctx context.Context, sender, chatId, msg string) (string, error) {
+// Post new notification, messageID identifies the message it's posted for so posting it again, e.g. when
+// the message is redelivered, neither duplicates its notifications nor their deliveries
+func (c *Controller) Post(ctx context.Context, messageID, sender, chatId, msg string) (string, error) {
 	var receivers []string
 	var err error
 	if chatId == "" {
@@ -73,32 +124,124 @@ func (c *Controller) Post(ctx context.Context, sender, chatId, msg string) (stri
 		}
 	}
 
+	users := c.resolveUsers(ctx, append([]string{sender}, receivers...))
+	envelope := model.Envelope{ChatID: chatId, Sender: sender, Body: msg, CreatedAt: time.Now()}
+	if u, ok := users[sender]; ok {
+		envelope.SenderName = u.DisplayName()
+	}
+
 	for _, receiver := range receivers {
-		reference := map[string]string{}
-		for _, i := range c.integrations {
-			res, err := i.Notify(receiver, msg)
-			if err == nil {
-				reference[i.Name()] = res
-			} else {
-				reference[i.Name()] = err.Error()
-			}
-		}
-		refBytes, err := json.Marshal(reference)
+		notification, err := model.NewNotification(sender, receiver, msg)
 		if err != nil {
 			return "", err
 		}
+		notification.MessageID = messageID
 
-		notification, err := model.NewNotification(sender, receiver, msg, string(refBytes))
+		_, err = c.repo.Post(ctx, chatId, notification)
+		if err != nil && errors.Is(err, repository.ErrNotFound) {
+			return "", repository.ErrNotFound
+		}
 		if err != nil {
 			return "", err
 		}
 
-		_, err = c.repo.Post(ctx, chatId, notification)
-		if err != nil && errors.Is(err, repository.ErrNotFound) {
-			return "", repository.ErrNotFound
+		envelope.ID = notification.ID
+		if err := c.notifyUser(ctx, notification.ID, receiver, users[receiver], envelope); err != nil {
+			return "", err
+		}
+	}
+	return chatId, nil
+}
+
+// Send queues a message to a recipient address outside of any chat, e.g. for account emails,
+// for delivery through every integration of the recipient's channel. The deliveries are recorded under
+// id, which identifies the message so sending it again doesn't deliver it twice.
+func (c *Controller) Send(ctx context.Context, id string, to model.Recipient, msg model.Envelope) error {
+	to = c.withSecret(ctx, to)
+	delivered, err := c.delivered(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, p := range c.dispatcher.channel(to.Channel) {
+		if delivered[deliveryKey(p.integration.Name(), "")] {
+			continue
+		}
+		if err := c.enqueue(ctx, p, job{notificationID: id, to: to, msg: msg}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveUsers looks up the users with the given ids, users that can't be resolved are left out
+func (c *Controller) resolveUsers(ctx context.Context, ids []string) map[string]*usermodel.User {
+	if c.users == nil {
+		return map[string]*usermodel.User{}
+	}
+	users, err := c.users.BatchGetUsers(ctx, ids)
+	if err != nil {
+		log.Printf("Error resolving users: %v\n", err)
+		return map[string]*usermodel.User{}
+	}
+	return users
+}
+
+// withSecret looks up the secret of the user's webhook receiver at the recipient's address, recipients of
+// other channels are returned as they are
+func (c *Controller) withSecret(ctx context.Context, to model.Recipient) model.Recipient {
+	if to.Channel != usermodel.ChannelWebhook || to.Secret != "" || to.UserID == "" {
+		return to
+	}
+	if u, ok := c.resolveUsers(ctx, []string{to.UserID})[to.UserID]; ok {
+		for _, r := range u.Receivers {
+			if r.Channel == to.Channel && r.Address == to.Address {
+				to.Secret = r.Secret
+			}
+		}
+	}
+	return to
+}
+
+// notifyUser queues the message for every verified receiver and push subscription of the user,
+// through the integrations of its channel, unless the notification was queued for it before.
+// The results are recorded on the notification.
+func (c *Controller) notifyUser(ctx context.Context, notificationID, userID string, user *usermodel.User, msg model.Envelope) error {
+	to := model.Recipient{UserID: userID}
+	var receivers []*usermodel.Receiver
+	if user != nil {
+		to.Name = user.DisplayName()
+		receivers = append(receivers, user.Receivers...)
+	}
+	subs, err := c.repo.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		log.Printf("Error listing push subscriptions: %v\n", err)
+	}
+	pushSubs := map[string]bool{}
+	for _, s := range subs {
+		pushSubs[s.ID] = true
+		receivers = append(receivers, &usermodel.Receiver{ID: s.ID, UserID: userID, Channel: usermodel.ChannelPush, Address: s.Address(), Verified: true})
+	}
+	delivered, err := c.delivered(ctx, notificationID)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range receivers {
+		if !r.Verified {
+			continue
+		}
+		to.Channel, to.Address, to.Secret = r.Channel, r.Address, r.Secret
+		for _, p := range c.dispatcher.channel(r.Channel) {
+			if delivered[deliveryKey(p.integration.Name(), r.ID)] {
+				continue
+			}
+			j := job{notificationID: notificationID, receiverID: r.ID, pushSubscription: pushSubs[r.ID], to: to, msg: msg}
+			if err := c.enqueue(ctx, p, j); err != nil {
+				return err
+			}
 		}
 	}
-	return chatId, err
+	return nil
 }
 
 // Get returns notification by id
@@ -110,13 +253,41 @@ func (c *Controller) Get(ctx context.Context, id string) (*model.Notification, e
 	return res, err
 }
 
-// List returns list of notifications by chat id
+// List returns list of notifications by chat id along with the aggregated status of their deliveries
 func (c *Controller) List(ctx context.Context, chatId string) ([]*model.Notification, error) {
 	res, err := c.repo.List(ctx, chatId)
 	if err != nil && errors.Is(err, repository.ErrNotFound) {
 		return nil, repository.ErrNotFound
+	} else if err != nil {
+		return nil, err
 	}
-	return res, err
+	deliveries, err := c.repo.ListChatDeliveries(ctx, chatId)
+	if err != nil {
+		return nil, err
+	}
+	byNotification := map[string][]*model.Delivery{}
+	for _, d := range deliveries {
+		byNotification[d.NotificationID] = append(byNotification[d.NotificationID], d)
+	}
+	notifications := make([]*model.Notification, 0, len(res))
+	for _, n := range res {
+		notification := *n
+		notification.Status = model.AggregateStatus(byNotification[n.ID])
+		notifications = append(notifications, &notification)
+	}
+	return notifications, nil
+}
+
+// ListDeliveries returns the deliveries of a notification to the user who sent or received it
+func (c *Controller) ListDeliveries(ctx context.Context, userID, id string) ([]*model.Delivery, error) {
+	n, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n.Sender != userID && n.Receiver != userID {
+		return nil, repository.ErrForbidden
+	}
+	return c.repo.ListDeliveries(ctx, id)
 }
 
 // List returns list of chat ids by user id
@@ -137,6 +308,19 @@ func (c *Controller) ListUsers(ctx context.Context, chatId string) ([]string, er
 	return res, err
 }
 
+// UpdateDeliveryStatus records a status the integration's provider reported for a delivery it knows by
+// providerID, e.g. through a status callback. Statuses arriving out of order are ignored.
+func (c *Controller) UpdateDeliveryStatus(ctx context.Context, integration, providerID string, status model.DeliveryStatus, errMsg string) error {
+	d, err := c.repo.GetDeliveryByProviderID(ctx, integration, providerID)
+	if err != nil {
+		return err
+	}
+	if !d.Advance(status, errMsg) {
+		return nil
+	}
+	return c.repo.PutDelivery(ctx, d)
+}
+
 // Helper function to generate chat id from the user ids
 func generateChatID(userIDs []string) string {
 	sort.Strings(userIDs)
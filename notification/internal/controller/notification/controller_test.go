@@ -0,0 +1,723 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/fake"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/client"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// fakeUsers resolves users from a map
+type fakeUsers map[string]*usermodel.User
+
+func (f fakeUsers) BatchGetUsers(_ context.Context, ids []string) (map[string]*usermodel.User, error) {
+	res := map[string]*usermodel.User{}
+	for _, id := range ids {
+		if u, ok := f[id]; ok {
+			res[id] = u
+		}
+	}
+	return res, nil
+}
+
+// ValidateToken accepts tokens of the form "token-<user id>"
+func (f fakeUsers) ValidateToken(_ context.Context, token string) (*usermodel.User, error) {
+	if u, ok := f[strings.TrimPrefix(token, "token-")]; ok && strings.HasPrefix(token, "token-") {
+		return u, nil
+	}
+	return nil, client.ErrInvalidToken
+}
+
+func TestPostResolvesUsers(t *testing.T) {
+	users := fakeUsers{
+		"alice": {ID: "alice", Email: "alice@example.com"},
+		"bob": {ID: "bob", Email: "bob@example.com", Receivers: []*usermodel.Receiver{
+			{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+			{ID: "r2", Channel: usermodel.ChannelSMS, Address: "+14155550124"},
+			{ID: "r3", Channel: usermodel.ChannelEmail, Address: "bob@example.com", Verified: true},
+		}},
+	}
+	sms := fake.New(usermodel.ChannelSMS)
+	ctrl := New(memory.New(), users)
+	ctrl.AddIntegration(sms)
+
+	ctx := context.Background()
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob"})
+	if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+		t.Fatalf("Error posting notification: %v", err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+
+	// Only bob's verified SMS receiver is delivered to, alice has no receivers on the channel
+	sent := sms.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 delivery, got %v", sent)
+	}
+	if sent[0].To.UserID != "bob" || sent[0].To.Address != "+14155550123" || sent[0].Msg.ChatID != chatID || sent[0].Msg.Text() != "alice: Wuphf" {
+		t.Errorf("Unexpected delivery: %v", sent[0])
+	}
+
+	notifications, err := ctrl.List(ctx, chatID)
+	if err != nil {
+		t.Fatalf("Error listing notifications: %v", err)
+	}
+	for _, n := range notifications {
+		if n.Receiver != "bob" {
+			// Test notifications without deliveries have no status
+			if n.Status != "" {
+				t.Errorf("Expected no status, got %s", n.Status)
+			}
+			continue
+		}
+		if n.Status != model.DeliverySent {
+			t.Errorf("Expected status %s, got %s", model.DeliverySent, n.Status)
+		}
+		deliveries, err := ctrl.ListDeliveries(ctx, "bob", n.ID)
+		if err != nil {
+			t.Fatalf("Error listing deliveries: %v", err)
+		}
+		// Test the deliveries are only listed to the sender and receiver of the notification
+		if sent, err := ctrl.ListDeliveries(ctx, "alice", n.ID); err != nil || len(sent) != len(deliveries) {
+			t.Errorf("Expected alice to list the deliveries, got %v, %v", sent, err)
+		}
+		if _, err := ctrl.ListDeliveries(ctx, "mallory", n.ID); err != repository.ErrForbidden {
+			t.Errorf("Expected %v, got %v", repository.ErrForbidden, err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("Expected 1 delivery, got %v", deliveries)
+		}
+		d := deliveries[0]
+		if d.NotificationID != n.ID || d.Channel != usermodel.ChannelSMS || d.Integration != sms.Name() || d.ReceiverID != "r1" || d.ProviderID != "fake-1" || d.Status != model.DeliverySent || d.Attempts != 1 {
+			t.Errorf("Unexpected delivery: %v", d)
+		}
+	}
+	if _, err := ctrl.ListDeliveries(ctx, "alice", chatID+"9"); err != repository.ErrNotFound {
+		t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	email := fake.New(usermodel.ChannelEmail)
+	sms := fake.New(usermodel.ChannelSMS)
+	ctrl := New(memory.New(), fakeUsers{})
+	ctrl.AddIntegration(email)
+	ctrl.AddIntegration(sms)
+	ctx := context.Background()
+
+	to := model.Recipient{UserID: "alice", Channel: usermodel.ChannelEmail, Address: "alice@example.com"}
+	if err := ctrl.Send(ctx, "", to, model.Envelope{Type: "password_reset", Body: "123456"}); err != nil {
+		t.Fatalf("Error sending: %v", err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+
+	// Only the integration of the recipient's channel is used
+	if len(sms.Sent()) != 0 || len(email.Sent()) != 1 {
+		t.Errorf("Unexpected deliveries: sms %v, email %v", sms.Sent(), email.Sent())
+	}
+
+	// Test nothing is queued after shutdown
+	if err := ctrl.Send(ctx, "", to, model.Envelope{Type: "password_reset", Body: "123456"}); err != ErrShuttingDown {
+		t.Errorf("Expected %v, got %v", ErrShuttingDown, err)
+	}
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	users := fakeUsers{"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+		{ID: "w1", Channel: usermodel.ChannelWebhook, Address: "https://example.com/hook1", Verified: true, Secret: "secret1"},
+		{ID: "w2", Channel: usermodel.ChannelWebhook, Address: "https://example.com/hook2", Verified: true, Secret: "secret2"},
+	}}}
+	webhook := fake.New(usermodel.ChannelWebhook)
+	ctrl := New(memory.New(), users)
+	ctrl.AddIntegration(webhook)
+	ctx := context.Background()
+
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob"})
+	if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+		t.Fatalf("Error posting notification: %v", err)
+	}
+	// Account messages name the address only, its secret is looked up
+	to := model.Recipient{UserID: "bob", Channel: usermodel.ChannelWebhook, Address: "https://example.com/hook2"}
+	if err := ctrl.Send(ctx, "", to, model.Envelope{Type: "receiver_verification", Body: "123456"}); err != nil {
+		t.Fatalf("Error sending: %v", err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+
+	// Test every receiver's deliveries are signed with its own secret
+	secrets := map[string]int{}
+	for _, d := range webhook.Sent() {
+		if want := map[string]string{"https://example.com/hook1": "secret1", "https://example.com/hook2": "secret2"}[d.To.Address]; d.To.Secret != want {
+			t.Errorf("Expected %q for %s, got %q", want, d.To.Address, d.To.Secret)
+		}
+		secrets[d.To.Secret]++
+	}
+	if secrets["secret1"] != 1 || secrets["secret2"] != 2 {
+		t.Errorf("Unexpected deliveries: %v", webhook.Sent())
+	}
+}
+
+func TestDeliveryLimits(t *testing.T) {
+	users := fakeUsers{"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+		{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+	}}}
+	ctx := context.Background()
+
+	// Test deliveries taking longer than the integration's timeout fail
+	sms := fake.New(usermodel.ChannelSMS)
+	sms.Hold = make(chan struct{})
+	ctrl := New(memory.New(), users)
+	ctrl.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 1, Timeout: 10 * time.Millisecond, Retry: RetryPolicy{MaxAttempts: 1}})
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob"})
+	if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+		t.Fatalf("Error posting notification: %v", err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+	deliveries, err := ctrl.repo.ListChatDeliveries(ctx, chatID)
+	if err != nil {
+		t.Fatalf("Error listing deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != model.DeliveryFailed || deliveries[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected a timed out delivery, got %v", deliveries)
+	}
+
+	// Test posting blocks while the queue is full
+	sms = fake.New(usermodel.ChannelSMS)
+	sms.Hold = make(chan struct{})
+	ctrl = New(memory.New(), users)
+	ctrl.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 1, Timeout: time.Minute, Retry: RetryPolicy{MaxAttempts: 1}})
+	chatID = ctrl.PostChat(ctx, "alice", []string{"bob"})
+	for i := 0; i < 2; i++ {
+		if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+			t.Fatalf("Error posting notification: %v", err)
+		}
+	}
+	full, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := ctrl.Post(full, "", "alice", chatID, "Wuphf"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// Test shutdown waits for held deliveries and cancels them when it gives up
+	expired, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := ctrl.Shutdown(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	deliveries, err = ctrl.repo.ListChatDeliveries(ctx, chatID)
+	if err != nil {
+		t.Fatalf("Error listing deliveries: %v", err)
+	}
+	var cancelled int
+	for _, d := range deliveries {
+		if d.Status == model.DeliveryFailed && d.Error == context.Canceled.Error() {
+			cancelled++
+		}
+	}
+	if cancelled != 2 {
+		t.Errorf("Expected the queued deliveries to be cancelled, got %v", deliveries)
+	}
+}
+
+func TestUpdateDeliveryStatus(t *testing.T) {
+	users := fakeUsers{"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+		{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+	}}}
+	sms := fake.New(usermodel.ChannelSMS)
+	ctrl := New(memory.New(), users)
+	ctrl.AddIntegration(sms)
+	ctx := context.Background()
+
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob"})
+	if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+		t.Fatalf("Error posting notification: %v", err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+	status := func() model.DeliveryStatus {
+		t.Helper()
+		n, err := ctrl.List(ctx, chatID)
+		if err != nil {
+			t.Fatalf("Error listing notifications: %v", err)
+		}
+		for _, n := range n {
+			if n.Receiver == "bob" {
+				return n.Status
+			}
+		}
+		return ""
+	}
+
+	// Test reported statuses show up in the notification's status
+	if err := ctrl.UpdateDeliveryStatus(ctx, sms.Name(), "fake-1", model.DeliveryDelivered, ""); err != nil {
+		t.Fatalf("Error updating delivery status: %v", err)
+	}
+	if s := status(); s != model.DeliveryDelivered {
+		t.Errorf("Expected status %s, got %s", model.DeliveryDelivered, s)
+	}
+
+	// Test statuses arriving out of order don't move the delivery backwards
+	for _, s := range []model.DeliveryStatus{model.DeliverySent, model.DeliveryFailed} {
+		if err := ctrl.UpdateDeliveryStatus(ctx, sms.Name(), "fake-1", s, ""); err != nil {
+			t.Fatalf("Error updating delivery status: %v", err)
+		}
+	}
+	if s := status(); s != model.DeliveryDelivered {
+		t.Errorf("Expected status %s, got %s", model.DeliveryDelivered, s)
+	}
+
+	// Test statuses for messages we don't know are rejected
+	if err := ctrl.UpdateDeliveryStatus(ctx, sms.Name(), "fake-2", model.DeliveryDelivered, ""); err != repository.ErrNotFound {
+		t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+	}
+}
+
+// fakeDeadLetters records published dead letters
+type fakeDeadLetters struct {
+	mu        sync.Mutex
+	published []*model.DeadLetter
+}
+
+func (f *fakeDeadLetters) PublishDeadLetter(_ context.Context, dl *model.DeadLetter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, dl)
+	return nil
+}
+
+func TestRetries(t *testing.T) {
+	users := fakeUsers{"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+		{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+	}}}
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	ctx := context.Background()
+	repo := memory.New()
+	sms := fake.New(usermodel.ChannelSMS)
+	chatID := New(repo, users).PostChat(ctx, "alice", []string{"bob"})
+	var dlq *fakeDeadLetters
+	// post delivers a message to bob and waits for the deliveries with a fresh controller
+	post := func() {
+		t.Helper()
+		dlq = &fakeDeadLetters{}
+		ctrl := New(repo, users)
+		ctrl.SetDeadLetterPublisher(dlq)
+		ctrl.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 10, Timeout: time.Second, Retry: retry})
+		if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+			t.Fatalf("Error posting notification: %v", err)
+		}
+		if err := ctrl.Shutdown(ctx); err != nil {
+			t.Fatalf("Error draining deliveries: %v", err)
+		}
+	}
+	// deliveries returns the deliveries of bob's latest notification
+	deliveries := func() []*model.Delivery {
+		t.Helper()
+		n, err := repo.List(ctx, chatID)
+		if err != nil {
+			t.Fatalf("Error listing notifications: %v", err)
+		}
+		for i := len(n) - 1; i >= 0; i-- {
+			if n[i].Receiver == "bob" {
+				res, err := repo.ListDeliveries(ctx, n[i].ID)
+				if err != nil {
+					t.Fatalf("Error listing deliveries: %v", err)
+				}
+				return res
+			}
+		}
+		return nil
+	}
+
+	// Test retryable failures are tried again until the delivery succeeds
+	outage := model.FailedDelivery(errors.New("provider unavailable"), true)
+	outage.ResponseCode = 503
+	sms.Results = []*model.DeliveryResult{outage, outage}
+	post()
+	if res := deliveries(); len(res) != 1 || res[0].Status != model.DeliverySent || res[0].Attempts != 3 {
+		t.Errorf("Expected a delivery after 3 attempts, got %v", res)
+	}
+	if len(dlq.published) != 0 {
+		t.Errorf("Expected no dead letters, got %v", dlq.published)
+	}
+
+	// Test deliveries are dead-lettered once out of attempts, along with every attempt
+	sms.Results = []*model.DeliveryResult{outage, outage, outage}
+	post()
+	if res := deliveries(); len(res) != 1 || res[0].Status != model.DeliveryFailed || res[0].Attempts != 3 || res[0].ResponseCode != 503 {
+		t.Errorf("Expected a failure with the provider's response code after 3 attempts, got %v", res)
+	}
+	if len(dlq.published) != 1 || len(dlq.published[0].Attempts) != 3 || dlq.published[0].To.Address != "+14155550123" || dlq.published[0].Msg.Body != "Wuphf" {
+		t.Fatalf("Expected a dead letter with 3 attempts, got %v", dlq.published)
+	}
+
+	// Test permanent failures aren't retried
+	sms.Results = []*model.DeliveryResult{model.FailedDelivery(errors.New("invalid number"), false)}
+	post()
+	if len(dlq.published) != 1 || len(dlq.published[0].Attempts) != 1 {
+		t.Fatalf("Expected a dead letter with 1 attempt, got %v", dlq.published)
+	}
+
+	// Test dead letters are listed and replayed
+	ctrl := New(repo, users)
+	ctrl.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 10, Timeout: time.Second, Retry: retry})
+	dls, err := ctrl.ListDeadLetters(ctx)
+	if err != nil || len(dls) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %v, %v", dls, err)
+	}
+	sent := len(sms.Sent())
+	if err := ctrl.ReplayDeadLetter(ctx, dls[0].ID); err != nil {
+		t.Fatalf("Error replaying dead letter: %v", err)
+	}
+	if err := ctrl.ReplayDeadLetter(ctx, dls[0].ID); err != repository.ErrNotFound {
+		t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+	if got := sms.Sent(); len(got) != sent+1 || got[sent].Msg.ID != dls[0].Msg.ID {
+		t.Errorf("Expected the dead letter to be delivered again, got %v", got[sent:])
+	}
+	if dls, _ := ctrl.ListDeadLetters(ctx); len(dls) != 1 {
+		t.Errorf("Expected 1 dead letter left, got %v", dls)
+	}
+}
+
+func TestRetriesDontHoldWorkers(t *testing.T) {
+	users := fakeUsers{"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+		{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+	}}}
+	ctx := context.Background()
+	repo := memory.New()
+	sms := fake.New(usermodel.ChannelSMS)
+	sms.Results = []*model.DeliveryResult{model.FailedDelivery(errors.New("provider unavailable"), true)}
+	ctrl := New(repo, users)
+	ctrl.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 1, Timeout: time.Second, Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}})
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob"})
+
+	// Test the only worker delivers the next message while the first one waits for its retry
+	for i := 0; i < 2; i++ {
+		if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+			t.Fatalf("Error posting notification: %v", err)
+		}
+	}
+	for deadline := time.Now().Add(time.Second); len(sms.Sent()) < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected both messages to be tried, got %v", sms.Sent())
+		}
+	}
+
+	// Test shutdown waits for the retry and abandons it when it gives up
+	expired, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := ctrl.Shutdown(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	deliveries, err := repo.ListChatDeliveries(ctx, chatID)
+	if err != nil {
+		t.Fatalf("Error listing deliveries: %v", err)
+	}
+	statuses := map[model.DeliveryStatus]int{}
+	for _, d := range deliveries {
+		statuses[d.Status]++
+	}
+	if statuses[model.DeliverySent] != 1 || statuses[model.DeliveryFailed] != 1 {
+		t.Errorf("Expected one sent and one abandoned delivery, got %v", deliveries)
+	}
+}
+
+func TestRedelivery(t *testing.T) {
+	users := fakeUsers{
+		"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+			{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+			{ID: "r2", Channel: usermodel.ChannelSMS, Address: "+14155550124", Verified: true},
+		}},
+		"carol": {ID: "carol", Receivers: []*usermodel.Receiver{
+			{ID: "r3", Channel: usermodel.ChannelSMS, Address: "+14155550125", Verified: true},
+		}},
+	}
+	ctx := context.Background()
+	repo := memory.New()
+	sms := fake.New(usermodel.ChannelSMS)
+	sms.Hold = make(chan struct{})
+	ctrl := New(repo, users)
+	ctrl.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 1, Timeout: time.Minute})
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob", "carol"})
+
+	// Test posting fails partway through once the held worker and the queue are taken by bob's receivers
+	full, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := ctrl.Post(full, "m1", "alice", chatID, "Wuphf"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	close(sms.Hold)
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+
+	// Test the redelivered message only delivers to the receiver it didn't get to, without duplicating notifications
+	redelivered := fake.New(usermodel.ChannelSMS)
+	ctrl = New(repo, users)
+	ctrl.AddIntegration(redelivered)
+	if _, err := ctrl.Post(ctx, "m1", "alice", chatID, "Wuphf"); err != nil {
+		t.Fatalf("Error posting notification: %v", err)
+	}
+	to := model.Recipient{UserID: "bob", Channel: usermodel.ChannelSMS, Address: "+14155550123"}
+	for i := 0; i < 2; i++ {
+		if err := ctrl.Send(ctx, "a1", to, model.Envelope{Type: "password_reset", Body: "123456"}); err != nil {
+			t.Fatalf("Error sending: %v", err)
+		}
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+	if got := sms.Sent(); len(got) != 2 {
+		t.Errorf("Expected bob's receivers to be delivered to, got %v", got)
+	}
+	if got := redelivered.Sent(); len(got) != 2 || got[0].To.Address != "+14155550125" || got[1].Msg.Type != "password_reset" {
+		t.Errorf("Expected carol's receiver and the account message to be delivered to once, got %v", got)
+	}
+	if n, err := ctrl.List(ctx, chatID); err != nil || len(n) != 3 {
+		t.Errorf("Expected 3 notifications, got %v, %v", n, err)
+	}
+}
+
+func TestResumeDeliveries(t *testing.T) {
+	users := fakeUsers{"bob": {ID: "bob", Receivers: []*usermodel.Receiver{
+		{ID: "r1", Channel: usermodel.ChannelSMS, Address: "+14155550123", Verified: true},
+	}}}
+	ctx := context.Background()
+	repo := memory.New()
+	sms := fake.New(usermodel.ChannelSMS)
+	sms.Result = model.FailedDelivery(errors.New("provider unavailable"), true)
+	crashed := New(repo, users)
+	crashed.AddIntegrationWithLimits(sms, Limits{Workers: 1, Queue: 1, Timeout: time.Second, Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}})
+	t.Cleanup(func() {
+		expired, cancel := context.WithTimeout(ctx, time.Millisecond)
+		defer cancel()
+		crashed.Shutdown(expired)
+	})
+	chatID := crashed.PostChat(ctx, "alice", []string{"bob"})
+
+	// Test deliveries waiting for a retry are recorded as retrying
+	if _, err := crashed.Post(ctx, "m1", "alice", chatID, "Wuphf"); err != nil {
+		t.Fatalf("Error posting notification: %v", err)
+	}
+	var retrying []*model.Delivery
+	for deadline := time.Now().Add(time.Second); len(retrying) == 0 || retrying[0].Status != model.DeliveryRetrying; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the delivery to be retrying, got %v", retrying)
+		}
+		retrying, _ = repo.ListPendingDeliveries(ctx)
+	}
+	if d := retrying[0]; d.Attempts != 1 || d.To.Address != "+14155550123" || d.Msg.Body != "Wuphf" {
+		t.Errorf("Unexpected delivery: %v", d)
+	}
+
+	// Test queued and retrying deliveries are resumed, unlike those queued by the provider
+	account := model.NewDelivery("a1", usermodel.ChannelSMS, sms.Name(), "")
+	account.To = model.Recipient{UserID: "bob", Channel: usermodel.ChannelSMS, Address: "+14155550123"}
+	account.Msg = model.Envelope{Type: "password_reset", Body: "123456"}
+	provider := model.NewDelivery("a2", usermodel.ChannelSMS, sms.Name(), "")
+	provider.ProviderID = "SM1"
+	for _, d := range []*model.Delivery{account, provider} {
+		if err := repo.PutDelivery(ctx, d); err != nil {
+			t.Fatalf("Error storing delivery: %v", err)
+		}
+	}
+	resumed := fake.New(usermodel.ChannelSMS)
+	ctrl := New(repo, users)
+	ctrl.AddIntegration(resumed)
+	if n, err := ctrl.ResumeDeliveries(ctx); err != nil || n != 2 {
+		t.Fatalf("Expected 2 resumed deliveries, got %d, %v", n, err)
+	}
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error draining deliveries: %v", err)
+	}
+	if got := resumed.Sent(); len(got) != 2 {
+		t.Errorf("Expected 2 deliveries, got %v", got)
+	}
+	if pending, err := repo.ListPendingDeliveries(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending deliveries, got %v, %v", pending, err)
+	}
+	deliveries, err := repo.ListDeliveries(ctx, retrying[0].NotificationID)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != model.DeliverySent {
+		t.Errorf("Expected the resumed delivery to be sent, got %v, %v", deliveries, err)
+	}
+}
+
+func TestPushSubscriptions(t *testing.T) {
+	users := fakeUsers{"alice": {ID: "alice", Email: "alice@example.com"}, "bob": {ID: "bob", Email: "bob@example.com"}}
+	push := fake.New(usermodel.ChannelPush)
+	repo := memory.New()
+	ctrl := New(repo, users)
+	ctrl.AddIntegration(push)
+	ctx := context.Background()
+
+	// Test tokens are validated through the user service
+	user, err := ctrl.ValidateToken(ctx, "token-bob")
+	if err != nil || user.ID != "bob" {
+		t.Fatalf("Expected bob, got %v, %v", user, err)
+	}
+	if _, err := ctrl.ValidateToken(ctx, "invalid"); err != repository.ErrInvalidToken {
+		t.Errorf("Expected %v, got %v", repository.ErrInvalidToken, err)
+	}
+
+	var sub usermodel.PushSubscription
+	sub.Endpoint = "http://push.example.com/send/abc"
+	if _, err := ctrl.Subscribe(ctx, "bob", sub); !errors.Is(err, repository.ErrInvalidSubscription) {
+		t.Errorf("Expected %v, got %v", repository.ErrInvalidSubscription, err)
+	}
+	sub.Endpoint = "https://push.example.com/send/abc"
+	sub.Keys.P256dh = "test_p256dh"
+	sub.Keys.Auth = "test_auth"
+	s, err := ctrl.Subscribe(ctx, "bob", sub)
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+
+	// Test messages are pushed to the subscription
+	chatID := ctrl.PostChat(ctx, "alice", []string{"bob"})
+	post := func() {
+		t.Helper()
+		if _, err := ctrl.Post(ctx, "", "alice", chatID, "Wuphf"); err != nil {
+			t.Fatalf("Error posting notification: %v", err)
+		}
+		// Wait for the deliveries and continue with a fresh controller
+		if err := ctrl.Shutdown(ctx); err != nil {
+			t.Fatalf("Error draining deliveries: %v", err)
+		}
+		ctrl = New(repo, users)
+		ctrl.AddIntegration(push)
+	}
+	post()
+	if sent := push.Sent(); len(sent) != 1 || sent[0].To.Address != s.Address() {
+		t.Fatalf("Expected a push to the subscription, got %v", sent)
+	}
+
+	// Test subscriptions the push service reports as gone are pruned
+	push.Result = &model.DeliveryResult{Status: model.DeliveryGone}
+	post()
+	push.Result = nil
+	post()
+	if sent := push.Sent(); len(sent) != 2 {
+		t.Errorf("Expected no push after pruning, got %v", sent)
+	}
+	if err := ctrl.Unsubscribe(ctx, "bob", sub.Endpoint); err != repository.ErrNotFound {
+		t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	ctrl := New(repo, fakeUsers{})
+	ctrl.SetIdempotencyWindow(time.Hour)
+	runs := 0
+	do := func(context.Context) (string, error) {
+		runs++
+		return "result-" + strings.Repeat("i", runs), nil
+	}
+
+	// Test replays within the window get the original result without running again
+	res, ran, err := ctrl.Idempotent(ctx, "alice", "k1", do)
+	if err != nil || !ran || res != "result-i" {
+		t.Fatalf("Expected the request to run, got %s, %v, %v", res, ran, err)
+	}
+	res, ran, err = ctrl.Idempotent(ctx, "alice", "k1", do)
+	if err != nil || ran || res != "result-i" || runs != 1 {
+		t.Errorf("Expected the original result, got %s, %v, %v after %d runs", res, ran, err, runs)
+	}
+
+	// Test keys are scoped to the sender, and requests without a key always run
+	if _, ran, err := ctrl.Idempotent(ctx, "bob", "k1", do); err != nil || !ran {
+		t.Errorf("Expected bob's request to run, got %v, %v", ran, err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ran, err := ctrl.Idempotent(ctx, "alice", "", do); err != nil || !ran {
+			t.Errorf("Expected the request without a key to run, got %v, %v", ran, err)
+		}
+	}
+
+	// Test failed requests aren't remembered
+	failure := errors.New("failed")
+	if _, _, err := ctrl.Idempotent(ctx, "alice", "k2", func(context.Context) (string, error) { return "", failure }); err != failure {
+		t.Errorf("Expected %v, got %v", failure, err)
+	}
+	if _, ran, err := ctrl.Idempotent(ctx, "alice", "k2", do); err != nil || !ran {
+		t.Errorf("Expected the failed request to run again, got %v, %v", ran, err)
+	}
+
+	// Test a concurrent delivery of a request in progress doesn't run it again, and gets the original
+	// result once the request completes
+	started, finish := make(chan struct{}), make(chan struct{})
+	go ctrl.Idempotent(ctx, "alice", "k4", func(context.Context) (string, error) {
+		close(started)
+		<-finish
+		return "original", nil
+	})
+	<-started
+	if _, ran, err := ctrl.Idempotent(ctx, "alice", "k4", do); err != ErrIdempotencyKeyInUse || ran {
+		t.Errorf("Expected %v, got %v, %v", ErrIdempotencyKeyInUse, ran, err)
+	}
+	close(finish)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		res, ran, err := ctrl.Idempotent(ctx, "alice", "k4", do)
+		if err == ErrIdempotencyKeyInUse && time.Now().Before(deadline) {
+			continue
+		}
+		if err != nil || ran || res != "original" {
+			t.Errorf("Expected the original result, got %s, %v, %v", res, ran, err)
+		}
+		break
+	}
+
+	// Test keys abandoned by a request that never completed are taken over
+	abandoned := &model.IdempotencyRecord{Sender: "alice", Key: "k5", CreatedAt: time.Now().Add(-2 * idempotencyLease)}
+	if _, err := repo.ReserveIdempotencyKey(ctx, abandoned, abandoned.CreatedAt, abandoned.CreatedAt); err != nil {
+		t.Fatalf("Error reserving key: %v", err)
+	}
+	if _, ran, err := ctrl.Idempotent(ctx, "alice", "k5", do); err != nil || !ran {
+		t.Errorf("Expected the abandoned key to run again, got %v, %v", ran, err)
+	}
+
+	// Test keys are forgotten once they fall out of the window
+	store := func(key string) {
+		old := &model.IdempotencyRecord{Sender: "alice", Key: key, CreatedAt: time.Now().Add(-2 * time.Hour)}
+		if _, err := repo.ReserveIdempotencyKey(ctx, old, old.CreatedAt, old.CreatedAt); err != nil {
+			t.Fatalf("Error reserving key: %v", err)
+		}
+		if err := repo.CompleteIdempotencyRecord(ctx, "alice", key, "old"); err != nil {
+			t.Fatalf("Error completing record: %v", err)
+		}
+	}
+	store("k3")
+	if res, ran, err := ctrl.Idempotent(ctx, "alice", "k3", do); err != nil || !ran || res == "old" {
+		t.Errorf("Expected the expired key to run again, got %s, %v, %v", res, ran, err)
+	}
+	store("k6")
+	if err := ctrl.PruneIdempotencyRecords(ctx); err != nil {
+		t.Fatalf("Error pruning records: %v", err)
+	}
+	if _, err := repo.GetIdempotencyRecord(ctx, "alice", "k6"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+	}
+	if _, err := repo.GetIdempotencyRecord(ctx, "alice", "k1"); err != nil {
+		t.Errorf("Error retrieving record: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+type deadLetterPublisher interface {
+	// PublishDeadLetter hands a dead letter to whoever monitors failed deliveries, e.g. a Kafka topic
+	PublishDeadLetter(ctx context.Context, dl *model.DeadLetter) error
+}
+
+// SetDeadLetterPublisher publishes deliveries that failed for good in addition to keeping them for replay,
+// it must be called before any integration is added
+func (c *Controller) SetDeadLetterPublisher(p deadLetterPublisher) {
+	c.deadLetters = p
+}
+
+// ListDeadLetters returns the deliveries that failed for good, oldest first
+func (c *Controller) ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	return c.repo.ListDeadLetters(ctx)
+}
+
+// ReplayDeadLetter queues the dead letter's delivery again, with a fresh set of attempts
+func (c *Controller) ReplayDeadLetter(ctx context.Context, id string) error {
+	dl, err := c.repo.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	p := c.dispatcher.integration(dl.Integration)
+	if p == nil {
+		return fmt.Errorf("%w: integration %q", repository.ErrNotFound, dl.Integration)
+	}
+	j := job{notificationID: dl.NotificationID, receiverID: dl.ReceiverID, to: c.withSecret(ctx, dl.To), msg: dl.Msg}
+	if err := c.enqueue(ctx, p, j); err != nil {
+		return err
+	}
+	return c.repo.DeleteDeadLetter(ctx, id)
+}
+
+// enqueue records a notification's delivery as queued, so it's resumed after a restart, and hands it to
+// the integration's workers
+func (c *Controller) enqueue(ctx context.Context, p *pool, j job) error {
+	if j.notificationID == "" {
+		return c.dispatcher.enqueue(ctx, p, j)
+	}
+	d := pendingDelivery(j, p.integration.Name())
+	if err := c.repo.PutDelivery(ctx, d); err != nil {
+		return err
+	}
+	err := c.dispatcher.enqueue(ctx, p, j)
+	if err != nil {
+		d.Update(model.FailedDelivery(err, true))
+		if err := c.repo.PutDelivery(context.WithoutCancel(ctx), d); err != nil {
+			log.Printf("Error recording delivery: %v\n", err)
+		}
+	}
+	return err
+}
+
+// recordDelivery records the result on its notification, prunes push subscriptions that are gone
+// and dead-letters deliveries that failed for good
+func (c *Controller) recordDelivery(j job, res *model.DeliveryResult) {
+	ctx := context.Background()
+	if j.notificationID != "" {
+		d := model.NewDelivery(j.notificationID, j.to.Channel, res.Integration, j.receiverID)
+		d.Update(res)
+		if err := c.repo.PutDelivery(ctx, d); err != nil {
+			log.Printf("Error recording delivery: %v\n", err)
+		}
+	}
+	switch res.Status {
+	case model.DeliveryGone:
+		if j.pushSubscription {
+			if err := c.repo.DeletePushSubscription(ctx, j.receiverID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+				log.Printf("Error pruning push subscription: %v\n", err)
+			}
+		}
+	case model.DeliveryFailed:
+		log.Printf("Error delivering through %s after %d attempts: %s\n", res.Integration, res.Attempts, res.Error)
+		c.deadLetter(ctx, j, res)
+	}
+}
+
+// deadLetter keeps the failed delivery for replay and publishes it
+func (c *Controller) deadLetter(ctx context.Context, j job, res *model.DeliveryResult) {
+	dl, err := model.NewDeadLetter(j.notificationID, res.Integration, j.receiverID, j.to, j.msg, j.attempts)
+	if err != nil {
+		log.Printf("Error creating dead letter: %v\n", err)
+		return
+	}
+	if err := c.repo.PostDeadLetter(ctx, dl); err != nil {
+		log.Printf("Error storing dead letter: %v\n", err)
+	}
+	if c.deadLetters != nil {
+		if err := c.deadLetters.PublishDeadLetter(ctx, dl); err != nil {
+			log.Printf("Error publishing dead letter: %v\n", err)
+		}
+	}
+}
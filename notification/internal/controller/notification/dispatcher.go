@@ -0,0 +1,227 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// ErrShuttingDown is returned when deliveries are enqueued after Shutdown was called
+var ErrShuttingDown = errors.New("notification controller is shutting down")
+
+// Limits bound how an integration's deliveries are performed
+type Limits struct {
+	// Workers is how many deliveries run concurrently
+	Workers int
+	// Queue is how many deliveries may wait for a worker before enqueueing blocks
+	Queue int
+	// Timeout is how long a single delivery attempt may take
+	Timeout time.Duration
+	// Retry is how failed deliveries are retried, DefaultRetryPolicy when MaxAttempts isn't set
+	Retry RetryPolicy
+}
+
+// DefaultLimits are used for integrations added without limits
+var DefaultLimits = Limits{Workers: 4, Queue: 100, Timeout: 15 * time.Second, Retry: DefaultRetryPolicy}
+
+// job is a message to deliver to one recipient address through one integration
+type job struct {
+	// notificationID is the notification, or account message, the result is recorded on. It's empty for
+	// account messages without an id, whose results aren't recorded.
+	notificationID string
+	receiverID     string
+	// pushSubscription is set when the receiver is one of our push subscriptions, which are pruned when gone
+	pushSubscription bool
+	to               model.Recipient
+	msg              model.Envelope
+	// attempts holds the result of every attempt so far, oldest first
+	attempts []*model.DeliveryResult
+}
+
+// pool is the bounded set of workers delivering through one integration
+type pool struct {
+	integration notificationIntegration
+	limits      Limits
+	jobs        chan job
+}
+
+// dispatcher runs a worker pool per integration
+type dispatcher struct {
+	mu      sync.RWMutex
+	closed  bool
+	pools   []*pool
+	workers sync.WaitGroup
+	// pending counts the jobs that haven't finished, including those waiting to be retried
+	pending sync.WaitGroup
+	// stop closes the queues once every pending job finished
+	stop sync.Once
+	// ctx is cancelled when shutdown gives up on draining, aborting in-flight deliveries
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is called with the result of every delivery
+	done func(job, *model.DeliveryResult)
+	// retrying is called with the result of every attempt that will be retried
+	retrying func(job, *model.DeliveryResult)
+}
+
+func newDispatcher(done, retrying func(job, *model.DeliveryResult)) *dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &dispatcher{ctx: ctx, cancel: cancel, done: done, retrying: retrying}
+}
+
+// add starts the workers of an integration
+func (d *dispatcher) add(i notificationIntegration, limits Limits) {
+	if limits.Workers <= 0 {
+		limits.Workers = DefaultLimits.Workers
+	}
+	if limits.Queue < 0 {
+		limits.Queue = DefaultLimits.Queue
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = DefaultLimits.Timeout
+	}
+	if limits.Retry.MaxAttempts <= 0 {
+		limits.Retry = DefaultRetryPolicy
+	}
+	p := &pool{integration: i, limits: limits, jobs: make(chan job, limits.Queue)}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pools = append(d.pools, p)
+	for w := 0; w < limits.Workers; w++ {
+		d.workers.Add(1)
+		go d.work(p)
+	}
+}
+
+// channel returns the pools of the integrations delivering to the channel
+func (d *dispatcher) channel(channel string) []*pool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var res []*pool
+	for _, p := range d.pools {
+		if p.integration.Channel() == channel {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// integration returns the pool of the integration with the given name
+func (d *dispatcher) integration(name string) *pool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pools {
+		if p.integration.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// enqueue hands the job to the pool's workers, blocking while its queue is full
+func (d *dispatcher) enqueue(ctx context.Context, p *pool, j job) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrShuttingDown
+	}
+	d.pending.Add(1)
+	select {
+	case p.jobs <- j:
+		return nil
+	case <-ctx.Done():
+		d.pending.Done()
+		return ctx.Err()
+	}
+}
+
+func (d *dispatcher) work(p *pool) {
+	defer d.workers.Done()
+	for j := range p.jobs {
+		d.deliver(p, j)
+	}
+}
+
+// deliver makes an attempt at the job and finishes it unless it failed in a way that may succeed later,
+// in which case it's retried while attempts are left. Retries are abandoned when shutdown gives up on draining.
+func (d *dispatcher) deliver(p *pool, j job) {
+	ctx, cancel := context.WithTimeout(d.ctx, p.limits.Timeout)
+	res := p.integration.Notify(ctx, j.to, j.msg)
+	cancel()
+	if res == nil {
+		res = model.FailedDelivery(errors.New("integration returned no result"), false)
+	}
+	res.Integration = p.integration.Name()
+	res.ReceiverID = j.receiverID
+	j.attempts = append(j.attempts, res)
+	res.Attempts = len(j.attempts)
+
+	if res.Status != model.DeliveryFailed || !res.Retryable || len(j.attempts) >= p.limits.Retry.MaxAttempts || d.ctx.Err() != nil {
+		d.finish(j, res)
+		return
+	}
+	d.retrying(j, res)
+	d.retry(p, j, res)
+}
+
+// retry hands the job back to the pool's workers once its backoff passed, so no worker is held while it
+// waits. res is reported as the job's result if shutdown gives up on draining first.
+func (d *dispatcher) retry(p *pool, j job, res *model.DeliveryResult) {
+	timer := time.NewTimer(p.limits.Retry.backoff(len(j.attempts)))
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			d.finish(j, res)
+			return
+		}
+		// The queues are only closed once every pending job finished, so this job keeps them open
+		select {
+		case p.jobs <- j:
+		case <-d.ctx.Done():
+			d.finish(j, res)
+		}
+	}()
+}
+
+// finish reports the final result of the job
+func (d *dispatcher) finish(j job, res *model.DeliveryResult) {
+	defer d.pending.Done()
+	d.done(j, res)
+}
+
+// shutdown stops accepting jobs and waits for the queued, in-flight and retrying ones to finish.
+// When ctx is done first the remaining deliveries are cancelled.
+func (d *dispatcher) shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		// Retries are queued again, so the queues stay open until no job is pending
+		d.pending.Wait()
+		d.stop.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			for _, p := range d.pools {
+				close(p.jobs)
+			}
+		})
+		d.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-drained
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,70 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// DefaultIdempotencyWindow is how long idempotency keys are remembered unless configured otherwise
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// SetIdempotencyWindow sets how long replays of a request are recognized by its idempotency key
+func (c *Controller) SetIdempotencyWindow(window time.Duration) {
+	c.idempotencyWindow = window
+}
+
+// idempotencyLease is how long a request may hold its idempotency key without completing, after that
+// it's considered abandoned, e.g. by a consumer that crashed, and a replay may take the key over
+const idempotencyLease = time.Minute
+
+// ErrIdempotencyKeyInUse is returned while another request with the same idempotency key is in progress
+var ErrIdempotencyKeyInUse = errors.New("a request with the idempotency key is in progress")
+
+// Idempotent runs do unless the sender made a request with the same idempotency key within the
+// idempotency window, in which case the result of the original request is returned instead. Requests
+// without a key always run. It reports whether do ran.
+//
+// The key is reserved before do runs, so concurrent deliveries of the same request don't both run it,
+// the one that loses gets ErrIdempotencyKeyInUse until the original request completes.
+func (c *Controller) Idempotent(ctx context.Context, sender, key string, do func(ctx context.Context) (string, error)) (string, bool, error) {
+	if key == "" {
+		res, err := do(ctx)
+		return res, true, err
+	}
+	now := time.Now()
+	rec := &model.IdempotencyRecord{Sender: sender, Key: key, CreatedAt: now}
+	reserved, err := c.repo.ReserveIdempotencyKey(ctx, rec, now.Add(-c.idempotencyWindow), now.Add(-idempotencyLease))
+	if err != nil {
+		return "", false, err
+	}
+	if !reserved {
+		rec, err := c.repo.GetIdempotencyRecord(ctx, sender, key)
+		if errors.Is(err, repository.ErrNotFound) || err == nil && rec.Result == "" {
+			// The request holding the key is still in progress, or just failed and released it
+			return "", false, ErrIdempotencyKeyInUse
+		} else if err != nil {
+			return "", false, err
+		}
+		return rec.Result, false, nil
+	}
+
+	res, err := do(ctx)
+	if err != nil {
+		// Failed requests aren't remembered, release the key so the request can be retried
+		if err := c.repo.ReleaseIdempotencyKey(ctx, sender, key); err != nil {
+			log.Printf("Error releasing idempotency key %q of %s: %v\n", key, sender, err)
+		}
+		return "", true, err
+	}
+	return res, true, c.repo.CompleteIdempotencyRecord(ctx, sender, key, res)
+}
+
+// PruneIdempotencyRecords forgets the idempotency keys that fell out of the idempotency window
+func (c *Controller) PruneIdempotencyRecords(ctx context.Context) error {
+	return c.repo.DeleteIdempotencyRecords(ctx, time.Now().Add(-c.idempotencyWindow))
+}
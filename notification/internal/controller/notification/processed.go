@@ -0,0 +1,17 @@
+package notification
+
+import "context"
+
+// ProcessOnce runs process unless the message with the given id was processed before, and records the
+// message as processed once process succeeds. Messages are redelivered until they are processed, e.g.
+// after a crash, so this keeps redeliveries from being processed twice. It reports whether process ran.
+func (c *Controller) ProcessOnce(ctx context.Context, messageID string, process func(ctx context.Context) error) (bool, error) {
+	processed, err := c.repo.IsProcessed(ctx, messageID)
+	if err != nil || processed {
+		return false, err
+	}
+	if err := process(ctx); err != nil {
+		return true, err
+	}
+	return true, c.repo.MarkProcessed(ctx, messageID)
+}
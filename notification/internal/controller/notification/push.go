@@ -0,0 +1,41 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/client"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// ValidateToken returns the user an access token was issued to
+func (c *Controller) ValidateToken(ctx context.Context, token string) (*usermodel.User, error) {
+	if c.users == nil {
+		return nil, repository.ErrInvalidToken
+	}
+	user, err := c.users.ValidateToken(ctx, token)
+	if errors.Is(err, client.ErrInvalidToken) {
+		return nil, repository.ErrInvalidToken
+	}
+	return user, err
+}
+
+// Subscribe registers a browser's push subscription for the user
+func (c *Controller) Subscribe(ctx context.Context, userID string, sub usermodel.PushSubscription) (*model.PushSubscription, error) {
+	s, err := model.NewPushSubscription(userID, sub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", repository.ErrInvalidSubscription, err)
+	}
+	if err := c.repo.PostPushSubscription(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Unsubscribe removes the user's push subscription for the endpoint
+func (c *Controller) Unsubscribe(ctx context.Context, userID, endpoint string) error {
+	return c.repo.DeletePushSubscriptionByEndpoint(ctx, userID, endpoint)
+}
@@ -0,0 +1,79 @@
+package notification
+
+import (
+	"context"
+	"log"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// ResumeDeliveries queues the deliveries that were queued or retrying when the service stopped. Their
+// messages were committed once the deliveries were recorded, so they'd be lost along with the in-memory
+// queues otherwise. Resumed deliveries start over with a fresh set of attempts. It must be called after
+// the integrations are added and before messages are consumed, and returns how many were resumed.
+func (c *Controller) ResumeDeliveries(ctx context.Context) (int, error) {
+	deliveries, err := c.repo.ListPendingDeliveries(ctx)
+	if err != nil {
+		return 0, err
+	}
+	resumed := 0
+	for _, d := range deliveries {
+		p := c.dispatcher.integration(d.Integration)
+		if p == nil || d.To.Address == "" {
+			log.Printf("Error resuming delivery of %s through %s: integration or recipient missing\n", d.NotificationID, d.Integration)
+			continue
+		}
+		j := job{notificationID: d.NotificationID, receiverID: d.ReceiverID, to: c.withSecret(ctx, d.To), msg: d.Msg}
+		if err := c.dispatcher.enqueue(ctx, p, j); err != nil {
+			return resumed, err
+		}
+		resumed++
+	}
+	return resumed, nil
+}
+
+// delivered returns the deliveries recorded under the notification or account message with the given id
+// by deliveryKey, so redelivered messages skip the receivers they were queued for already. Deliveries that
+// failed to be queued were never attempted and are left out.
+func (c *Controller) delivered(ctx context.Context, id string) (map[string]bool, error) {
+	res := map[string]bool{}
+	if id == "" {
+		return res, nil
+	}
+	deliveries, err := c.repo.ListDeliveries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deliveries {
+		if d.Status == model.DeliveryFailed && d.Attempts == 0 {
+			continue
+		}
+		res[deliveryKey(d.Integration, d.ReceiverID)] = true
+	}
+	return res, nil
+}
+
+func deliveryKey(integration, receiverID string) string {
+	return integration + "/" + receiverID
+}
+
+// pendingDelivery creates the queued delivery of the job through the integration, keeping its recipient
+// and message to resume it after a restart
+func pendingDelivery(j job, integration string) *model.Delivery {
+	d := model.NewDelivery(j.notificationID, j.to.Channel, integration, j.receiverID)
+	d.To, d.Msg = j.to, j.msg
+	return d
+}
+
+// recordRetry records the delivery as retrying after an attempt failed
+func (c *Controller) recordRetry(j job, res *model.DeliveryResult) {
+	if j.notificationID == "" {
+		return
+	}
+	d := pendingDelivery(j, res.Integration)
+	d.Update(res)
+	d.Status = model.DeliveryRetrying
+	if err := c.repo.PutDelivery(context.Background(), d); err != nil {
+		log.Printf("Error recording delivery: %v\n", err)
+	}
+}
@@ -0,0 +1,33 @@
+package notification
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy defines how failed deliveries are retried. Only failures the integration reports as
+// retryable are tried again, permanent failures are dead-lettered right away.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a delivery is tried in total, 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling with every further retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used for integrations added without a retry policy
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+// backoff returns the delay before retrying after the given number of attempts. The delay grows
+// exponentially and is jittered into its upper half so retries of a failed batch spread out.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.MaxDelay
+	if shift := attempts - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		d = p.BaseDelay << shift
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
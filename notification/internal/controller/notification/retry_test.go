@@ -0,0 +1,29 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for _, tc := range []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		// Test the delay is capped
+		{5, 10 * time.Second},
+		{64, 10 * time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			// Test the jitter keeps delays within the upper half
+			if d := p.backoff(tc.attempts); d < tc.max/2 || d > tc.max {
+				t.Fatalf("Expected a delay between %v and %v after %d attempts, got %v", tc.max/2, tc.max, tc.attempts, d)
+			}
+		}
+	}
+}
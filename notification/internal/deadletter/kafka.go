@@ -0,0 +1,41 @@
+// Package deadletter publishes deliveries that failed for good to Kafka
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/IBM/sarama"
+)
+
+// Topic is the Kafka topic dead letters are published to
+const Topic = "notifications.dlq"
+
+// KafkaPublisher publishes dead letters as JSON, keyed by dead letter id
+type KafkaPublisher struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewKafkaPublisher creates a publisher producing to the topic
+func NewKafkaPublisher(producer sarama.SyncProducer, topic string) *KafkaPublisher {
+	return &KafkaPublisher{producer, topic}
+}
+
+// PublishDeadLetter publishes the dead letter with its original payload and the result of every attempt
+func (p *KafkaPublisher) PublishDeadLetter(_ context.Context, dl *model.DeadLetter) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(dl.ID),
+		Value: sarama.ByteEncoder(b),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("integration"), Value: []byte(dl.Integration)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,45 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestPublishDeadLetter(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	p := NewKafkaPublisher(producer, Topic)
+
+	attempts := []*model.DeliveryResult{model.FailedDelivery(errors.New("provider unavailable"), true)}
+	dl, err := model.NewDeadLetter("n1", "fake sms", "r1", model.Recipient{UserID: "bob", Channel: "sms", Address: "+14155550123"}, model.Envelope{ID: "n1", Body: "Wuphf"}, attempts)
+	if err != nil {
+		t.Fatalf("Error creating dead letter: %v", err)
+	}
+
+	// Test the dead letter is published with its payload and attempts
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(b []byte) error {
+		var got model.DeadLetter
+		if err := json.Unmarshal(b, &got); err != nil {
+			return err
+		}
+		if got.ID != dl.ID || got.To != dl.To || got.Msg.Body != "Wuphf" || len(got.Attempts) != 1 || got.Attempts[0].Error != "provider unavailable" {
+			return errors.New("unexpected dead letter " + string(b))
+		}
+		return nil
+	})
+	if err := p.PublishDeadLetter(context.Background(), dl); err != nil {
+		t.Errorf("Error publishing dead letter: %v", err)
+	}
+
+	// Test produce errors are reported
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	if err := p.PublishDeadLetter(context.Background(), dl); !errors.Is(err, sarama.ErrOutOfBrokers) {
+		t.Errorf("Expected %v, got %v", sarama.ErrOutOfBrokers, err)
+	}
+}
@@ -1,25 +1,36 @@
 package http
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"github.com/Azanul/wuphf-dot-com/notification/internal/controller/notification"
+	twiliosms "github.com/Azanul/wuphf-dot-com/notification/internal/integration/twilio-sms"
 	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
 )
 
 // Handler defines a notification HTTP handler
 type Handler struct {
 	ctrl *notification.Controller
+	// vapidPublicKey is the key browsers subscribe to Web Push with
+	vapidPublicKey string
+	// adminToken is the bearer token admin requests must carry, admin endpoints are disabled when empty
+	adminToken string
+	// twilioCallbacks validates Twilio status callbacks
+	twilioCallbacks *twiliosms.StatusCallbacks
 }
 
 // New creates a new notification HTTP handler
-func New(ctrl *notification.Controller) *Handler {
-	return &Handler{ctrl}
+func New(ctrl *notification.Controller, vapidPublicKey, adminToken string, twilioCallbacks *twiliosms.StatusCallbacks) *Handler {
+	return &Handler{ctrl, vapidPublicKey, adminToken, twilioCallbacks}
 }
 
 // Notify handles POST and GET /notification requests
@@ -39,7 +50,7 @@ func (h *Handler) Notification(w http.ResponseWriter, req *http.Request) {
 		sender := req.FormValue("sender")
 		receiver := req.FormValue("receiver")
 		msg := req.FormValue("msg")
-		if m, err = h.ctrl.Post(ctx, sender, receiver, msg); err == nil {
+		if m, err = h.ctrl.Post(ctx, "", sender, receiver, msg); err == nil {
 			w.WriteHeader(http.StatusCreated)
 		}
 	default:
@@ -61,6 +72,79 @@ func (h *Handler) Notification(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Deliveries handles GET /notification/{id}/deliveries requests
+func (h *Handler) Deliveries(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+
+	ctx := req.Context()
+
+	id, ok := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/notification/"), "/deliveries")
+	switch {
+	case !ok || id == "" || strings.Contains(id, "/"):
+		w.WriteHeader(http.StatusNotFound)
+	case req.Method == http.MethodGet:
+		var user *usermodel.User
+		if user, err = h.ctrl.ValidateToken(ctx, req.Header.Get("Authorization")); err != nil {
+			break
+		}
+		if m, err = h.ctrl.ListDeliveries(ctx, user.ID, id); err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, repository.ErrInvalidToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if errors.Is(err, repository.ErrForbidden) {
+			w.WriteHeader(http.StatusForbidden)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// TwilioStatus handles POST /twilio/status requests, the status callbacks of Twilio SMS messages
+func (h *Handler) TwilioStatus(w http.ResponseWriter, req *http.Request) {
+	var err error
+
+	switch req.Method {
+	case http.MethodPost:
+		var update *twiliosms.StatusUpdate
+		if update, err = h.twilioCallbacks.Parse(req); err != nil {
+			break
+		}
+		if err = h.ctrl.UpdateDeliveryStatus(req.Context(), twiliosms.IntegrationName, update.MessageSID, update.Status, update.Error); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, twiliosms.ErrInvalidSignature) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if errors.Is(err, twiliosms.ErrUnknownStatus) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
 // History handles GET /history requests
 func (h *Handler) History(w http.ResponseWriter, req *http.Request) {
 	var err error
@@ -81,7 +165,7 @@ func (h *Handler) History(w http.ResponseWriter, req *http.Request) {
 			}
 			op := []map[string]any{}
 			for _, n := range m.([]*model.Notification) {
-				op = append(op, map[string]any{"msg": n.Msg, "sender": n.Sender})
+				op = append(op, map[string]any{"id": n.ID, "msg": n.Msg, "sender": n.Sender, "status": n.Status})
 			}
 			m = op
 		}
@@ -104,3 +188,103 @@ func (h *Handler) History(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 }
+
+// Push handles GET /push/key and POST and DELETE /push/subscriptions requests
+func (h *Handler) Push(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+
+	ctx := req.Context()
+
+	switch {
+	case req.URL.Path == "/push/key" && req.Method == http.MethodGet:
+		m = map[string]string{"public_key": h.vapidPublicKey}
+		w.WriteHeader(http.StatusOK)
+	case req.URL.Path == "/push/subscriptions" && (req.Method == http.MethodPost || req.Method == http.MethodDelete):
+		var user *usermodel.User
+		if user, err = h.ctrl.ValidateToken(ctx, req.Header.Get("Authorization")); err != nil {
+			break
+		}
+		var sub usermodel.PushSubscription
+		if err = json.NewDecoder(req.Body).Decode(&sub); err != nil {
+			err = fmt.Errorf("%w: %v", repository.ErrInvalidSubscription, err)
+			break
+		}
+		if req.Method == http.MethodPost {
+			if m, err = h.ctrl.Subscribe(ctx, user.ID, sub); err == nil {
+				w.WriteHeader(http.StatusCreated)
+			}
+		} else if err = h.ctrl.Unsubscribe(ctx, user.ID, sub.Endpoint); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, repository.ErrInvalidToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if errors.Is(err, repository.ErrInvalidSubscription) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// DeadLetters handles GET /admin/dlq and POST /admin/dlq/{id}/replay requests
+func (h *Handler) DeadLetters(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+
+	ctx := req.Context()
+
+	if !h.isAdmin(req) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id, replay := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/admin/dlq/"), "/replay")
+	switch {
+	case req.URL.Path == "/admin/dlq" && req.Method == http.MethodGet:
+		if m, err = h.ctrl.ListDeadLetters(ctx); err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+	case replay && id != "" && !strings.Contains(id, "/") && req.Method == http.MethodPost:
+		if err = h.ctrl.ReplayDeadLetter(ctx, id); err == nil {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, notification.ErrShuttingDown) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// isAdmin checks the request carries the admin token as its bearer token
+func (h *Handler) isAdmin(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && h.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
@@ -2,15 +2,35 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/Azanul/wuphf-dot-com/events"
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
 	"github.com/Azanul/wuphf-dot-com/notification/internal/controller/notification"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
 
 	"github.com/IBM/sarama"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// accountEvents are published by the user service to deliver account messages
+// such as verification links, password reset codes and receiver verification codes
+var accountEvents = map[string]bool{
+	"email_verification":    true,
+	"password_reset":        true,
+	"receiver_verification": true,
+}
+
+// welcomeMessage is the Wuphf new users are greeted with
+const welcomeMessage = "Wuphf"
+
+// errMalformed is returned for messages that can never be processed
+var errMalformed = errors.New("malformed message")
+
 // Handler defines a notification Kafka message handler
 type Handler struct {
 	ctrl *notification.Controller
@@ -23,61 +43,149 @@ func New(ctrl *notification.Controller) *Handler {
 
 func (c Handler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
 func (c Handler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim processes the claim's messages in order and commits each one once it's processed, so
+// messages are redelivered after a crash. A message is processed once its deliveries are recorded as
+// queued, those lost from the in-memory queues in a crash are resumed by the controller on startup.
+// Messages that can never be processed, e.g. malformed ones, are skipped. On any other error consuming
+// stops without committing, to retry the message after rejoining.
 func (c Handler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for msg := range claim.Messages() {
-		sess.MarkMessage(msg, "")
-		sess.Commit()
-		n, err := parseJSON(msg.Value)
-		if err == nil {
-			if _, ok := n["chat_id"]; ok {
-				id, err := c.ctrl.Post(context.TODO(), n["sender"].(string), n["chat_id"].(string), n["msg"].(string))
-				if err != nil {
-					log.Printf("Error creating notification: %v\n", err)
-				} else {
-					log.Printf("Notification created: %s\n", id)
-				}
-			} else {
-				receivers, err := parseReceivers(n["receivers"])
-				if err != nil {
-					log.Printf("Error parsing receivers: %v\n", err)
-					continue
-				}
-
-				id := c.ctrl.PostChat(context.TODO(), n["sender"].(string), receivers)
-				log.Printf("Chat created: %s\n", id)
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
 			}
-		} else {
-			log.Printf("Error unmarshaling message: %v\n", err)
+			if err := c.process(sess.Context(), msg); err != nil {
+				return err
+			}
+			sess.MarkMessage(msg, "")
+			sess.Commit()
+		case <-sess.Context().Done():
+			return nil
 		}
 	}
-	return nil
 }
 
-// parseJSON parses the JSON message and returns a map of values.
-func parseJSON(message []byte) (map[string]interface{}, error) {
-	var result map[string]interface{}
-	err := json.Unmarshal(message, &result)
+// process handles the message unless it was processed before and returns an error only when it
+// should be retried
+func (c Handler) process(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	event, err := decode(msg)
 	if err != nil {
-		return nil, err
+		log.Printf("Error decoding message %s/%d/%d: %v\n", msg.Topic, msg.Partition, msg.Offset, err)
+		return nil
+	}
+	id := messageID(msg, event)
+	processed, err := c.ctrl.ProcessOnce(ctx, id, func(ctx context.Context) error {
+		return c.handle(ctx, msg, event)
+	})
+	if errors.Is(err, errMalformed) || errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Error processing message %s: %v\n", id, err)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("processing message %s: %w", id, err)
+	}
+	if !processed {
+		log.Printf("Skipped message %s, it was processed before\n", id)
 	}
-	return result, nil
+	return nil
 }
 
-func parseReceivers(receivers interface{}) ([]string, error) {
-	var result []string
-	switch v := receivers.(type) {
-	case []interface{}:
-		for _, r := range v {
-			if str, ok := r.(string); ok {
-				result = append(result, str)
-			} else {
-				return nil, fmt.Errorf("invalid receiver type: %v", r)
-			}
+// handle dispatches the event by its type
+func (c Handler) handle(ctx context.Context, msg *sarama.ConsumerMessage, event any) error {
+	switch e := event.(type) {
+	case *eventsv1.AccountMessage:
+		if !accountEvents[e.Type] {
+			return fmt.Errorf("%w: unknown account message %q", errMalformed, e.Type)
+		}
+		channel := e.Channel
+		if channel == "" {
+			channel = "email"
+		}
+		to := model.Recipient{UserID: e.UserId, Channel: channel, Address: e.Receiver}
+		if err := c.ctrl.Send(ctx, eventID(msg, e), to, model.Envelope{Type: e.Type, Body: e.Msg, CreatedAt: createdAt(msg, e.CreatedAt)}); err != nil {
+			return err
+		}
+		log.Printf("Queued %s\n", e.Type)
+	case *eventsv1.MessagePosted:
+		id, posted, err := c.ctrl.Idempotent(ctx, e.Sender, e.IdempotencyKey, func(ctx context.Context) (string, error) {
+			return c.ctrl.Post(ctx, eventID(msg, e), e.Sender, e.ChatId, e.Msg)
+		})
+		if err != nil {
+			return err
+		}
+		if !posted {
+			log.Printf("Skipped replay of notification %s with idempotency key %q\n", id, e.IdempotencyKey)
+			return nil
+		}
+		log.Printf("Notification created: %s\n", id)
+	case *eventsv1.ChatCreated:
+		id, created, err := c.ctrl.Idempotent(ctx, e.Sender, e.IdempotencyKey, func(ctx context.Context) (string, error) {
+			return c.ctrl.PostChat(ctx, e.Sender, e.Receivers), nil
+		})
+		if err != nil {
+			return err
+		}
+		if !created {
+			log.Printf("Skipped replay of chat %s with idempotency key %q\n", id, e.IdempotencyKey)
+			return nil
 		}
-	case string:
-		result = []string{v}
+		log.Printf("Chat created: %s\n", id)
+	case *eventsv1.UserRegistered:
+		id, err := c.ctrl.Post(ctx, eventID(msg, e), e.UserId, "", welcomeMessage)
+		if err != nil {
+			return err
+		}
+		log.Printf("Welcomed user %s: %s\n", e.UserId, id)
 	default:
-		return nil, fmt.Errorf("unexpected type for receivers: %T", v)
+		return fmt.Errorf("%w: unexpected event %T", errMalformed, event)
+	}
+	return nil
+}
+
+// decode decodes the message by the event type and schema version in its headers
+func decode(msg *sarama.ConsumerMessage) (any, error) {
+	var eventType, version string
+	for _, h := range msg.Headers {
+		switch string(h.Key) {
+		case events.TypeHeader:
+			eventType = string(h.Value)
+		case events.VersionHeader:
+			version = string(h.Value)
+		}
+	}
+	return events.Unmarshal(eventType, version, msg.Value)
+}
+
+// messageID returns the id the message is processed once by, the event's id unless it was produced with
+// an idempotency key. Replays of a request with an idempotency key share its id, they're told apart by
+// their position and deduplicated by the key.
+func messageID(msg *sarama.ConsumerMessage, event any) string {
+	if e, ok := event.(interface{ GetIdempotencyKey() string }); ok && e.GetIdempotencyKey() != "" {
+		return position(msg)
+	}
+	return eventID(msg, event)
+}
+
+// eventID returns the id the event was produced with, or its position in the topic for events produced
+// without one, which stays the same when the message is redelivered. What the event creates is keyed by
+// it so redeliveries and replays, e.g. after failing halfway through, create it once.
+func eventID(msg *sarama.ConsumerMessage, event any) string {
+	if e, ok := event.(interface{ GetId() string }); ok && e.GetId() != "" {
+		return e.GetId()
+	}
+	return position(msg)
+}
+
+// position returns where the message is in its topic
+func position(msg *sarama.ConsumerMessage) string {
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// createdAt returns when the event was produced, falling back to the message timestamp
+func createdAt(msg *sarama.ConsumerMessage, t *timestamppb.Timestamp) time.Time {
+	if t.IsValid() {
+		return t.AsTime()
 	}
-	return result, nil
+	return msg.Timestamp
 }
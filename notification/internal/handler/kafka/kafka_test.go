@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/events"
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/controller/notification"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/fake"
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository/memory"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"github.com/IBM/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeSession records the offsets marked and committed through it
+type fakeSession struct {
+	ctx       context.Context
+	marked    []int64
+	committed int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return nil }
+func (s *fakeSession) MemberID() string           { return "member" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.marked = append(s.marked, offset)
+}
+func (s *fakeSession) ResetOffset(_ string, _ int32, _ int64, _ string) {}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+func (s *fakeSession) Commit() {
+	if len(s.marked) > 0 {
+		s.committed = s.marked[len(s.marked)-1]
+	}
+}
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+// fakeClaim hands out the given messages
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func newClaim(messages ...*sarama.ConsumerMessage) *fakeClaim {
+	c := &fakeClaim{make(chan *sarama.ConsumerMessage, len(messages))}
+	for i, m := range messages {
+		msg := *m
+		msg.Topic, msg.Offset = "notifications", int64(i)
+		c.messages <- &msg
+	}
+	close(c.messages)
+	return c
+}
+
+// newMessage returns a message carrying the payload, headed as an event of the given type
+func newMessage(eventType string, payload []byte) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(events.TypeHeader), Value: []byte(eventType)},
+			{Key: []byte(events.VersionHeader), Value: []byte(events.Version)},
+		},
+		Value: payload,
+	}
+}
+
+// newEvent returns a message carrying the event
+func newEvent(t *testing.T, event proto.Message) *sarama.ConsumerMessage {
+	payload, err := events.Marshal(event)
+	if err != nil {
+		t.Fatalf("Error marshaling event: %v", err)
+	}
+	return newMessage(events.Type(event), payload)
+}
+
+func (c *fakeClaim) Topic() string                            { return "notifications" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return int64(len(c.messages)) }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestConsumeClaim(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	ctrl := notification.New(repo, nil)
+	email := fake.New(usermodel.ChannelEmail)
+	ctrl.AddIntegration(email)
+	h := New(ctrl)
+	chat := newEvent(t, &eventsv1.ChatCreated{Sender: "alice", Receivers: []string{"bob"}})
+	incomplete, err := proto.Marshal(&eventsv1.ChatCreated{Sender: "alice"})
+	if err != nil {
+		t.Fatalf("Error marshaling event: %v", err)
+	}
+
+	// Test messages are committed once processed, malformed ones are skipped
+	sess := &fakeSession{ctx: ctx}
+	malformed := []*sarama.ConsumerMessage{
+		{Value: []byte(`{"sender": "alice", "receivers": ["bob"]}`)},
+		newMessage("ChatCreated", []byte(`{"sender": "alice"`)),
+		newMessage("ChatCreated", incomplete),
+		newMessage("ChatDeleted", chat.Value),
+	}
+	if err := h.ConsumeClaim(sess, newClaim(append([]*sarama.ConsumerMessage{chat}, malformed...)...)); err != nil {
+		t.Fatalf("Error consuming: %v", err)
+	}
+	if len(sess.marked) != 5 || sess.committed != 5 {
+		t.Fatalf("Expected 5 messages to be committed, got %v, committed %d", sess.marked, sess.committed)
+	}
+	chats, err := ctrl.ListChats(ctx, "alice")
+	if err != nil || len(chats) != 1 {
+		t.Fatalf("Expected a chat, got %v, %v", chats, err)
+	}
+	post := newEvent(t, &eventsv1.MessagePosted{Id: "m1", Sender: "alice", ChatId: chats[0], Msg: "Wuphf"})
+
+	// Test redelivered messages aren't processed again
+	sess = &fakeSession{ctx: ctx}
+	unknown := newEvent(t, &eventsv1.MessagePosted{Sender: "alice", ChatId: "unknown", Msg: "Wuphf"})
+	if err := h.ConsumeClaim(sess, newClaim(post, post, unknown)); err != nil {
+		t.Fatalf("Error consuming: %v", err)
+	}
+	if sess.committed != 3 {
+		t.Errorf("Expected 3 messages to be committed, got %v, committed %d", sess.marked, sess.committed)
+	}
+	if n, err := ctrl.List(ctx, chats[0]); err != nil || len(n) != 2 {
+		t.Errorf("Expected a notification for alice and bob, got %v, %v", n, err)
+	}
+
+	// Test retried requests with the same idempotency key, which share their id, are posted once
+	retry := newEvent(t, &eventsv1.MessagePosted{Id: "r1", Sender: "alice", ChatId: chats[0], Msg: "Retried", IdempotencyKey: "k1"})
+	retry.Partition = 1
+	sess = &fakeSession{ctx: ctx}
+	if err := h.ConsumeClaim(sess, newClaim(retry, retry)); err != nil {
+		t.Fatalf("Error consuming: %v", err)
+	}
+	if n, err := ctrl.List(ctx, chats[0]); err != nil || len(n) != 4 {
+		t.Errorf("Expected the retried message to be posted once, got %v, %v", n, err)
+	}
+	if processed, _ := repo.IsProcessed(ctx, "r1"); processed {
+		t.Errorf("Expected retries to be deduplicated by their idempotency key rather than their id")
+	}
+
+	// Test registered users are welcomed
+	sess = &fakeSession{ctx: ctx}
+	if err := h.ConsumeClaim(sess, newClaim(newEvent(t, &eventsv1.UserRegistered{Id: "u1", UserId: "carol", Email: "carol@example.com"}))); err != nil {
+		t.Fatalf("Error consuming: %v", err)
+	}
+	if chats, err := ctrl.ListChats(ctx, "carol"); err != nil || len(chats) != 1 {
+		t.Errorf("Expected the welcome chat, got %v, %v", chats, err)
+	}
+
+	// Test messages that fail are neither committed nor followed by later ones
+	if err := ctrl.Shutdown(ctx); err != nil {
+		t.Fatalf("Error shutting down: %v", err)
+	}
+	reset := newEvent(t, &eventsv1.AccountMessage{Id: "m2", Type: "password_reset", Receiver: "bob@example.com", Msg: "123456"})
+	sess = &fakeSession{ctx: ctx}
+	if err := h.ConsumeClaim(sess, newClaim(reset, chat)); !errors.Is(err, notification.ErrShuttingDown) {
+		t.Errorf("Expected %v, got %v", notification.ErrShuttingDown, err)
+	}
+	if len(sess.marked) != 0 || sess.committed != 0 {
+		t.Errorf("Expected nothing to be committed, got %v, committed %d", sess.marked, sess.committed)
+	}
+	if processed, _ := repo.IsProcessed(ctx, "m2"); processed {
+		t.Errorf("Expected m2 not to be processed")
+	}
+}
@@ -0,0 +1,75 @@
+// Package fake provides an in-memory notification integration for tests
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// Delivery is a message the integration was asked to deliver
+type Delivery struct {
+	To  model.Recipient
+	Msg model.Envelope
+}
+
+// Integration records deliveries instead of sending them
+type Integration struct {
+	mu      sync.Mutex
+	channel string
+	sent    []Delivery
+	// Result, when set, is returned instead of a successful delivery, e.g. to simulate failures
+	Result *model.DeliveryResult
+	// Results, when set, are returned for the next deliveries in order before falling back to Result
+	Results []*model.DeliveryResult
+	// Hold, when set, holds every delivery until it's closed or the context is done, e.g. to simulate slow providers
+	Hold chan struct{}
+}
+
+// New creates a fake integration delivering to the channel
+func New(channel string) *Integration {
+	return &Integration{channel: channel}
+}
+
+func (i *Integration) Name() string {
+	return "fake " + i.channel
+}
+
+func (i *Integration) Channel() string {
+	return i.channel
+}
+
+// Notify records the delivery and returns the next of Results, Result or a sent result with a generated provider id
+func (i *Integration) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	if i.Hold != nil {
+		select {
+		case <-i.Hold:
+		case <-ctx.Done():
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return model.FailedDelivery(err, true)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.sent = append(i.sent, Delivery{to, msg})
+	if len(i.Results) > 0 {
+		res := *i.Results[0]
+		i.Results = i.Results[1:]
+		return &res
+	}
+	if i.Result != nil {
+		res := *i.Result
+		return &res
+	}
+	return &model.DeliveryResult{ProviderID: fmt.Sprintf("fake-%d", len(i.sent)), Status: model.DeliverySent}
+}
+
+// Sent returns the deliveries recorded so far
+func (i *Integration) Sent() []Delivery {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]Delivery{}, i.sent...)
+}
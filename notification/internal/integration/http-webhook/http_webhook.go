@@ -0,0 +1,82 @@
+package httpwebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/httpclient"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/webhook"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// ErrNoSecret is returned for receivers without a secret to sign their deliveries with,
+// e.g. ones added before receivers got their own, which have to be added again
+var ErrNoSecret = errors.New("webhook receiver has no signing secret")
+
+type HTTPWebhook struct {
+	client *http.Client
+}
+
+// New creates a webhook integration signing requests with each receiver's secret, receivers have timeout to respond
+func New(timeout time.Duration) *HTTPWebhook {
+	return &HTTPWebhook{
+		client: httpclient.New(timeout),
+	}
+}
+
+func (hw *HTTPWebhook) Name() string {
+	return "http webhook"
+}
+
+func (hw *HTTPWebhook) Channel() string {
+	return usermodel.ChannelWebhook
+}
+
+// Notify POSTs the message signed with the recipient's secret to its URL
+func (hw *HTTPWebhook) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	if to.Secret == "" {
+		return model.FailedDelivery(ErrNoSecret, false)
+	}
+	body, err := json.Marshal(webhook.Payload{
+		ID:         msg.ID,
+		ChatID:     msg.ChatID,
+		Sender:     msg.Sender,
+		SenderName: msg.SenderName,
+		Type:       msg.Type,
+		Msg:        msg.Body,
+		CreatedAt:  msg.CreatedAt,
+		Recipient:  to.UserID,
+	})
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.Address, bytes.NewReader(body))
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	deliveryID := newDeliveryID()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Wuphf-Webhook/1.0")
+	req.Header.Set(webhook.DeliveryHeader, deliveryID)
+	now := time.Now()
+	req.Header.Set(webhook.TimestampHeader, fmt.Sprint(now.Unix()))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign([]byte(to.Secret), now, body))
+
+	res := httpclient.Deliver(hw.client, req)
+	res.ProviderID = deliveryID
+	return res
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
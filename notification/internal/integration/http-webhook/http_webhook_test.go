@@ -0,0 +1,110 @@
+package httpwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/httpclient"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/webhook"
+)
+
+func TestNotify(t *testing.T) {
+	status := http.StatusOK
+	var received webhook.Payload
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := webhook.VerifyRequest(r, []byte("test_secret"), 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	hw := New(time.Second)
+	hw.client = srv.Client()
+	ctx := context.Background()
+	to := model.Recipient{UserID: "bob", Address: srv.URL, Secret: "test_secret"}
+	msg := model.Envelope{ID: "msg1", ChatID: "chat1", Sender: "alice", SenderName: "Alice", Body: "Wuphf"}
+
+	// Test the signed payload is accepted and the response code recorded
+	t.Run("TestDelivered", func(t *testing.T) {
+		res := hw.Notify(ctx, to, msg)
+		if res.Status != model.DeliverySent || res.ResponseCode != http.StatusOK || res.ProviderID == "" {
+			t.Fatalf("Unexpected delivery result: %v", res)
+		}
+		if received.ID != "msg1" || received.ChatID != "chat1" || received.Msg != "Wuphf" || received.Recipient != "bob" {
+			t.Errorf("Unexpected payload: %v", received)
+		}
+	})
+
+	// Test deliveries are signed with the recipient's own secret
+	t.Run("TestWrongSecret", func(t *testing.T) {
+		other := to
+		other.Secret = "other_secret"
+		res := hw.Notify(ctx, other, msg)
+		if res.Status != model.DeliveryFailed || res.ResponseCode != http.StatusUnauthorized || res.Retryable {
+			t.Errorf("Unexpected delivery result: %v", res)
+		}
+	})
+
+	// Test recipients without a secret aren't delivered to
+	t.Run("TestNoSecret", func(t *testing.T) {
+		other := to
+		other.Secret = ""
+		res := hw.Notify(ctx, other, msg)
+		if res.Status != model.DeliveryFailed || res.Retryable || res.Error != ErrNoSecret.Error() {
+			t.Errorf("Expected %v, got %v", ErrNoSecret, res)
+		}
+	})
+
+	// Test server errors are retryable and client errors are not
+	t.Run("TestErrorResponses", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		if res := hw.Notify(ctx, to, msg); res.Status != model.DeliveryFailed || !res.Retryable {
+			t.Errorf("Expected retryable failure, got %v", res)
+		}
+		status = http.StatusGone
+		if res := hw.Notify(ctx, to, msg); res.Status != model.DeliveryFailed || res.Retryable {
+			t.Errorf("Expected permanent failure, got %v", res)
+		}
+		status = http.StatusOK
+	})
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	hw := New(50 * time.Millisecond)
+	client := srv.Client()
+	client.Timeout = 50 * time.Millisecond
+	hw.client = client
+
+	res := hw.Notify(context.Background(), model.Recipient{Address: srv.URL, Secret: "test_secret"}, model.Envelope{Body: "Wuphf"})
+	if res.Status != model.DeliveryFailed || !res.Retryable {
+		t.Errorf("Expected retryable timeout, got %v", res)
+	}
+}
+
+func TestNotifyRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to a private address")
+	}))
+	defer srv.Close()
+
+	res := New(time.Second).Notify(context.Background(), model.Recipient{Address: srv.URL, Secret: "test_secret"}, model.Envelope{Body: "Wuphf"})
+	if res.Status != model.DeliveryFailed || res.Retryable {
+		t.Errorf("Expected %v, got %v", httpclient.ErrPrivateAddress, res)
+	}
+}
@@ -0,0 +1,74 @@
+// Package httpclient provides the HTTP client integrations use to call user supplied URLs
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// DefaultTimeout is how long a receiver has to respond
+const DefaultTimeout = 10 * time.Second
+
+// ErrPrivateAddress is returned when a URL resolves to an internal address
+var ErrPrivateAddress = errors.New("address is not public")
+
+// New creates a client that gives up after timeout and refuses redirects and
+// connections to internal addresses, so user supplied URLs can't reach into our network
+func New(timeout time.Duration) *http.Client {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Deliver sends the request and reports the outcome, any 2xx response counts as delivered
+func Deliver(client *http.Client, req *http.Request) *model.DeliveryResult {
+	resp, err := client.Do(req)
+	if err != nil {
+		return model.FailedDelivery(err, Retryable(0, err))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	res := &model.DeliveryResult{Status: model.DeliverySent, ResponseCode: resp.StatusCode}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		res.Status = model.DeliveryFailed
+		res.Error = "receiver responded " + resp.Status
+		res.Retryable = Retryable(resp.StatusCode, nil)
+	}
+	return res
+}
+
+// Retryable reports whether a request that failed with err or got the status code may succeed later
+func Retryable(statusCode int, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrPrivateAddress)
+	}
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// publicOnly refuses connections to loopback, private and link-local addresses
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/httpclient"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// escaper escapes the characters Slack's mrkdwn reserves for links and mentions
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// message is the body of a Slack incoming webhook request, text is the fallback for notifications
+type message struct {
+	Text   string  `json:"text"`
+	Blocks []block `json:"blocks"`
+}
+
+type block struct {
+	Type     string  `json:"type"`
+	Text     *text   `json:"text,omitempty"`
+	Elements []*text `json:"elements,omitempty"`
+}
+
+type text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type Slack struct {
+	client *http.Client
+}
+
+// New creates a Slack integration posting to incoming webhooks, Slack has timeout to respond
+func New(timeout time.Duration) *Slack {
+	return &Slack{client: httpclient.New(timeout)}
+}
+
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+func (s *Slack) Channel() string {
+	return usermodel.ChannelSlack
+}
+
+// Notify posts the message as Block Kit blocks to the recipient's incoming webhook URL
+func (s *Slack) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	body, err := json.Marshal(render(msg))
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.Address, bytes.NewReader(body))
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return httpclient.Deliver(s.client, req)
+}
+
+// render builds a section with the sender and message followed by a context line naming the chat
+func render(msg model.Envelope) message {
+	section := escaper.Replace(msg.Body)
+	if msg.SenderName != "" {
+		section = "*" + escaper.Replace(msg.SenderName) + "*\n" + section
+	}
+	footer := "Wuphf"
+	if msg.ChatID != "" {
+		footer = "Wuphf chat " + shortID(msg.ChatID)
+	}
+	if !msg.CreatedAt.IsZero() {
+		footer += " · " + msg.CreatedAt.UTC().Format(time.RFC1123)
+	}
+	return message{
+		Text: msg.Text(),
+		Blocks: []block{
+			{Type: "section", Text: &text{Type: "mrkdwn", Text: section}},
+			{Type: "context", Elements: []*text{{Type: "mrkdwn", Text: footer}}},
+		},
+	}
+}
+
+// shortID shortens chat ids, which are sha256 hashes, to something readable
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,76 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// newSlackServer mimics a Slack incoming webhook, rejecting payloads without text or blocks
+func newSlackServer(t *testing.T, received chan<- message) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/T000/B000/archived":
+			http.Error(w, "channel_is_archived", http.StatusGone)
+			return
+		case "/services/T000/B000/limited":
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate_limited", http.StatusTooManyRequests)
+			return
+		}
+		var m message
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&m) != nil || m.Text == "" || len(m.Blocks) == 0 {
+			http.Error(w, "invalid_payload", http.StatusBadRequest)
+			return
+		}
+		received <- m
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestNotify(t *testing.T) {
+	received := make(chan message, 1)
+	srv := newSlackServer(t, received)
+	defer srv.Close()
+
+	s := New(time.Second)
+	s.client = srv.Client()
+	ctx := context.Background()
+	msg := model.Envelope{ChatID: "0123456789abcdef", SenderName: "Alice", Body: "Wuphf <!channel>", CreatedAt: time.Now()}
+
+	// Test the message is posted as blocks with the sender and chat context
+	t.Run("TestDelivered", func(t *testing.T) {
+		res := s.Notify(ctx, model.Recipient{Address: srv.URL + "/services/T000/B000/XXXX"}, msg)
+		if res.Status != model.DeliverySent || res.ResponseCode != http.StatusOK {
+			t.Fatalf("Unexpected delivery result: %v", res)
+		}
+		m := <-received
+		if m.Text != "Alice: Wuphf <!channel>" {
+			t.Errorf("Unexpected fallback text: %s", m.Text)
+		}
+		if m.Blocks[0].Type != "section" || m.Blocks[0].Text.Text != "*Alice*\nWuphf &lt;!channel&gt;" {
+			t.Errorf("Unexpected section block: %v", m.Blocks[0].Text)
+		}
+		if m.Blocks[1].Type != "context" || !strings.HasPrefix(m.Blocks[1].Elements[0].Text, "Wuphf chat 01234567") {
+			t.Errorf("Unexpected context block: %v", m.Blocks[1].Elements)
+		}
+	})
+
+	// Test archived channels are not retried and rate limits are
+	t.Run("TestErrors", func(t *testing.T) {
+		res := s.Notify(ctx, model.Recipient{Address: srv.URL + "/services/T000/B000/archived"}, msg)
+		if res.Status != model.DeliveryFailed || res.ResponseCode != http.StatusGone || res.Retryable {
+			t.Errorf("Expected permanent failure, got %v", res)
+		}
+		res = s.Notify(ctx, model.Recipient{Address: srv.URL + "/services/T000/B000/limited"}, msg)
+		if res.Status != model.DeliveryFailed || res.ResponseCode != http.StatusTooManyRequests || !res.Retryable {
+			t.Errorf("Expected retryable failure, got %v", res)
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package smtpemail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// ErrNoSTARTTLS is returned when the server can't upgrade the connection, credentials are never sent in the clear
+var ErrNoSTARTTLS = errors.New("smtp server does not support STARTTLS")
+
+// subjects of account messages by event type, chat messages all share chatSubject so they thread together
+var subjects = map[string]string{
+	"email_verification":    "Verify your email",
+	"password_reset":        "Reset your password",
+	"receiver_verification": "Your verification code",
+}
+
+const (
+	chatSubject    = "New Wuphf"
+	defaultSubject = "Wuphf"
+)
+
+var htmlBody = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body>
+{{if .SenderName}}<p><strong>{{.SenderName}}</strong></p>
+{{end}}<p>{{.Body}}</p>
+</body>
+</html>
+`))
+
+type SMTPEmail struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	// domain is the right hand side of generated Message-IDs
+	domain    string
+	tlsConfig *tls.Config
+}
+
+// New creates an email integration sending from the address through the SMTP server at addr ("host:port").
+// The connection is always upgraded with STARTTLS, username and password are optional.
+func New(addr, username, password, from string) (*SMTPEmail, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	domain := sender.Address[strings.LastIndex(sender.Address, "@")+1:]
+	return &SMTPEmail{
+		addr:      addr,
+		host:      host,
+		username:  username,
+		password:  password,
+		from:      sender.Address,
+		domain:    domain,
+		tlsConfig: &tls.Config{ServerName: host},
+	}, nil
+}
+
+func (se *SMTPEmail) Name() string {
+	return "smtp email"
+}
+
+func (se *SMTPEmail) Channel() string {
+	return usermodel.ChannelEmail
+}
+
+// Notify emails the message to the recipient's address, the Message-ID is returned as the provider id
+func (se *SMTPEmail) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	messageID := se.messageID(msg.ID)
+	body, err := se.render(to, msg, messageID)
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	if err := se.send(ctx, to.Address, body); err != nil {
+		return model.FailedDelivery(err, retryable(err))
+	}
+	return &model.DeliveryResult{ProviderID: messageID, Status: model.DeliverySent}
+}
+
+// send delivers the rendered message in a single SMTP transaction, aborting when ctx is done
+func (se *SMTPEmail) send(ctx context.Context, rcpt string, body []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", se.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, se.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Hello(se.domain); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		return ErrNoSTARTTLS
+	}
+	if err := c.StartTLS(se.tlsConfig); err != nil {
+		return err
+	}
+	if se.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", se.username, se.password, se.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(se.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// render builds a multipart/alternative message with plain text and HTML bodies.
+// Chat messages reference a per chat root Message-ID so mail clients group them into one thread.
+func (se *SMTPEmail) render(to model.Recipient, msg model.Envelope, messageID string) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	from := mail.Address{Address: se.from}
+	if msg.SenderName != "" {
+		from.Name = msg.SenderName + " via Wuphf"
+	}
+	subject, ok := subjects[msg.Type]
+	if !ok {
+		subject = defaultSubject
+	}
+	date := msg.CreatedAt
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + (&mail.Address{Name: to.Name, Address: to.Address}).String(),
+		"Date: " + date.Format(time.RFC1123Z),
+		"Message-ID: " + messageID,
+	}
+	if msg.ChatID != "" {
+		root := fmt.Sprintf("<chat-%s@%s>", msg.ChatID, se.domain)
+		subject = chatSubject
+		headers = append(headers, "In-Reply-To: "+root, "References: "+root)
+	}
+	headers = append(headers,
+		"Subject: "+mime.QEncoding.Encode("utf-8", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary="+mw.Boundary(),
+	)
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	if err := writePart(mw, "text/plain", func(w io.Writer) error {
+		_, err := io.WriteString(w, msg.Text())
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := writePart(mw, "text/html", func(w io.Writer) error {
+		return htmlBody.Execute(w, msg)
+	}); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writePart adds a quoted-printable encoded part of the content type to the message
+func writePart(mw *multipart.Writer, contentType string, write func(io.Writer) error) error {
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qw := quotedprintable.NewWriter(pw)
+	if err := write(qw); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// messageID derives the Message-ID from the message id so redeliveries keep it, or generates one
+func (se *SMTPEmail) messageID(id string) string {
+	if id == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	return fmt.Sprintf("<%s@%s>", id, se.domain)
+}
+
+// retryable reports whether a send may succeed on a later attempt, i.e. the server replied
+// with a transient 4xx code or the connection failed
+func retryable(err error) bool {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code >= 400 && tpErr.Code < 500
+	}
+	return !errors.Is(err, ErrNoSTARTTLS)
+}
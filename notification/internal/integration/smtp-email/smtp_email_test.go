@@ -0,0 +1,186 @@
+package smtpemail
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/emersion/go-smtp"
+)
+
+// backend is an in-process SMTP server backend recording the messages it accepts
+type backend struct {
+	rcptErr  error
+	messages chan []byte
+}
+
+func (b *backend) Login(_ *smtp.ConnectionState, username, password string) (smtp.Session, error) {
+	if username != "user" || password != "pass" {
+		return nil, errors.New("invalid credentials")
+	}
+	return &session{b}, nil
+}
+
+func (b *backend) AnonymousLogin(_ *smtp.ConnectionState) (smtp.Session, error) {
+	return nil, smtp.ErrAuthRequired
+}
+
+type session struct{ b *backend }
+
+func (s *session) Reset()                                  {}
+func (s *session) Logout() error                           { return nil }
+func (s *session) Mail(_ string, _ smtp.MailOptions) error { return nil }
+func (s *session) Rcpt(_ string) error                     { return s.b.rcptErr }
+
+func (s *session) Data(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.b.messages <- b
+	return nil
+}
+
+// startServer starts a fake SMTP server offering STARTTLS with a self-signed certificate
+// and returns an integration configured to trust it
+func startServer(t *testing.T, be *backend, startTLS bool) *SMTPEmail {
+	cert, pool := selfSignedCert(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	s := smtp.NewServer(be)
+	s.Domain = "localhost"
+	if startTLS {
+		s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	se, err := New(l.Addr().String(), "user", "pass", "Wuphf <noreply@wuphf.com>")
+	if err != nil {
+		t.Fatalf("Error creating integration: %v", err)
+	}
+	se.tlsConfig = &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	return se
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestNotify(t *testing.T) {
+	be := &backend{messages: make(chan []byte, 1)}
+	se := startServer(t, be, true)
+	ctx := context.Background()
+
+	to := model.Recipient{UserID: "bob", Name: "Bob", Address: "bob@example.com"}
+	msg := model.Envelope{ID: "msg1", ChatID: "chat1", SenderName: "Alice", Body: "<b>Wuphf</b>"}
+
+	// Test a chat message is delivered with threading headers and both bodies
+	t.Run("TestChatMessage", func(t *testing.T) {
+		res := se.Notify(ctx, to, msg)
+		if res.Status != model.DeliverySent || res.ProviderID != "<msg1@wuphf.com>" {
+			t.Fatalf("Unexpected delivery result: %v", res)
+		}
+
+		m, err := mail.ReadMessage(strings.NewReader(string(<-be.messages)))
+		if err != nil {
+			t.Fatalf("Error parsing message: %v", err)
+		}
+		if m.Header.Get("Message-ID") != "<msg1@wuphf.com>" {
+			t.Errorf("Unexpected Message-ID: %s", m.Header.Get("Message-ID"))
+		}
+		if m.Header.Get("References") != "<chat-chat1@wuphf.com>" || m.Header.Get("In-Reply-To") != "<chat-chat1@wuphf.com>" {
+			t.Errorf("Unexpected threading headers: %v", m.Header)
+		}
+		if from, _ := m.Header.AddressList("From"); len(from) != 1 || from[0].Name != "Alice via Wuphf" || from[0].Address != "noreply@wuphf.com" {
+			t.Errorf("Unexpected From: %v", from)
+		}
+
+		_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatalf("Error parsing content type: %v", err)
+		}
+		parts := map[string]string{}
+		mr := multipart.NewReader(m.Body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Error reading part: %v", err)
+			}
+			b, _ := io.ReadAll(p)
+			mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+			parts[mediaType] = string(b)
+		}
+		if parts["text/plain"] != "Alice: <b>Wuphf</b>" {
+			t.Errorf("Unexpected plain text body: %q", parts["text/plain"])
+		}
+		if !strings.Contains(parts["text/html"], "&lt;b&gt;Wuphf&lt;/b&gt;") {
+			t.Errorf("Expected escaped HTML body, got %q", parts["text/html"])
+		}
+	})
+
+	// Test permanent rejections are not retried and transient ones are
+	t.Run("TestRejected", func(t *testing.T) {
+		be.rcptErr = &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such user"}
+		if res := se.Notify(ctx, to, msg); res.Status != model.DeliveryFailed || res.Retryable {
+			t.Errorf("Expected permanent failure, got %v", res)
+		}
+		be.rcptErr = &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Try again later"}
+		if res := se.Notify(ctx, to, msg); res.Status != model.DeliveryFailed || !res.Retryable {
+			t.Errorf("Expected retryable failure, got %v", res)
+		}
+		be.rcptErr = nil
+	})
+}
+
+func TestNotifyRequiresSTARTTLS(t *testing.T) {
+	be := &backend{messages: make(chan []byte, 1)}
+	se := startServer(t, be, false)
+
+	res := se.Notify(context.Background(), model.Recipient{Address: "bob@example.com"}, model.Envelope{Body: "Wuphf"})
+	if res.Status != model.DeliveryFailed || res.Error != ErrNoSTARTTLS.Error() || res.Retryable {
+		t.Errorf("Expected %v, got %v", ErrNoSTARTTLS, res)
+	}
+}
@@ -0,0 +1,120 @@
+package teams
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/httpclient"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+const adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+// message is the body of a Teams incoming webhook request carrying a single Adaptive Card
+type message struct {
+	Type        string       `json:"type"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	ContentType string `json:"contentType"`
+	Content     card   `json:"content"`
+}
+
+type card struct {
+	Schema  string    `json:"$schema"`
+	Type    string    `json:"type"`
+	Version string    `json:"version"`
+	Body    []element `json:"body"`
+}
+
+type element struct {
+	Type   string `json:"type"`
+	Text   string `json:"text,omitempty"`
+	Weight string `json:"weight,omitempty"`
+	Size   string `json:"size,omitempty"`
+	Wrap   bool   `json:"wrap,omitempty"`
+	Facts  []fact `json:"facts,omitempty"`
+}
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type Teams struct {
+	client *http.Client
+}
+
+// New creates a Teams integration posting to incoming webhooks, Teams has timeout to respond
+func New(timeout time.Duration) *Teams {
+	return &Teams{client: httpclient.New(timeout)}
+}
+
+func (t *Teams) Name() string {
+	return "teams"
+}
+
+func (t *Teams) Channel() string {
+	return usermodel.ChannelTeams
+}
+
+// Notify posts the message as an Adaptive Card to the recipient's incoming webhook URL
+func (t *Teams) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	body, err := json.Marshal(render(msg))
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.Address, bytes.NewReader(body))
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return httpclient.Deliver(t.client, req)
+}
+
+// render builds a card with the sender as heading, the message and facts about the chat
+func render(msg model.Envelope) message {
+	sender := msg.SenderName
+	if sender == "" {
+		sender = "Wuphf"
+	}
+	var facts []fact
+	if msg.ChatID != "" {
+		facts = append(facts, fact{"Chat", shortID(msg.ChatID)})
+	}
+	if !msg.CreatedAt.IsZero() {
+		facts = append(facts, fact{"Sent", msg.CreatedAt.UTC().Format(time.RFC1123)})
+	}
+	body := []element{
+		{Type: "TextBlock", Text: sender, Weight: "bolder", Size: "medium"},
+		{Type: "TextBlock", Text: msg.Body, Wrap: true},
+	}
+	if len(facts) > 0 {
+		body = append(body, element{Type: "FactSet", Facts: facts})
+	}
+	return message{
+		Type: "message",
+		Attachments: []attachment{{
+			ContentType: adaptiveCardContentType,
+			Content: card{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    body,
+			},
+		}},
+	}
+}
+
+// shortID shortens chat ids, which are sha256 hashes, to something readable
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,66 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// newTeamsServer mimics a Teams incoming webhook, which only accepts message activities with card attachments
+func newTeamsServer(t *testing.T, received chan<- message) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/webhookb2/unavailable" {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var m message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.Type != "message" || len(m.Attachments) != 1 || m.Attachments[0].ContentType != adaptiveCardContentType {
+			http.Error(w, "Bad payload received by generic incoming webhook.", http.StatusBadRequest)
+			return
+		}
+		received <- m
+		w.Write([]byte("1"))
+	}))
+}
+
+func TestNotify(t *testing.T) {
+	received := make(chan message, 1)
+	srv := newTeamsServer(t, received)
+	defer srv.Close()
+
+	tm := New(time.Second)
+	tm.client = srv.Client()
+	ctx := context.Background()
+	msg := model.Envelope{ChatID: "0123456789abcdef", SenderName: "Alice", Body: "Wuphf", CreatedAt: time.Now()}
+
+	// Test the message is posted as an Adaptive Card with the sender and chat facts
+	t.Run("TestDelivered", func(t *testing.T) {
+		res := tm.Notify(ctx, model.Recipient{Address: srv.URL + "/webhookb2/XXXX"}, msg)
+		if res.Status != model.DeliverySent || res.ResponseCode != http.StatusOK {
+			t.Fatalf("Unexpected delivery result: %v", res)
+		}
+		card := (<-received).Attachments[0].Content
+		if card.Type != "AdaptiveCard" || len(card.Body) != 3 {
+			t.Fatalf("Unexpected card: %v", card)
+		}
+		if card.Body[0].Text != "Alice" || card.Body[1].Text != "Wuphf" {
+			t.Errorf("Unexpected card text: %v", card.Body)
+		}
+		if facts := card.Body[2].Facts; len(facts) != 2 || facts[0].Value != "01234567" {
+			t.Errorf("Unexpected card facts: %v", facts)
+		}
+	})
+
+	// Test outages are retried
+	t.Run("TestUnavailable", func(t *testing.T) {
+		res := tm.Notify(ctx, model.Recipient{Address: srv.URL + "/webhookb2/unavailable"}, msg)
+		if res.Status != model.DeliveryFailed || res.ResponseCode != http.StatusServiceUnavailable || !res.Retryable {
+			t.Errorf("Expected retryable failure, got %v", res)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package twiliosms
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	"github.com/twilio/twilio-go/client"
+)
+
+// SignatureHeader is the header Twilio signs its requests with
+const SignatureHeader = "X-Twilio-Signature"
+
+var (
+	// ErrInvalidSignature is returned for callbacks that weren't signed by Twilio with our auth token
+	ErrInvalidSignature = errors.New("invalid Twilio signature")
+	// ErrUnknownStatus is returned for callbacks reporting a message status we don't know
+	ErrUnknownStatus = errors.New("unknown Twilio message status")
+)
+
+// messageStatuses maps Twilio's message statuses to delivery statuses
+var messageStatuses = map[string]model.DeliveryStatus{
+	"accepted":    model.DeliveryQueued,
+	"scheduled":   model.DeliveryQueued,
+	"queued":      model.DeliveryQueued,
+	"sending":     model.DeliveryQueued,
+	"sent":        model.DeliverySent,
+	"delivered":   model.DeliveryDelivered,
+	"read":        model.DeliveryRead,
+	"undelivered": model.DeliveryFailed,
+	"failed":      model.DeliveryFailed,
+	"canceled":    model.DeliveryFailed,
+}
+
+// StatusUpdate is a message status change reported by Twilio
+type StatusUpdate struct {
+	// MessageSID is the SID Notify reported as the delivery's provider id
+	MessageSID string
+	Status     model.DeliveryStatus
+	// Error describes why the message failed, empty unless it did
+	Error string
+}
+
+// StatusCallbacks validates and parses the status callbacks Twilio sends for the messages we send
+type StatusCallbacks struct {
+	validator client.RequestValidator
+	url       string
+}
+
+// NewStatusCallbacks creates a status callback parser, url must be the exact public URL given to
+// New as the messages' status callback since Twilio signs it along with the payload
+func NewStatusCallbacks(authToken, url string) *StatusCallbacks {
+	return &StatusCallbacks{client.NewRequestValidator(authToken), url}
+}
+
+// Parse validates the callback's signature and returns the status it reports
+func (sc *StatusCallbacks) Parse(req *http.Request) (*StatusUpdate, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	params := map[string]string{}
+	for k := range req.PostForm {
+		params[k] = req.PostForm.Get(k)
+	}
+	if !sc.validator.Validate(sc.url, params, req.Header.Get(SignatureHeader)) {
+		return nil, ErrInvalidSignature
+	}
+
+	status, ok := messageStatuses[params["MessageStatus"]]
+	if !ok || params["MessageSid"] == "" {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, params["MessageStatus"])
+	}
+	update := &StatusUpdate{MessageSID: params["MessageSid"], Status: status}
+	if status == model.DeliveryFailed {
+		update.Error = "Twilio message " + params["MessageStatus"]
+		if code := params["ErrorCode"]; code != "" {
+			update.Error += " with error " + code
+		}
+	}
+	return update, nil
+}
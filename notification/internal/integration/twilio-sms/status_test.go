@@ -0,0 +1,96 @@
+package twiliosms
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+const (
+	testAuthToken   = "12345678901234567890123456789012"
+	testCallbackURL = "https://wuphf.com/twilio/status"
+)
+
+// Status callbacks as Twilio posts them
+const (
+	sentCallback        = "AccountSid=ACXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX&ApiVersion=2010-04-01&From=%2B14155550100&MessageSid=SM0123456789abcdef0123456789abcdef&MessageStatus=sent&SmsSid=SM0123456789abcdef0123456789abcdef&SmsStatus=sent&To=%2B14155550123"
+	deliveredCallback   = "AccountSid=ACXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX&ApiVersion=2010-04-01&From=%2B14155550100&MessageSid=SM0123456789abcdef0123456789abcdef&MessageStatus=delivered&RawDlrDoneDate=2406011200&SmsSid=SM0123456789abcdef0123456789abcdef&SmsStatus=delivered&To=%2B14155550123"
+	undeliveredCallback = "AccountSid=ACXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX&ApiVersion=2010-04-01&ErrorCode=30003&From=%2B14155550100&MessageSid=SM0123456789abcdef0123456789abcdef&MessageStatus=undelivered&SmsSid=SM0123456789abcdef0123456789abcdef&SmsStatus=undelivered&To=%2B14155550123"
+	unknownCallback     = "AccountSid=ACXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX&ApiVersion=2010-04-01&MessageSid=SM0123456789abcdef0123456789abcdef&MessageStatus=teleported&To=%2B14155550123"
+)
+
+// sign computes the signature Twilio sends, the HMAC-SHA1 of the URL followed by the sorted parameters
+func sign(t *testing.T, authToken, callbackURL, body string) string {
+	t.Helper()
+	params, err := url.ParseQuery(body)
+	if err != nil {
+		t.Fatalf("Error parsing callback: %v", err)
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(callbackURL))
+	for _, k := range keys {
+		mac.Write([]byte(k + params.Get(k)))
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func callback(body, signature string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/twilio/status", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(SignatureHeader, signature)
+	return req
+}
+
+func TestStatusCallbacks(t *testing.T) {
+	sc := NewStatusCallbacks(testAuthToken, testCallbackURL)
+
+	// Test recorded callbacks are mapped to delivery statuses
+	for _, tc := range []struct {
+		body   string
+		status model.DeliveryStatus
+		err    string
+	}{
+		{sentCallback, model.DeliverySent, ""},
+		{deliveredCallback, model.DeliveryDelivered, ""},
+		{undeliveredCallback, model.DeliveryFailed, "Twilio message undelivered with error 30003"},
+	} {
+		update, err := sc.Parse(callback(tc.body, sign(t, testAuthToken, testCallbackURL, tc.body)))
+		if err != nil {
+			t.Fatalf("Error parsing callback: %v", err)
+		}
+		if update.MessageSID != "SM0123456789abcdef0123456789abcdef" || update.Status != tc.status || update.Error != tc.err {
+			t.Errorf("Unexpected status update: %v", update)
+		}
+	}
+
+	// Test callbacks with unknown statuses are rejected
+	if _, err := sc.Parse(callback(unknownCallback, sign(t, testAuthToken, testCallbackURL, unknownCallback))); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("Expected %v, got %v", ErrUnknownStatus, err)
+	}
+
+	// Test callbacks that aren't signed with our auth token, for our URL or were tampered with are rejected
+	for _, req := range []*http.Request{
+		callback(deliveredCallback, ""),
+		callback(deliveredCallback, sign(t, "another auth token", testCallbackURL, deliveredCallback)),
+		callback(deliveredCallback, sign(t, testAuthToken, "https://evil.example.com/twilio/status", deliveredCallback)),
+		callback(deliveredCallback, sign(t, testAuthToken, testCallbackURL, sentCallback)),
+	} {
+		if _, err := sc.Parse(req); err != ErrInvalidSignature {
+			t.Errorf("Expected %v, got %v", ErrInvalidSignature, err)
+		}
+	}
+}
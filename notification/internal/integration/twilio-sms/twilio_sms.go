@@ -1,39 +1,83 @@
 package twiliosms
 
 import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
 	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
 	api "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
+// IntegrationName is the name deliveries through Twilio SMS are recorded under
+const IntegrationName = "twilio sms"
+
 type TwilioSMS struct {
 	client *twilio.RestClient
+	// statusCallback is the URL Twilio reports delivery status changes to, none are reported when empty
+	statusCallback string
 }
 
-func New() *TwilioSMS {
+// New creates a Twilio SMS integration, statusCallback is the public URL of our status callback endpoint
+func New(statusCallback string) *TwilioSMS {
 	return &TwilioSMS{
-		client: twilio.NewRestClient(),
+		client:         twilio.NewRestClient(),
+		statusCallback: statusCallback,
 	}
 }
 
 func (ts *TwilioSMS) Name() string {
-	return "twilio sms"
+	return IntegrationName
+}
+
+func (ts *TwilioSMS) Channel() string {
+	return usermodel.ChannelSMS
 }
 
-func (ts *TwilioSMS) Notify(receiver, body string) (string, error) {
+// Notify texts the message to the recipient's phone number.
+// The Twilio client doesn't take a context, so ctx is only checked before calling out.
+func (ts *TwilioSMS) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	if err := ctx.Err(); err != nil {
+		return model.FailedDelivery(err, true)
+	}
 	sender, err := ts.client.NumbersV2.ListHostedNumberOrder(nil)
 	if err != nil {
-		return "", err
+		return model.FailedDelivery(err, retryable(err))
+	}
+	if len(sender) == 0 || sender[0].PhoneNumber == nil {
+		return model.FailedDelivery(errors.New("no hosted sender number"), false)
 	}
 	params := &api.CreateMessageParams{}
-	params.SetBody(body)
+	params.SetBody(msg.Text())
 	params.SetFrom(*sender[0].PhoneNumber)
-	params.SetTo(receiver)
+	params.SetTo(to.Address)
+	if ts.statusCallback != "" {
+		params.SetStatusCallback(ts.statusCallback)
+	}
 
 	resp, err := ts.client.Api.CreateMessage(params)
 	if err != nil {
-		return "", err
-	} else if resp.Sid == nil {
-		return "", nil
+		return model.FailedDelivery(err, retryable(err))
+	}
+	res := &model.DeliveryResult{Status: model.DeliveryQueued}
+	if resp.Sid != nil {
+		res.ProviderID = *resp.Sid
+	}
+	if resp.Status != nil && *resp.Status == "failed" {
+		res.Status = model.DeliveryFailed
+	}
+	return res
+}
+
+// retryable reports whether a Twilio error may succeed on a later attempt, i.e. it was
+// rate limited, a server error or never got a response at all
+func retryable(err error) bool {
+	var restErr *client.TwilioRestError
+	if !errors.As(err, &restErr) {
+		return true
 	}
-	return *resp.Sid, err
+	return restErr.Status == http.StatusTooManyRequests || restErr.Status >= http.StatusInternalServerError
 }
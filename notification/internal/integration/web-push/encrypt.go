@@ -0,0 +1,108 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	// recordSize is the aes128gcm record size, payloads are sent as a single record
+	recordSize = 4096
+	// maxPayload is the largest plaintext push services accept once the header,
+	// padding delimiter and authentication tag are added to the 4096 byte body limit
+	maxPayload = recordSize - headerSize - 1 - 16
+	headerSize = 16 + 4 + 1 + 65
+)
+
+// ErrPayloadTooLarge is returned when a payload doesn't fit into a push message
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// encrypt encrypts the payload for the subscription's keys as described in RFC 8291
+func encrypt(payload []byte, p256dh, auth string) ([]byte, error) {
+	uaPublic, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeKey(auth)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return encryptWith(payload, uaPublic, authSecret, salt, asPrivate)
+}
+
+// encryptWith encrypts with the given salt and application server key, which must never be reused
+func encryptWith(payload, uaPublic, authSecret, salt []byte, asPrivate *ecdh.PrivateKey) ([]byte, error) {
+	if len(payload) > maxPayload {
+		return nil, ErrPayloadTooLarge
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asPrivate.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	// Combine the shared secret with the subscription's auth secret
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	// Derive the content encryption key and nonce as in RFC 8188
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// A single record is also the last one, which the 0x02 delimiter marks
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdf implements HKDF-SHA256 for outputs of at most one hash length
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeKey decodes subscription keys, which browsers encode as base64url with or without padding
+func decodeKey(key string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+}
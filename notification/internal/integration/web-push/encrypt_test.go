@@ -0,0 +1,33 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"testing"
+)
+
+// TestEncryptRFC8291 checks encryption against the example in RFC 8291 appendix A
+func TestEncryptRFC8291(t *testing.T) {
+	mustDecode := func(s string) []byte {
+		b, err := decodeKey(s)
+		if err != nil {
+			t.Fatalf("Error decoding %s: %v", s, err)
+		}
+		return b
+	}
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatalf("Error loading application server key: %v", err)
+	}
+	uaPublic := mustDecode("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	authSecret := mustDecode("BTBZMqHH6r4Tts7J_aSIgg")
+	salt := mustDecode("DGv6ra1nlYgDCS1FRnbzlw")
+
+	body, err := encryptWith([]byte("When I grow up, I want to be a watermelon"), uaPublic, authSecret, salt, asPrivate)
+	if err != nil {
+		t.Fatalf("Error encrypting: %v", err)
+	}
+	expected := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := b64.EncodeToString(body); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,103 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// vapidTokenTTL is how long VAPID tokens are valid for, push services reject more than 24 hours
+const vapidTokenTTL = 12 * time.Hour
+
+var b64 = base64.RawURLEncoding
+
+// VAPIDKeys identify this application server to push services (RFC 8292).
+// Browsers only accept pushes signed with the key they subscribed with, so it must be kept across restarts.
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	public  []byte
+}
+
+// GenerateVAPIDKeys generates a new P-256 key pair
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return vapidKeys(key), nil
+}
+
+// ParseVAPIDKeys loads a key pair from its base64url encoded private key
+func ParseVAPIDKeys(private string) (*VAPIDKeys, error) {
+	d, err := b64.DecodeString(private)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, err
+	}
+	return vapidKeys(key), nil
+}
+
+func vapidKeys(key *ecdh.PrivateKey) *VAPIDKeys {
+	public := key.PublicKey().Bytes()
+	x, y := elliptic.Unmarshal(elliptic.P256(), public)
+	return &VAPIDKeys{
+		private: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+			D:         new(big.Int).SetBytes(key.Bytes()),
+		},
+		public: public,
+	}
+}
+
+// PrivateKey returns the base64url encoded private key for storing the key pair
+func (k *VAPIDKeys) PrivateKey() string {
+	d := make([]byte, 32)
+	return b64.EncodeToString(k.private.D.FillBytes(d))
+}
+
+// PublicKey returns the base64url encoded public key browsers subscribe with as applicationServerKey
+func (k *VAPIDKeys) PublicKey() string {
+	return b64.EncodeToString(k.public)
+}
+
+// authorization returns the Authorization header value for a push to the endpoint,
+// subject is a mailto: or https: URL push services can contact us at
+func (k *VAPIDKeys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidTokenTTL).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := b64.EncodeToString(header) + "." + b64.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS encodes ES256 signatures as the fixed size concatenation of r and s
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return "vapid t=" + unsigned + "." + b64.EncodeToString(sig) + ", k=" + k.PublicKey(), nil
+}
@@ -0,0 +1,121 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/integration/httpclient"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+const (
+	// messageTTL is how long push services keep a message for an offline browser
+	messageTTL = 24 * time.Hour
+	// maxBodyRunes caps the message shown in the notification, the service worker can fetch the rest
+	maxBodyRunes = 1000
+)
+
+// payload is the decrypted JSON the frontend's service worker receives
+type payload struct {
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	ID     string `json:"id,omitempty"`
+	ChatID string `json:"chat_id,omitempty"`
+	Type   string `json:"type,omitempty"`
+}
+
+type WebPush struct {
+	client  *http.Client
+	keys    *VAPIDKeys
+	subject string
+}
+
+// New creates a Web Push integration signing pushes with the VAPID keys,
+// subject is a mailto: or https: URL push services can contact us at
+func New(keys *VAPIDKeys, subject string, timeout time.Duration) *WebPush {
+	return &WebPush{
+		client:  httpclient.New(timeout),
+		keys:    keys,
+		subject: subject,
+	}
+}
+
+func (wp *WebPush) Name() string {
+	return "web push"
+}
+
+func (wp *WebPush) Channel() string {
+	return usermodel.ChannelPush
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (wp *WebPush) PublicKey() string {
+	return wp.keys.PublicKey()
+}
+
+// Notify encrypts the message for the recipient's subscription and sends it to its push service.
+// Subscriptions the push service no longer knows are reported as gone so they can be pruned.
+func (wp *WebPush) Notify(ctx context.Context, to model.Recipient, msg model.Envelope) *model.DeliveryResult {
+	var sub usermodel.PushSubscription
+	if err := json.Unmarshal([]byte(to.Address), &sub); err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	body, err := wp.encode(msg, sub)
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	authorization, err := wp.keys.authorization(sub.Endpoint, wp.subject, time.Now())
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return model.FailedDelivery(err, false)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(messageTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := wp.client.Do(req)
+	if err != nil {
+		return model.FailedDelivery(err, httpclient.Retryable(0, err))
+	}
+	resp.Body.Close()
+
+	res := &model.DeliveryResult{ProviderID: resp.Header.Get("Location"), Status: model.DeliveryQueued, ResponseCode: resp.StatusCode}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		res.Status = model.DeliveryGone
+		res.Error = "push subscription expired"
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		res.Status = model.DeliveryFailed
+		res.Error = "push service responded " + resp.Status
+		res.Retryable = httpclient.Retryable(resp.StatusCode, nil)
+	}
+	return res
+}
+
+// encode renders the message as the JSON payload and encrypts it for the subscription
+func (wp *WebPush) encode(msg model.Envelope, sub usermodel.PushSubscription) ([]byte, error) {
+	title := msg.SenderName
+	if title == "" {
+		title = "Wuphf"
+	}
+	body := []rune(msg.Body)
+	if len(body) > maxBodyRunes {
+		body = append(body[:maxBodyRunes-1], '…')
+	}
+	b, err := json.Marshal(payload{Title: title, Body: string(body), ID: msg.ID, ChatID: msg.ChatID, Type: msg.Type})
+	if err != nil {
+		return nil, err
+	}
+	return encrypt(b, sub.Keys.P256dh, sub.Keys.Auth)
+}
@@ -0,0 +1,192 @@
+package webpush
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// browser holds the keys of a push subscription and decrypts what is pushed to it
+type browser struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &browser{private, auth}
+}
+
+func (b *browser) subscription(endpoint string) string {
+	var sub usermodel.PushSubscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = b64.EncodeToString(b.private.PublicKey().Bytes())
+	sub.Keys.Auth = b64.EncodeToString(b.auth)
+	s, _ := json.Marshal(sub)
+	return string(s)
+}
+
+// decrypt reverses RFC 8291 encryption the way a browser does
+func (b *browser) decrypt(body []byte) ([]byte, error) {
+	if len(body) < headerSize {
+		return nil, errors.New("body too short")
+	}
+	salt, idLen := body[:16], int(body[20])
+	asKey, err := ecdh.P256().NewPublicKey(body[21 : 21+idLen])
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := b.private.ECDH(asKey)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), b.private.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asKey.Bytes()...)
+	ikm := hkdf(b.auth, ecdhSecret, keyInfo, 32)
+	block, err := aes.NewCipher(hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12), body[21+idLen:], nil)
+	if err != nil {
+		return nil, err
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		return nil, errors.New("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+// verifyVAPID checks the Authorization header is a JWT for the audience signed by the key it names
+func verifyVAPID(header, audience string) error {
+	parts := strings.Split(strings.TrimPrefix(header, "vapid "), ", ")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "t=") || !strings.HasPrefix(parts[1], "k=") {
+		return errors.New("malformed vapid header")
+	}
+	token := strings.Split(strings.TrimPrefix(parts[0], "t="), ".")
+	public, err := b64.DecodeString(strings.TrimPrefix(parts[1], "k="))
+	if err != nil || len(token) != 3 {
+		return errors.New("malformed vapid token")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), public)
+	sig, err := b64.DecodeString(token[2])
+	if err != nil || x == nil || len(sig) != 64 {
+		return errors.New("malformed vapid signature")
+	}
+	digest := sha256.Sum256([]byte(token[0] + "." + token[1]))
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return errors.New("invalid vapid signature")
+	}
+	claims, _ := b64.DecodeString(token[1])
+	var c struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(claims, &c); err != nil || c.Aud != audience || c.Exp < time.Now().Unix() || c.Sub == "" {
+		return errors.New("invalid vapid claims")
+	}
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	b := newBrowser(t)
+	received := make(chan payload, 1)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/push/expired" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if err := verifyVAPID(r.Header.Get("Authorization"), "https://"+r.Host); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+			http.Error(w, "missing headers", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		plaintext, err := b.decrypt(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var p payload
+		json.Unmarshal(plaintext, &p)
+		received <- p
+		w.Header().Set("Location", "https://"+r.Host+"/message/1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Error generating VAPID keys: %v", err)
+	}
+	wp := New(keys, "mailto:admin@wuphf.com", time.Second)
+	wp.client = srv.Client()
+	ctx := context.Background()
+	msg := model.Envelope{ID: "msg1", ChatID: "chat1", SenderName: "Alice", Body: "Wuphf"}
+
+	// Test the push is signed, encrypted for the subscription and accepted
+	t.Run("TestDelivered", func(t *testing.T) {
+		res := wp.Notify(ctx, model.Recipient{Address: b.subscription(srv.URL + "/push/abc")}, msg)
+		if res.Status != model.DeliveryQueued || res.ResponseCode != http.StatusCreated || !strings.HasSuffix(res.ProviderID, "/message/1") {
+			t.Fatalf("Unexpected delivery result: %v", res)
+		}
+		if p := <-received; p.Title != "Alice" || p.Body != "Wuphf" || p.ChatID != "chat1" {
+			t.Errorf("Unexpected payload: %v", p)
+		}
+	})
+
+	// Test expired subscriptions are reported as gone
+	t.Run("TestGone", func(t *testing.T) {
+		res := wp.Notify(ctx, model.Recipient{Address: b.subscription(srv.URL + "/push/expired")}, msg)
+		if res.Status != model.DeliveryGone || res.Retryable {
+			t.Errorf("Expected gone result, got %v", res)
+		}
+	})
+}
+
+func TestVAPIDKeys(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Error generating VAPID keys: %v", err)
+	}
+	parsed, err := ParseVAPIDKeys(keys.PrivateKey())
+	if err != nil {
+		t.Fatalf("Error parsing VAPID keys: %v", err)
+	}
+	if parsed.PublicKey() != keys.PublicKey() {
+		t.Errorf("Expected public key %s, got %s", keys.PublicKey(), parsed.PublicKey())
+	}
+	if _, err := ParseVAPIDKeys("invalid"); err == nil {
+		t.Errorf("Expected error parsing invalid key")
+	}
+}
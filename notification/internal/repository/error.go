@@ -2,5 +2,13 @@ package repository
 
 import "errors"
 
-// ErrNotFound is returned when a requested resource is not found
-var ErrNotFound = errors.New("not found")
+var (
+	// ErrNotFound is returned when a requested resource is not found
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidToken is returned when a request's access token is rejected
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrForbidden is returned when a user requests a resource they're not a party to
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidSubscription is returned when a push subscription is malformed
+	ErrInvalidSubscription = errors.New("invalid push subscription")
+)
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// PostDeadLetter adds a dead letter
+func (r *Repository) PostDeadLetter(_ context.Context, dl *model.DeadLetter) error {
+	r.Lock()
+	defer r.Unlock()
+	stored := *dl
+	r.deadLetters[dl.ID] = &stored
+	return nil
+}
+
+// GetDeadLetter returns a dead letter by id
+func (r *Repository) GetDeadLetter(_ context.Context, id string) (*model.DeadLetter, error) {
+	r.RLock()
+	defer r.RUnlock()
+	dl, ok := r.deadLetters[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *dl
+	return &res, nil
+}
+
+// ListDeadLetters returns all dead letters, oldest first
+func (r *Repository) ListDeadLetters(_ context.Context) ([]*model.DeadLetter, error) {
+	r.RLock()
+	defer r.RUnlock()
+	res := []*model.DeadLetter{}
+	for _, dl := range r.deadLetters {
+		d := *dl
+		res = append(res, &d)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res, nil
+}
+
+// DeleteDeadLetter removes a dead letter by id
+func (r *Repository) DeleteDeadLetter(_ context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.deadLetters[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.deadLetters, id)
+	return nil
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// PutDelivery adds a delivery or replaces the notification's delivery to the same receiver through the same integration
+func (r *Repository) PutDelivery(_ context.Context, d *model.Delivery) error {
+	r.Lock()
+	defer r.Unlock()
+	stored := *d
+	deliveries := r.deliveries[d.NotificationID]
+	for i, existing := range deliveries {
+		if existing.Integration == d.Integration && existing.ReceiverID == d.ReceiverID {
+			deliveries[i] = &stored
+			return nil
+		}
+	}
+	r.deliveries[d.NotificationID] = append(deliveries, &stored)
+	return nil
+}
+
+// ListDeliveries returns the deliveries of a notification
+func (r *Repository) ListDeliveries(_ context.Context, notificationID string) ([]*model.Delivery, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.copyDeliveries(notificationID), nil
+}
+
+// ListChatDeliveries returns the deliveries of every notification in a chat
+func (r *Repository) ListChatDeliveries(_ context.Context, chatID string) ([]*model.Delivery, error) {
+	r.RLock()
+	defer r.RUnlock()
+	res := []*model.Delivery{}
+	for idx := range r.data[chatID] {
+		res = append(res, r.copyDeliveries(chatID+strconv.Itoa(idx))...)
+	}
+	return res, nil
+}
+
+// ListPendingDeliveries returns the deliveries waiting to be attempted or retried
+func (r *Repository) ListPendingDeliveries(_ context.Context) ([]*model.Delivery, error) {
+	r.RLock()
+	defer r.RUnlock()
+	res := []*model.Delivery{}
+	for _, deliveries := range r.deliveries {
+		for _, d := range deliveries {
+			if d.Pending() {
+				delivery := *d
+				res = append(res, &delivery)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) copyDeliveries(notificationID string) []*model.Delivery {
+	res := []*model.Delivery{}
+	for _, d := range r.deliveries[notificationID] {
+		delivery := *d
+		res = append(res, &delivery)
+	}
+	return res
+}
+
+// GetDeliveryByProviderID returns the delivery the integration's provider knows by the given id
+func (r *Repository) GetDeliveryByProviderID(_ context.Context, integration, providerID string) (*model.Delivery, error) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, deliveries := range r.deliveries {
+		for _, d := range deliveries {
+			if d.Integration == integration && d.ProviderID == providerID {
+				res := *d
+				return &res, nil
+			}
+		}
+	}
+	return nil, repository.ErrNotFound
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// GetIdempotencyRecord retrieves the result of the sender's request with the given idempotency key
+func (r *Repository) GetIdempotencyRecord(_ context.Context, sender, key string) (*model.IdempotencyRecord, error) {
+	r.RLock()
+	defer r.RUnlock()
+	rec, ok := r.idempotency[idempotencyID(sender, key)]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *rec
+	return &res, nil
+}
+
+// ReserveIdempotencyKey stores the pending record unless the sender's key is held by a record that was
+// created after expired, or that is still pending and was created after abandoned. It reports whether the
+// key was reserved.
+func (r *Repository) ReserveIdempotencyKey(_ context.Context, rec *model.IdempotencyRecord, expired, abandoned time.Time) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	id := idempotencyID(rec.Sender, rec.Key)
+	if held, ok := r.idempotency[id]; ok && !held.CreatedAt.Before(expired) && (held.Result != "" || !held.CreatedAt.Before(abandoned)) {
+		return false, nil
+	}
+	res := *rec
+	res.Result = ""
+	r.idempotency[id] = &res
+	return true, nil
+}
+
+// CompleteIdempotencyRecord stores the result of the request holding the sender's key
+func (r *Repository) CompleteIdempotencyRecord(_ context.Context, sender, key, result string) error {
+	r.Lock()
+	defer r.Unlock()
+	rec, ok := r.idempotency[idempotencyID(sender, key)]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	rec.Result = result
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the sender's key if it's still pending
+func (r *Repository) ReleaseIdempotencyKey(_ context.Context, sender, key string) error {
+	r.Lock()
+	defer r.Unlock()
+	id := idempotencyID(sender, key)
+	if rec, ok := r.idempotency[id]; ok && rec.Result == "" {
+		delete(r.idempotency, id)
+	}
+	return nil
+}
+
+// DeleteIdempotencyRecords removes the records created before the given time
+func (r *Repository) DeleteIdempotencyRecords(_ context.Context, before time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+	for id, rec := range r.idempotency {
+		if rec.CreatedAt.Before(before) {
+			delete(r.idempotency, id)
+		}
+	}
+	return nil
+}
+
+// idempotencyID scopes idempotency keys to their sender
+func idempotencyID(sender, key string) string {
+	return sender + "\x00" + key
+}
@@ -15,6 +15,16 @@ type Repository struct {
 	data      map[string][]*model.Notification
 	userChats map[string][]string
 	chatUsers map[string][]string
+	// push subscriptions by id
+	pushSubscriptions map[string]*model.PushSubscription
+	// dead letters by id
+	deadLetters map[string]*model.DeadLetter
+	// deliveries by notification id
+	deliveries map[string][]*model.Delivery
+	// ids of the processed messages
+	processed map[string]bool
+	// idempotency records by sender and key
+	idempotency map[string]*model.IdempotencyRecord
 }
 
 // New creates a new memory repository
@@ -23,21 +33,41 @@ func New() *Repository {
 		data:      map[string][]*model.Notification{},
 		userChats: map[string][]string{},
 		chatUsers: map[string][]string{},
+
+		pushSubscriptions: map[string]*model.PushSubscription{},
+		deadLetters:       map[string]*model.DeadLetter{},
+		deliveries:        map[string][]*model.Delivery{},
+		processed:         map[string]bool{},
+		idempotency:       map[string]*model.IdempotencyRecord{},
 	}
 }
 
-// Post adds a new notification
+// Post adds a new notification and sets its id, a notification already posted for the same message and
+// receiver is returned instead
 func (r *Repository) Post(_ context.Context, chatID string, n *model.Notification) (int, error) {
 	r.Lock()
 	defer r.Unlock()
+	if n.MessageID != "" {
+		for idx, existing := range r.data[chatID] {
+			if existing.MessageID == n.MessageID && existing.Receiver == n.Receiver {
+				n.ID = existing.ID
+				return idx, nil
+			}
+		}
+	}
+	idx := len(r.data[chatID])
+	n.ID = chatID + strconv.Itoa(idx)
 	r.data[chatID] = append(r.data[chatID], n)
-	return len(r.data[chatID]) - 1, nil
+	return idx, nil
 }
 
 // Get notification by id
 func (r *Repository) Get(_ context.Context, id string) (*model.Notification, error) {
 	r.RLock()
 	defer r.RUnlock()
+	if len(id) <= repository.ID_LENGTH {
+		return nil, repository.ErrNotFound
+	}
 	n, ok := r.data[id[:repository.ID_LENGTH]]
 	if !ok {
 		return nil, repository.ErrNotFound
@@ -0,0 +1,18 @@
+package memory
+
+import "context"
+
+// IsProcessed reports whether the message with the given id was processed
+func (r *Repository) IsProcessed(_ context.Context, messageID string) (bool, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.processed[messageID], nil
+}
+
+// MarkProcessed records the message with the given id as processed
+func (r *Repository) MarkProcessed(_ context.Context, messageID string) error {
+	r.Lock()
+	defer r.Unlock()
+	r.processed[messageID] = true
+	return nil
+}
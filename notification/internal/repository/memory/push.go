@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// PostPushSubscription adds a push subscription, a browser subscribing again replaces its previous
+// subscription and keeps its id
+func (r *Repository) PostPushSubscription(_ context.Context, sub *model.PushSubscription) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, s := range r.pushSubscriptions {
+		if s.Endpoint == sub.Endpoint {
+			sub.ID = s.ID
+			break
+		}
+	}
+	stored := *sub
+	r.pushSubscriptions[sub.ID] = &stored
+	return nil
+}
+
+// ListPushSubscriptions returns the push subscriptions of a user
+func (r *Repository) ListPushSubscriptions(_ context.Context, userID string) ([]*model.PushSubscription, error) {
+	r.RLock()
+	defer r.RUnlock()
+	res := []*model.PushSubscription{}
+	for _, s := range r.pushSubscriptions {
+		if s.UserID == userID {
+			sub := *s
+			res = append(res, &sub)
+		}
+	}
+	return res, nil
+}
+
+// DeletePushSubscription removes a push subscription by id
+func (r *Repository) DeletePushSubscription(_ context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.pushSubscriptions[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.pushSubscriptions, id)
+	return nil
+}
+
+// DeletePushSubscriptionByEndpoint removes the user's push subscription for an endpoint
+func (r *Repository) DeletePushSubscriptionByEndpoint(_ context.Context, userID, endpoint string) error {
+	r.Lock()
+	defer r.Unlock()
+	for id, s := range r.pushSubscriptions {
+		if s.UserID == userID && s.Endpoint == endpoint {
+			delete(r.pushSubscriptions, id)
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
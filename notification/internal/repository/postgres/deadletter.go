@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// PostDeadLetter adds a dead letter
+func (r *Repository) PostDeadLetter(ctx context.Context, dl *model.DeadLetter) error {
+	query := `
+		INSERT INTO dead_letters (id, notification_id, integration, receiver_id, recipient, message, attempts, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	to, err := json.Marshal(dl.To)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(dl.Msg)
+	if err != nil {
+		return err
+	}
+	attempts, err := json.Marshal(dl.Attempts)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, query, dl.ID, dl.NotificationID, dl.Integration, dl.ReceiverID, string(to), string(msg), string(attempts), dl.CreatedAt)
+	return err
+}
+
+// GetDeadLetter returns a dead letter by id
+func (r *Repository) GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	query := `
+		SELECT id, notification_id, integration, receiver_id, recipient, message, attempts, created_at
+		FROM dead_letters WHERE id = $1
+	`
+
+	dl, err := scanDeadLetter(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return dl, err
+}
+
+// ListDeadLetters returns all dead letters, oldest first
+func (r *Repository) ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	query := `
+		SELECT id, notification_id, integration, receiver_id, recipient, message, attempts, created_at
+		FROM dead_letters ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dls := []*model.DeadLetter{}
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		dls = append(dls, dl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return dls, nil
+}
+
+// DeleteDeadLetter removes a dead letter by id
+func (r *Repository) DeleteDeadLetter(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM dead_letters WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// scanDeadLetter scans a dead_letters row, decoding its JSON columns
+func scanDeadLetter(row interface{ Scan(...any) error }) (*model.DeadLetter, error) {
+	dl := &model.DeadLetter{}
+	var to, msg, attempts string
+	if err := row.Scan(&dl.ID, &dl.NotificationID, &dl.Integration, &dl.ReceiverID, &to, &msg, &attempts, &dl.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(to), &dl.To); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(msg), &dl.Msg); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(attempts), &dl.Attempts); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// PutDelivery adds a delivery or replaces the notification's delivery to the same receiver through the same integration
+func (r *Repository) PutDelivery(ctx context.Context, d *model.Delivery) error {
+	query := `
+		INSERT INTO deliveries (notification_id, channel, integration, receiver_id, provider_id, status, response_code, attempts, error, updated_at, recipient, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (notification_id, integration, receiver_id) DO UPDATE
+		SET channel = $2, provider_id = $5, status = $6, response_code = $7, attempts = $8, error = $9, updated_at = $10, recipient = $11, message = $12
+	`
+
+	// The recipient and message are only kept while the delivery is pending
+	var to, msg []byte
+	if d.To != (model.Recipient{}) {
+		var err error
+		if to, err = json.Marshal(d.To); err != nil {
+			return err
+		}
+		if msg, err = json.Marshal(d.Msg); err != nil {
+			return err
+		}
+	}
+	_, err := r.db.ExecContext(ctx, query, d.NotificationID, d.Channel, d.Integration, d.ReceiverID, d.ProviderID, d.Status, d.ResponseCode, d.Attempts, d.Error, d.UpdatedAt, string(to), string(msg))
+	return err
+}
+
+// ListDeliveries returns the deliveries of a notification
+func (r *Repository) ListDeliveries(ctx context.Context, notificationID string) ([]*model.Delivery, error) {
+	query := `
+		SELECT notification_id, channel, integration, receiver_id, provider_id, status, response_code, attempts, error, updated_at, recipient, message
+		FROM deliveries WHERE notification_id = $1
+	`
+	return r.queryDeliveries(ctx, query, notificationID)
+}
+
+// ListChatDeliveries returns the deliveries of every notification in a chat
+func (r *Repository) ListChatDeliveries(ctx context.Context, chatID string) ([]*model.Delivery, error) {
+	query := `
+		SELECT d.notification_id, d.channel, d.integration, d.receiver_id, d.provider_id, d.status, d.response_code, d.attempts, d.error, d.updated_at, d.recipient, d.message
+		FROM deliveries d JOIN notifications n ON d.notification_id = n.id::text
+		WHERE n.chat_id = $1
+	`
+	return r.queryDeliveries(ctx, query, chatID)
+}
+
+// ListPendingDeliveries returns the deliveries waiting to be attempted or retried
+func (r *Repository) ListPendingDeliveries(ctx context.Context) ([]*model.Delivery, error) {
+	query := `
+		SELECT notification_id, channel, integration, receiver_id, provider_id, status, response_code, attempts, error, updated_at, recipient, message
+		FROM deliveries WHERE status = $1 OR (status = $2 AND provider_id = '')
+		ORDER BY updated_at
+	`
+	return r.queryDeliveries(ctx, query, model.DeliveryRetrying, model.DeliveryQueued)
+}
+
+func (r *Repository) queryDeliveries(ctx context.Context, query string, args ...any) ([]*model.Delivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*model.Delivery{}
+	for rows.Next() {
+		d := &model.Delivery{}
+		var to, msg string
+		if err := rows.Scan(&d.NotificationID, &d.Channel, &d.Integration, &d.ReceiverID, &d.ProviderID, &d.Status, &d.ResponseCode, &d.Attempts, &d.Error, &d.UpdatedAt, &to, &msg); err != nil {
+			return nil, err
+		}
+		if to != "" {
+			if err := json.Unmarshal([]byte(to), &d.To); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal([]byte(msg), &d.Msg); err != nil {
+				return nil, err
+			}
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetDeliveryByProviderID returns the delivery the integration's provider knows by the given id
+func (r *Repository) GetDeliveryByProviderID(ctx context.Context, integration, providerID string) (*model.Delivery, error) {
+	query := `
+		SELECT notification_id, channel, integration, receiver_id, provider_id, status, response_code, attempts, error, updated_at, recipient, message
+		FROM deliveries WHERE integration = $1 AND provider_id = $2
+	`
+	deliveries, err := r.queryDeliveries(ctx, query, integration, providerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return deliveries[0], nil
+}
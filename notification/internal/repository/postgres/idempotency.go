@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// GetIdempotencyRecord retrieves the result of the sender's request with the given idempotency key
+func (r *Repository) GetIdempotencyRecord(ctx context.Context, sender, key string) (*model.IdempotencyRecord, error) {
+	query := `
+		SELECT sender, idempotency_key, result, created_at FROM idempotency_keys
+		WHERE sender = $1 AND idempotency_key = $2
+	`
+	rec := &model.IdempotencyRecord{}
+	err := r.db.QueryRowContext(ctx, query, sender, key).Scan(&rec.Sender, &rec.Key, &rec.Result, &rec.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ReserveIdempotencyKey stores the pending record unless the sender's key is held by a record that was
+// created after expired, or that is still pending and was created after abandoned. It reports whether the
+// key was reserved. Only expired or abandoned records are taken over, the row lock taken on conflict
+// keeps concurrent reservations from both succeeding.
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, rec *model.IdempotencyRecord, expired, abandoned time.Time) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (sender, idempotency_key, result, created_at)
+		VALUES ($1, $2, '', $3)
+		ON CONFLICT (sender, idempotency_key) DO UPDATE SET result = '', created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.created_at < $4 OR (idempotency_keys.result = '' AND idempotency_keys.created_at < $5)
+	`
+	res, err := r.db.ExecContext(ctx, query, rec.Sender, rec.Key, rec.CreatedAt, expired, abandoned)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CompleteIdempotencyRecord stores the result of the request holding the sender's key
+func (r *Repository) CompleteIdempotencyRecord(ctx context.Context, sender, key, result string) error {
+	query := `
+		UPDATE idempotency_keys SET result = $3 WHERE sender = $1 AND idempotency_key = $2
+	`
+	res, err := r.db.ExecContext(ctx, query, sender, key, result)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the sender's key if it's still pending
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, sender, key string) error {
+	query := `
+		DELETE FROM idempotency_keys WHERE sender = $1 AND idempotency_key = $2 AND result = ''
+	`
+	_, err := r.db.ExecContext(ctx, query, sender, key)
+	return err
+}
+
+// DeleteIdempotencyRecords removes the records created before the given time
+func (r *Repository) DeleteIdempotencyRecords(ctx context.Context, before time.Time) error {
+	query := `
+		DELETE FROM idempotency_keys WHERE created_at < $1
+	`
+	_, err := r.db.ExecContext(ctx, query, before)
+	return err
+}
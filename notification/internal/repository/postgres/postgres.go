@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"strconv"
 
 	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
@@ -18,19 +19,23 @@ func New(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// Post adds a new notification
+// Post adds a new notification and sets its id, a notification already posted for the same message and
+// receiver is returned instead
 func (r *Repository) Post(ctx context.Context, chatID string, n *model.Notification) (int, error) {
 	query := `
-		INSERT INTO notifications (chat_id, msg)
-		VALUES ($1, $2)
+		INSERT INTO notifications (chat_id, sender, receiver, msg, message_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (message_id, receiver) DO UPDATE SET message_id = EXCLUDED.message_id
 		RETURNING id
 	`
 
 	var id int
-	err := r.db.QueryRowContext(ctx, query, chatID, n.Msg).Scan(&id)
+	messageID := sql.NullString{String: n.MessageID, Valid: n.MessageID != ""}
+	err := r.db.QueryRowContext(ctx, query, chatID, n.Sender, n.Receiver, n.Msg, messageID).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
+	n.ID = strconv.Itoa(id)
 
 	return id, nil
 }
@@ -38,24 +43,24 @@ func (r *Repository) Post(ctx context.Context, chatID string, n *model.Notificat
 // Get notification by id
 func (r *Repository) Get(ctx context.Context, id string) (*model.Notification, error) {
 	query := `
-		SELECT msg FROM notifications WHERE id = $1
+		SELECT id, COALESCE(sender, ''), COALESCE(receiver, ''), msg FROM notifications WHERE id = $1
 	`
 
-	var message string
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&message)
+	n := &model.Notification{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&n.ID, &n.Sender, &n.Receiver, &n.Msg)
 	if err == sql.ErrNoRows {
 		return nil, repository.ErrNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return &model.Notification{Msg: message}, nil
+	return n, nil
 }
 
 // List notification by user chatID
 func (r *Repository) List(ctx context.Context, chatID string) ([]*model.Notification, error) {
 	query := `
-		SELECT msg FROM notifications WHERE chat_id = $1
+		SELECT id, COALESCE(sender, ''), COALESCE(receiver, ''), msg FROM notifications WHERE chat_id = $1 ORDER BY id
 	`
 
 	rows, err := r.db.QueryContext(ctx, query, chatID)
@@ -66,11 +71,11 @@ func (r *Repository) List(ctx context.Context, chatID string) ([]*model.Notifica
 
 	var notifications []*model.Notification
 	for rows.Next() {
-		var message string
-		if err := rows.Scan(&message); err != nil {
+		n := &model.Notification{}
+		if err := rows.Scan(&n.ID, &n.Sender, &n.Receiver, &n.Msg); err != nil {
 			return nil, err
 		}
-		notifications = append(notifications, &model.Notification{Msg: message})
+		notifications = append(notifications, n)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -6,10 +6,13 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
 )
 
 func setupTestDB() (*sql.DB, error) {
@@ -104,6 +107,61 @@ func TestRepository(t *testing.T) {
 		}
 	})
 
+	// Test the sender and receiver are read back
+	t.Run("TestSenderAndReceiver", func(t *testing.T) {
+		n := &model.Notification{Sender: "alice", Receiver: "bob", Msg: "Wuphf"}
+		if _, err := repo.Post(ctx, "sender_chat_id", n); err != nil {
+			t.Fatalf("Error posting notification: %v\n", err)
+		}
+		retrieved, err := repo.Get(ctx, n.ID)
+		if err != nil {
+			t.Fatalf("Error getting notification: %v\n", err)
+		}
+		listed, err := repo.List(ctx, "sender_chat_id")
+		if err != nil || len(listed) != 1 {
+			t.Fatalf("Expected the notification, got %v, %v\n", listed, err)
+		}
+		for _, got := range []*model.Notification{retrieved, listed[0]} {
+			if got.Sender != "alice" || got.Receiver != "bob" {
+				t.Errorf("Expected alice to bob, got %s to %s\n", got.Sender, got.Receiver)
+			}
+		}
+	})
+
+	// Test deliveries
+	t.Run("TestDeliveries", func(t *testing.T) {
+		d := model.NewDelivery("1", "sms", "fake sms", "r1")
+		if err := repo.PutDelivery(ctx, d); err != nil {
+			t.Errorf("Error putting delivery: %v\n", err)
+		}
+		// Putting the delivery again updates it
+		d.Update(&model.DeliveryResult{ProviderID: "fake-1", Status: model.DeliverySent, ResponseCode: 202, Attempts: 1})
+		if err := repo.PutDelivery(ctx, d); err != nil {
+			t.Errorf("Error putting delivery: %v\n", err)
+		}
+		deliveries, err := repo.ListDeliveries(ctx, "1")
+		if err != nil {
+			t.Fatalf("Error listing deliveries: %v\n", err)
+		}
+		if len(deliveries) != 1 || deliveries[0].ProviderID != "fake-1" || deliveries[0].Status != model.DeliverySent || deliveries[0].ResponseCode != 202 || deliveries[0].Attempts != 1 {
+			t.Errorf("Unexpected deliveries: %v\n", deliveries)
+		}
+		deliveries, err = repo.ListChatDeliveries(ctx, chatID)
+		if err != nil {
+			t.Fatalf("Error listing chat deliveries: %v\n", err)
+		}
+		if len(deliveries) != 1 || deliveries[0].NotificationID != "1" {
+			t.Errorf("Unexpected chat deliveries: %v\n", deliveries)
+		}
+		got, err := repo.GetDeliveryByProviderID(ctx, "fake sms", "fake-1")
+		if err != nil || got.NotificationID != "1" || got.ReceiverID != "r1" {
+			t.Errorf("Unexpected delivery: %v, %v\n", got, err)
+		}
+		if _, err := repo.GetDeliveryByProviderID(ctx, "other", "fake-1"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
 	// Test List
 	t.Run("TestList", func(t *testing.T) {
 		expectedMessages := []string{"test message"}
@@ -186,4 +244,192 @@ func TestRepository(t *testing.T) {
 			}
 		}
 	})
+	// Test push subscriptions
+	t.Run("TestPushSubscriptions", func(t *testing.T) {
+		var sub usermodel.PushSubscription
+		sub.Endpoint = "https://push.example.com/send/abc"
+		sub.Keys.P256dh = "test_p256dh"
+		sub.Keys.Auth = "test_auth"
+		s, err := model.NewPushSubscription(userID, sub)
+		if err != nil {
+			t.Fatalf("Error creating push subscription: %v\n", err)
+		}
+		if err := repo.PostPushSubscription(ctx, s); err != nil {
+			t.Errorf("Error posting push subscription: %v\n", err)
+		}
+		// Subscribing the same browser again keeps the subscription id
+		again, _ := model.NewPushSubscription(userID, sub)
+		if err := repo.PostPushSubscription(ctx, again); err != nil {
+			t.Errorf("Error posting push subscription: %v\n", err)
+		}
+		if again.ID != s.ID {
+			t.Errorf("Expected subscription id %s, got %s\n", s.ID, again.ID)
+		}
+		subs, err := repo.ListPushSubscriptions(ctx, userID)
+		if err != nil {
+			t.Fatalf("Error listing push subscriptions: %v\n", err)
+		}
+		if len(subs) != 1 || subs[0].Endpoint != sub.Endpoint || subs[0].Auth != sub.Keys.Auth {
+			t.Errorf("Unexpected push subscriptions: %v", subs)
+		}
+		if err := repo.DeletePushSubscriptionByEndpoint(ctx, "other", sub.Endpoint); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+		if err := repo.DeletePushSubscription(ctx, s.ID); err != nil {
+			t.Errorf("Error deleting push subscription: %v\n", err)
+		}
+		if err := repo.DeletePushSubscription(ctx, s.ID); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test dead letters
+	t.Run("TestDeadLetters", func(t *testing.T) {
+		attempts := []*model.DeliveryResult{{Integration: "fake sms", Status: model.DeliveryFailed, Retryable: true, Error: "provider unavailable"}}
+		dl, err := model.NewDeadLetter("1", "fake sms", "r1", model.Recipient{UserID: userID, Channel: "sms", Address: "+14155550123"}, model.Envelope{ID: "1", Body: "test message"}, attempts)
+		if err != nil {
+			t.Fatalf("Error creating dead letter: %v\n", err)
+		}
+		if err := repo.PostDeadLetter(ctx, dl); err != nil {
+			t.Errorf("Error posting dead letter: %v\n", err)
+		}
+		got, err := repo.GetDeadLetter(ctx, dl.ID)
+		if err != nil {
+			t.Fatalf("Error getting dead letter: %v\n", err)
+		}
+		if got.To != dl.To || got.Msg.Body != dl.Msg.Body || len(got.Attempts) != 1 || *got.Attempts[0] != *attempts[0] {
+			t.Errorf("Expected dead letter %v, got %v\n", dl, got)
+		}
+		dls, err := repo.ListDeadLetters(ctx)
+		if err != nil || len(dls) != 1 || dls[0].ID != dl.ID {
+			t.Errorf("Expected dead letter %s, got %v, %v\n", dl.ID, dls, err)
+		}
+		if err := repo.DeleteDeadLetter(ctx, dl.ID); err != nil {
+			t.Errorf("Error deleting dead letter: %v\n", err)
+		}
+		if _, err := repo.GetDeadLetter(ctx, dl.ID); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test processed messages
+	t.Run("TestProcessed", func(t *testing.T) {
+		if processed, err := repo.IsProcessed(ctx, "m1"); err != nil || processed {
+			t.Errorf("Expected m1 not to be processed, got %v, %v\n", processed, err)
+		}
+		if err := repo.MarkProcessed(ctx, "m1"); err != nil {
+			t.Errorf("Error marking m1 processed: %v\n", err)
+		}
+		// Marking a message again is fine, it may have been redelivered
+		if err := repo.MarkProcessed(ctx, "m1"); err != nil {
+			t.Errorf("Error marking m1 processed: %v\n", err)
+		}
+		if processed, err := repo.IsProcessed(ctx, "m1"); err != nil || !processed {
+			t.Errorf("Expected m1 to be processed, got %v, %v\n", processed, err)
+		}
+	})
+
+	// Test idempotency records are scoped to their sender and pruned by age
+	t.Run("TestIdempotency", func(t *testing.T) {
+		now := time.Now()
+		rec := &model.IdempotencyRecord{Sender: "alice", Key: "k1", CreatedAt: now.Add(-time.Hour)}
+		if reserved, err := repo.ReserveIdempotencyKey(ctx, rec, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil || !reserved {
+			t.Fatalf("Expected the key to be reserved, got %v, %v\n", reserved, err)
+		}
+		// A pending key is held until it's abandoned
+		if reserved, err := repo.ReserveIdempotencyKey(ctx, rec, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil || reserved {
+			t.Errorf("Expected the pending key to be held, got %v, %v\n", reserved, err)
+		}
+		if err := repo.CompleteIdempotencyRecord(ctx, "alice", "k1", "n1"); err != nil {
+			t.Fatalf("Error completing record: %v\n", err)
+		}
+		got, err := repo.GetIdempotencyRecord(ctx, "alice", "k1")
+		if err != nil || got.Result != "n1" {
+			t.Errorf("Expected result n1, got %v, %v\n", got, err)
+		}
+		if _, err := repo.GetIdempotencyRecord(ctx, "bob", "k1"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+		// Completed keys are held until they expire, even once abandoned ones would be taken over
+		if reserved, err := repo.ReserveIdempotencyKey(ctx, rec, now.Add(-2*time.Hour), now); err != nil || reserved {
+			t.Errorf("Expected the completed key to be held, got %v, %v\n", reserved, err)
+		}
+		// Released keys are only removed while pending
+		if err := repo.ReleaseIdempotencyKey(ctx, "alice", "k1"); err != nil {
+			t.Fatalf("Error releasing key: %v\n", err)
+		}
+		if got, err := repo.GetIdempotencyRecord(ctx, "alice", "k1"); err != nil || got.Result != "n1" {
+			t.Errorf("Expected result n1, got %v, %v\n", got, err)
+		}
+		// Reserving a key again replaces the expired record
+		rec.CreatedAt = now
+		if reserved, err := repo.ReserveIdempotencyKey(ctx, rec, now.Add(-time.Minute), now.Add(-time.Minute)); err != nil || !reserved {
+			t.Fatalf("Expected the expired key to be reserved, got %v, %v\n", reserved, err)
+		}
+		if err := repo.CompleteIdempotencyRecord(ctx, "alice", "k1", "n2"); err != nil {
+			t.Fatalf("Error completing record: %v\n", err)
+		}
+		if err := repo.DeleteIdempotencyRecords(ctx, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("Error deleting records: %v\n", err)
+		}
+		if got, err := repo.GetIdempotencyRecord(ctx, "alice", "k1"); err != nil || got.Result != "n2" {
+			t.Errorf("Expected result n2, got %v, %v\n", got, err)
+		}
+		if err := repo.DeleteIdempotencyRecords(ctx, time.Now()); err != nil {
+			t.Fatalf("Error deleting records: %v\n", err)
+		}
+		if _, err := repo.GetIdempotencyRecord(ctx, "alice", "k1"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test notifications are posted once per message and receiver
+	t.Run("TestMessageID", func(t *testing.T) {
+		first := &model.Notification{Sender: "alice", Receiver: "bob", Msg: "Wuphf", MessageID: "m1"}
+		if _, err := repo.Post(ctx, "message_chat_id", first); err != nil {
+			t.Fatalf("Error posting notification: %v\n", err)
+		}
+		again := &model.Notification{Sender: "alice", Receiver: "bob", Msg: "Wuphf", MessageID: "m1"}
+		if _, err := repo.Post(ctx, "message_chat_id", again); err != nil || again.ID != first.ID {
+			t.Errorf("Expected notification %s, got %s, %v\n", first.ID, again.ID, err)
+		}
+		other := &model.Notification{Sender: "alice", Receiver: "carol", Msg: "Wuphf", MessageID: "m1"}
+		if _, err := repo.Post(ctx, "message_chat_id", other); err != nil || other.ID == first.ID {
+			t.Errorf("Expected a new notification, got %s, %v\n", other.ID, err)
+		}
+		if listed, err := repo.List(ctx, "message_chat_id"); err != nil || len(listed) != 2 {
+			t.Errorf("Expected 2 notifications, got %v, %v\n", listed, err)
+		}
+	})
+
+	// Test pending deliveries are listed along with their recipient and message
+	t.Run("TestPendingDeliveries", func(t *testing.T) {
+		queued := model.NewDelivery("pending", "sms", "fake sms", "r1")
+		queued.To = model.Recipient{UserID: "bob", Channel: "sms", Address: "+14155550123"}
+		queued.Msg = model.Envelope{ID: "pending", Body: "Wuphf"}
+		retrying := model.NewDelivery("pending", "sms", "fake sms", "r2")
+		retrying.Status = model.DeliveryRetrying
+		provider := model.NewDelivery("pending", "sms", "fake sms", "r3")
+		provider.ProviderID = "SM1"
+		for _, d := range []*model.Delivery{queued, retrying, provider} {
+			if err := repo.PutDelivery(ctx, d); err != nil {
+				t.Fatalf("Error putting delivery: %v\n", err)
+			}
+		}
+		pending, err := repo.ListPendingDeliveries(ctx)
+		if err != nil {
+			t.Fatalf("Error listing pending deliveries: %v\n", err)
+		}
+		receivers := map[string]*model.Delivery{}
+		for _, d := range pending {
+			receivers[d.ReceiverID] = d
+		}
+		if len(pending) != 2 || receivers["r1"] == nil || receivers["r2"] == nil {
+			t.Fatalf("Expected the queued and retrying deliveries, got %v\n", pending)
+		}
+		if got := receivers["r1"]; got.To != queued.To || got.Msg.Body != "Wuphf" {
+			t.Errorf("Expected the recipient and message, got %v\n", got)
+		}
+	})
+
 }
@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// IsProcessed reports whether the message with the given id was processed
+func (r *Repository) IsProcessed(ctx context.Context, messageID string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM processed_messages WHERE message_id = $1)
+	`
+	var processed bool
+	err := r.db.QueryRowContext(ctx, query, messageID).Scan(&processed)
+	return processed, err
+}
+
+// MarkProcessed records the message with the given id as processed
+func (r *Repository) MarkProcessed(ctx context.Context, messageID string) error {
+	query := `
+		INSERT INTO processed_messages (message_id, processed_at)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, query, messageID, time.Now())
+	return err
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/Azanul/wuphf-dot-com/notification/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/notification/pkg/model"
+)
+
+// PostPushSubscription adds a push subscription, a browser subscribing again replaces its previous
+// subscription and keeps its id
+func (r *Repository) PostPushSubscription(ctx context.Context, sub *model.PushSubscription) error {
+	query := `
+		INSERT INTO push_subscriptions (id, user_id, endpoint, p256dh, auth, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (endpoint) DO UPDATE SET user_id = $2, p256dh = $4, auth = $5
+		RETURNING id
+	`
+	return r.db.QueryRowContext(ctx, query, sub.ID, sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.CreatedAt).Scan(&sub.ID)
+}
+
+// ListPushSubscriptions returns the push subscriptions of a user
+func (r *Repository) ListPushSubscriptions(ctx context.Context, userID string) ([]*model.PushSubscription, error) {
+	query := `
+		SELECT id, user_id, endpoint, p256dh, auth, created_at FROM push_subscriptions WHERE user_id = $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*model.PushSubscription{}
+	for rows.Next() {
+		s := &model.PushSubscription{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Endpoint, &s.P256dh, &s.Auth, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// DeletePushSubscription removes a push subscription by id
+func (r *Repository) DeletePushSubscription(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM push_subscriptions WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// DeletePushSubscriptionByEndpoint removes the user's push subscription for an endpoint
+func (r *Repository) DeletePushSubscriptionByEndpoint(ctx context.Context, userID, endpoint string) error {
+	query := `
+		DELETE FROM push_subscriptions WHERE user_id = $1 AND endpoint = $2
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, endpoint)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
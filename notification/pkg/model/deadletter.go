@@ -0,0 +1,39 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// DeadLetter defines a delivery that failed for good, kept along with its original payload so it can be replayed
+type DeadLetter struct {
+	ID string `json:"id"`
+	// NotificationID is the notification the delivery belongs to, empty for account messages
+	NotificationID string    `json:"notification_id,omitempty"`
+	Integration    string    `json:"integration"`
+	ReceiverID     string    `json:"receiver_id,omitempty"`
+	To             Recipient `json:"to"`
+	Msg            Envelope  `json:"msg"`
+	// Attempts holds the result of every attempt, oldest first
+	Attempts  []*DeliveryResult `json:"attempts"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NewDeadLetter creates a dead letter for a delivery with the results of its attempts
+func NewDeadLetter(notificationID, integration, receiverID string, to Recipient, msg Envelope, attempts []*DeliveryResult) (*DeadLetter, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &DeadLetter{
+		ID:             hex.EncodeToString(b),
+		NotificationID: notificationID,
+		Integration:    integration,
+		ReceiverID:     receiverID,
+		To:             to,
+		Msg:            msg,
+		Attempts:       attempts,
+		CreatedAt:      time.Now(),
+	}, nil
+}
@@ -0,0 +1,168 @@
+package model
+
+import "time"
+
+// DeliveryStatus is the state of a delivery as reported by the integration's provider
+type DeliveryStatus string
+
+const (
+	// DeliveryQueued means the provider accepted the message and will deliver it later
+	DeliveryQueued DeliveryStatus = "queued"
+	// DeliveryRetrying means the latest attempt failed and the message will be tried again
+	DeliveryRetrying DeliveryStatus = "retrying"
+	// DeliverySent means the provider handed the message on to the recipient
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryDelivered means the provider confirmed the message reached the recipient's device
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryRead means the recipient has seen the message
+	DeliveryRead DeliveryStatus = "read"
+	// DeliveryFailed means the message could not be delivered, see DeliveryResult.Retryable
+	DeliveryFailed DeliveryStatus = "failed"
+	// DeliveryGone means the address no longer exists and must not be delivered to again
+	DeliveryGone DeliveryStatus = "gone"
+)
+
+// Recipient defines who a message is delivered to on an integration's channel
+type Recipient struct {
+	UserID string `json:"user_id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Channel is the kind of address, e.g. "sms", and matches the integration's channel
+	Channel string `json:"channel"`
+	Address string `json:"address"`
+	// Secret signs deliveries to webhook receivers, it's looked up again rather than stored along with the recipient
+	Secret string `json:"-"`
+}
+
+// Envelope defines a message to deliver along with what integrations need to render and thread it
+type Envelope struct {
+	// ID identifies the message, empty when it has none yet
+	ID     string `json:"id,omitempty"`
+	ChatID string `json:"chat_id,omitempty"`
+	Sender string `json:"sender,omitempty"`
+	// SenderName is the display name of the sender, empty for account messages
+	SenderName string `json:"sender_name,omitempty"`
+	// Type is the account event type for account messages, e.g. "password_reset", empty for chat messages
+	Type      string    `json:"type,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Text returns the body prefixed with the sender's name, for channels that can only carry plain text
+func (e Envelope) Text() string {
+	if e.SenderName == "" {
+		return e.Body
+	}
+	return e.SenderName + ": " + e.Body
+}
+
+// DeliveryResult defines the outcome of delivering a message to one recipient address
+type DeliveryResult struct {
+	Integration string `json:"integration"`
+	ReceiverID  string `json:"receiver_id,omitempty"`
+	// ProviderID is the provider's id for the message, e.g. a Twilio message SID
+	ProviderID string         `json:"provider_id,omitempty"`
+	Status     DeliveryStatus `json:"status"`
+	// ResponseCode is the HTTP status the provider answered with, for HTTP based integrations
+	ResponseCode int `json:"response_code,omitempty"`
+	// Retryable is set for failures that may succeed when tried again, e.g. provider outages
+	Retryable bool   `json:"retryable"`
+	Error     string `json:"error,omitempty"`
+	// Attempts is how many times the delivery was tried before this outcome
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// FailedDelivery creates the result of a delivery that failed with err
+func FailedDelivery(err error, retryable bool) *DeliveryResult {
+	return &DeliveryResult{Status: DeliveryFailed, Retryable: retryable, Error: err.Error()}
+}
+
+// Delivery defines the state of delivering a notification to one receiver through one integration
+type Delivery struct {
+	NotificationID string `json:"notification_id"`
+	// Channel is the kind of receiver the notification is delivered to, e.g. "sms"
+	Channel     string `json:"channel"`
+	Integration string `json:"integration"`
+	ReceiverID  string `json:"receiver_id,omitempty"`
+	// ProviderID is the provider's id for the message, e.g. a Twilio message SID
+	ProviderID string         `json:"provider_id,omitempty"`
+	Status     DeliveryStatus `json:"status"`
+	// ResponseCode is the HTTP status the provider answered the latest attempt with, for HTTP based integrations
+	ResponseCode int `json:"response_code,omitempty"`
+	// Attempts is how many times the delivery was tried
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// To and Msg are kept while the delivery is pending, to resume it after a restart
+	To  Recipient `json:"-"`
+	Msg Envelope  `json:"-"`
+}
+
+// NewDelivery creates the delivery of a notification that was queued for a receiver
+func NewDelivery(notificationID, channel, integration, receiverID string) *Delivery {
+	return &Delivery{
+		NotificationID: notificationID,
+		Channel:        channel,
+		Integration:    integration,
+		ReceiverID:     receiverID,
+		Status:         DeliveryQueued,
+		UpdatedAt:      time.Now(),
+	}
+}
+
+// Update sets the delivery's state from the outcome of its latest attempt
+func (d *Delivery) Update(res *DeliveryResult) {
+	d.ProviderID = res.ProviderID
+	d.Status = res.Status
+	d.ResponseCode = res.ResponseCode
+	d.Attempts = res.Attempts
+	d.Error = res.Error
+	d.UpdatedAt = time.Now()
+}
+
+// Pending reports whether the delivery is waiting for one of our workers, as opposed to the provider
+func (d *Delivery) Pending() bool {
+	return d.Status == DeliveryRetrying || (d.Status == DeliveryQueued && d.ProviderID == "")
+}
+
+// Advance moves the delivery to a status the provider reported later on, e.g. through a callback.
+// Callbacks can arrive out of order, so statuses that would move the delivery backwards are ignored
+// and false is returned.
+func (d *Delivery) Advance(status DeliveryStatus, errMsg string) bool {
+	if status == d.Status {
+		return false
+	}
+	failedInFlight := status == DeliveryFailed && (d.Status == DeliveryQueued || d.Status == DeliverySent)
+	if !failedInFlight && statusProgress[status] <= statusProgress[d.Status] {
+		return false
+	}
+	d.Status = status
+	d.Error = errMsg
+	d.UpdatedAt = time.Now()
+	return true
+}
+
+// statusProgress orders statuses by how far they got the message to the recipient
+var statusProgress = map[DeliveryStatus]int{
+	DeliveryFailed:    1,
+	DeliveryGone:      1,
+	DeliveryQueued:    2,
+	DeliveryRetrying:  2,
+	DeliverySent:      3,
+	DeliveryDelivered: 4,
+	DeliveryRead:      5,
+}
+
+// AggregateStatus returns the status of the delivery that got furthest, so a message counts as
+// delivered when it reached the recipient on any channel. It's empty when there are no deliveries.
+func AggregateStatus(deliveries []*Delivery) DeliveryStatus {
+	var status DeliveryStatus
+	for _, d := range deliveries {
+		if statusProgress[d.Status] > statusProgress[status] {
+			status = d.Status
+		}
+	}
+	if status == DeliveryGone {
+		return DeliveryFailed
+	}
+	return status
+}
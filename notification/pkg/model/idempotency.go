@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// IdempotencyRecord defines the result of a request made with an idempotency key, so
+// replays of the request get the original result instead of performing it again
+type IdempotencyRecord struct {
+	Sender string `json:"sender"`
+	Key    string `json:"key"`
+	// Result is empty while the request holding the key is in progress
+	Result    string    `json:"result"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,8 @@
+ALTER TABLE notifications
+ADD COLUMN message_id VARCHAR(255);
+
+CREATE UNIQUE INDEX notifications_message_id ON notifications (message_id, receiver);
+
+ALTER TABLE deliveries
+ADD COLUMN recipient TEXT NOT NULL DEFAULT '',
+ADD COLUMN message TEXT NOT NULL DEFAULT '';
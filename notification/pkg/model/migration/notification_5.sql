@@ -0,0 +1,10 @@
+CREATE TABLE dead_letters (
+    id VARCHAR(255) PRIMARY KEY,
+    notification_id VARCHAR(255) NOT NULL,
+    integration VARCHAR(255) NOT NULL,
+    receiver_id VARCHAR(255) NOT NULL,
+    recipient TEXT NOT NULL,
+    message TEXT NOT NULL,
+    attempts TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE deliveries (
+    notification_id VARCHAR(255) NOT NULL,
+    channel VARCHAR(255) NOT NULL,
+    integration VARCHAR(255) NOT NULL,
+    receiver_id VARCHAR(255) NOT NULL,
+    provider_id VARCHAR(255) NOT NULL,
+    status VARCHAR(255) NOT NULL,
+    attempts INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (notification_id, integration, receiver_id)
+);
+
+CREATE INDEX deliveries_provider_id ON deliveries (provider_id);
@@ -0,0 +1,4 @@
+CREATE TABLE processed_messages (
+    message_id VARCHAR(255) PRIMARY KEY,
+    processed_at TIMESTAMP NOT NULL
+);
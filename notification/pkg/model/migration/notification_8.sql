@@ -0,0 +1,7 @@
+CREATE TABLE idempotency_keys (
+    sender VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    result TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (sender, idempotency_key)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE deliveries
+ADD COLUMN response_code INTEGER NOT NULL DEFAULT 0;
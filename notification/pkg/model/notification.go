@@ -1,17 +1,21 @@
 package model
 
 type Notification struct {
-	Sender    string `json:"sender"`
-	Receiver  string `json:"receiver"`
-	Msg       string `json:"msg"`
-	Reference string `json:"reference"`
+	ID       string `json:"id"`
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Msg      string `json:"msg"`
+	// MessageID is the message the notification was posted for, a notification is posted once per
+	// message and receiver so redelivered messages return the stored one
+	MessageID string `json:"-"`
+	// Status is the aggregated status of the notification's deliveries
+	Status DeliveryStatus `json:"status,omitempty"`
 }
 
-func NewNotification(sender, receiver, msg, ref string) (*Notification, error) {
+func NewNotification(sender, receiver, msg string) (*Notification, error) {
 	return &Notification{
-		Sender:    sender,
-		Receiver:  receiver,
-		Msg:       msg,
-		Reference: ref,
+		Sender:   sender,
+		Receiver: receiver,
+		Msg:      msg,
 	}, nil
 }
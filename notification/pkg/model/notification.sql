@@ -4,11 +4,65 @@ CREATE TABLE notifications (
     sender VARCHAR(255),
     receiver VARCHAR(255),
     msg TEXT,
-    reference TEXT
+    reference TEXT,
+    message_id VARCHAR(255)
 );
 
+CREATE UNIQUE INDEX notifications_message_id ON notifications (message_id, receiver);
+
 CREATE TABLE user_chats (
     user_id VARCHAR(255) NOT NULL,
     chat_id VARCHAR(255) NOT NULL,
     PRIMARY KEY (user_id, chat_id)
 );
+
+CREATE TABLE push_subscriptions (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh VARCHAR(255) NOT NULL,
+    auth VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE dead_letters (
+    id VARCHAR(255) PRIMARY KEY,
+    notification_id VARCHAR(255) NOT NULL,
+    integration VARCHAR(255) NOT NULL,
+    receiver_id VARCHAR(255) NOT NULL,
+    recipient TEXT NOT NULL,
+    message TEXT NOT NULL,
+    attempts TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE deliveries (
+    notification_id VARCHAR(255) NOT NULL,
+    channel VARCHAR(255) NOT NULL,
+    integration VARCHAR(255) NOT NULL,
+    receiver_id VARCHAR(255) NOT NULL,
+    provider_id VARCHAR(255) NOT NULL,
+    status VARCHAR(255) NOT NULL,
+    response_code INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    recipient TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (notification_id, integration, receiver_id)
+);
+
+CREATE INDEX deliveries_provider_id ON deliveries (provider_id);
+
+CREATE TABLE processed_messages (
+    message_id VARCHAR(255) PRIMARY KEY,
+    processed_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE idempotency_keys (
+    sender VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    result TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (sender, idempotency_key)
+);
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	usermodel "github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PushSubscription defines a browser's Web Push subscription registered by a user
+type PushSubscription struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"p256dh"`
+	Auth      string    `json:"auth"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewPushSubscription creates a subscription after checking the endpoint is an https URL and the keys are present
+func NewPushSubscription(userID string, sub usermodel.PushSubscription) (*PushSubscription, error) {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("push endpoint must use https")
+	}
+	if sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return nil, errors.New("push subscription is missing its keys")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &PushSubscription{
+		ID:        hex.EncodeToString(b),
+		UserID:    userID,
+		Endpoint:  u.String(),
+		P256dh:    sub.Keys.P256dh,
+		Auth:      sub.Keys.Auth,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Address returns the subscription in the browser's JSON format, which is how push receivers are addressed
+func (s *PushSubscription) Address() string {
+	var sub usermodel.PushSubscription
+	sub.Endpoint = s.Endpoint
+	sub.Keys.P256dh = s.P256dh
+	sub.Keys.Auth = s.Auth
+	b, _ := json.Marshal(sub)
+	return string(b)
+}
@@ -0,0 +1,100 @@
+// Package webhook defines the payload Wuphf POSTs to webhook receivers and helps them verify its signature.
+//
+// Every request carries the unix time it was signed at in TimestampHeader and
+// "v1=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" in SignatureHeader.
+// Receivers should reject requests whose timestamp is too old to prevent replays.
+// Requests to each receiver are signed with its own secret, which is returned once when the receiver is added.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the request signature
+	SignatureHeader = "X-Wuphf-Signature"
+	// TimestampHeader carries the unix time the request was signed at
+	TimestampHeader = "X-Wuphf-Timestamp"
+	// DeliveryHeader carries a unique id of the delivery attempt
+	DeliveryHeader = "X-Wuphf-Delivery"
+
+	signatureVersion = "v1="
+)
+
+// DefaultTolerance is how old a signed request may be before Verify rejects it
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned when the signature is missing or doesn't match the body
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrExpired is returned when the timestamp is missing or outside the tolerance
+	ErrExpired = errors.New("webhook timestamp outside tolerance")
+)
+
+// Payload is the JSON body of a webhook request
+type Payload struct {
+	ID         string    `json:"id,omitempty"`
+	ChatID     string    `json:"chat_id,omitempty"`
+	Sender     string    `json:"sender,omitempty"`
+	SenderName string    `json:"sender_name,omitempty"`
+	Type       string    `json:"type,omitempty"`
+	Msg        string    `json:"msg"`
+	CreatedAt  time.Time `json:"created_at"`
+	Recipient  string    `json:"recipient"`
+}
+
+// Sign returns the signature of the body signed at the given time
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	return signatureVersion + hex.EncodeToString(mac(secret, strconv.FormatInt(timestamp.Unix(), 10), body))
+}
+
+// Verify checks the signature and timestamp header values against the body.
+// A tolerance of 0 uses DefaultTolerance.
+func Verify(secret []byte, signature, timestamp string, body []byte, tolerance time.Duration, now time.Time) error {
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrExpired
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return ErrExpired
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, signatureVersion))
+	if err != nil || !strings.HasPrefix(signature, signatureVersion) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(sig, mac(secret, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyRequest reads the body of a webhook request and returns it if the request is signed with the secret
+func VerifyRequest(r *http.Request, secret []byte, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(secret, r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), body, tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func mac(secret []byte, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
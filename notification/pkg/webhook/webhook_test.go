@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("test_secret")
+	body := []byte(`{"msg":"Wuphf"}`)
+	now := time.Now()
+	signature := Sign(secret, now, body)
+	timestamp := fmt.Sprint(now.Unix())
+
+	// Test a valid signature is accepted
+	t.Run("TestValid", func(t *testing.T) {
+		if err := Verify(secret, signature, timestamp, body, 0, now); err != nil {
+			t.Errorf("Error verifying signature: %v", err)
+		}
+	})
+
+	// Test tampering with the body, secret or timestamp is detected
+	t.Run("TestTampered", func(t *testing.T) {
+		if err := Verify(secret, signature, timestamp, []byte(`{"msg":"Wuphf!"}`), 0, now); err != ErrInvalidSignature {
+			t.Errorf("Expected %v, got %v", ErrInvalidSignature, err)
+		}
+		if err := Verify([]byte("other_secret"), signature, timestamp, body, 0, now); err != ErrInvalidSignature {
+			t.Errorf("Expected %v, got %v", ErrInvalidSignature, err)
+		}
+		if err := Verify(secret, signature, fmt.Sprint(now.Unix()-1), body, 0, now); err != ErrInvalidSignature {
+			t.Errorf("Expected %v, got %v", ErrInvalidSignature, err)
+		}
+		if err := Verify(secret, signature[len("v1="):], timestamp, body, 0, now); err != ErrInvalidSignature {
+			t.Errorf("Expected %v, got %v", ErrInvalidSignature, err)
+		}
+	})
+
+	// Test old requests are rejected to prevent replays
+	t.Run("TestExpired", func(t *testing.T) {
+		if err := Verify(secret, signature, timestamp, body, time.Minute, now.Add(2*time.Minute)); err != ErrExpired {
+			t.Errorf("Expected %v, got %v", ErrExpired, err)
+		}
+		if err := Verify(secret, signature, "", body, 0, now); err != ErrExpired {
+			t.Errorf("Expected %v, got %v", ErrExpired, err)
+		}
+	})
+}
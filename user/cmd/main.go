@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -13,6 +14,9 @@ import (
 	"github.com/Azanul/wuphf-dot-com/user/internal/controller/user"
 	grpchandler "github.com/Azanul/wuphf-dot-com/user/internal/handler/grpc"
 	httphandler "github.com/Azanul/wuphf-dot-com/user/internal/handler/http"
+	"github.com/Azanul/wuphf-dot-com/user/internal/idp"
+	"github.com/Azanul/wuphf-dot-com/user/internal/outbox"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
 	"github.com/IBM/sarama"
 
 	"google.golang.org/grpc"
@@ -23,6 +27,14 @@ import (
 func main() {
 	log.Println("Starting the user service")
 	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
+	verifyURL := os.Getenv("VERIFY_URL")
+	if verifyURL == "" {
+		verifyURL = "http://localhost:8080/auth/verify"
+	}
+	oauthRedirectBase := os.Getenv("OAUTH_REDIRECT_BASE")
+	if oauthRedirectBase == "" {
+		oauthRedirectBase = "http://localhost:8080/auth/oauth"
+	}
 
 	// Kafka producer setup
 	kafkaConfig := sarama.NewConfig()
@@ -42,8 +54,35 @@ func main() {
 		}
 	}()
 
+	keys, err := auth.LoadKeySet()
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
 	repo := memory.New()
-	ctrl := user.New(repo, kafkaProducer)
+	tokens := memory.NewTokenRepository()
+	attempts := memory.NewLoginAttemptRepository()
+	ctrl := user.New(repo, tokens, attempts, kafkaProducer, keys, verifyURL)
+
+	// The outbox relay publishes the events stored along with users, waiting for every acknowledgement
+	outboxConfig := sarama.NewConfig()
+	outboxConfig.Producer.RequiredAcks = sarama.WaitForAll
+	outboxConfig.Producer.Return.Successes = true
+	outboxProducer, err := sarama.NewSyncProducer(strings.Split(kafkaBrokers, ","), outboxConfig)
+	if err != nil {
+		log.Fatalf("Failed to start Kafka outbox producer: %v", err)
+	}
+	defer outboxProducer.Close()
+	go outbox.NewRelay(repo, outboxProducer).Run(context.Background())
+
+	providers, err := idp.LoadOIDCProviders(context.Background(), oauthRedirectBase)
+	if err != nil {
+		log.Fatalf("Failed to load identity providers: %v", err)
+	}
+	for _, p := range providers {
+		ctrl.RegisterProvider(p)
+		log.Printf("Identity provider %s enabled", p.Name())
+	}
 
 	h := httphandler.New(ctrl)
 	g := grpchandler.New(ctrl)
@@ -62,8 +101,18 @@ func main() {
 
 	// Endpoints
 	http.Handle("/user", http.HandlerFunc(h.User))
+	http.Handle("/user/receivers", http.HandlerFunc(h.Receivers))
+	http.Handle("/user/receivers/", http.HandlerFunc(h.Receivers))
 	http.Handle("/auth/register", http.HandlerFunc(h.Register))
 	http.Handle("/auth/login", http.HandlerFunc(h.Login))
+	http.Handle("/auth/login/mfa", http.HandlerFunc(h.LoginMFA))
+	http.Handle("/auth/mfa/", http.HandlerFunc(h.MFA))
+	http.Handle("/auth/oauth/", http.HandlerFunc(h.OAuth))
+	http.Handle("/auth/refresh", http.HandlerFunc(h.Refresh))
+	http.Handle("/auth/logout", http.HandlerFunc(h.Logout))
+	http.Handle("/auth/verify", http.HandlerFunc(h.Verify))
+	http.Handle("/auth/password/forgot", http.HandlerFunc(h.ForgotPassword))
+	http.Handle("/auth/password/reset", http.HandlerFunc(h.ResetPassword))
 
 	if err := http.ListenAndServe(":8081", nil); err != nil {
 		panic(err)
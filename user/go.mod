@@ -3,8 +3,11 @@ module github.com/Azanul/wuphf-dot-com/user
 go 1.21.3
 
 require (
+	github.com/Azanul/wuphf-dot-com/events v0.0.0-00010101000000-000000000000
+	github.com/coreos/go-oidc/v3 v3.10.0
 	github.com/google/uuid v1.6.0
 	golang.org/x/crypto v0.22.0
+	golang.org/x/oauth2 v0.18.0
 	google.golang.org/grpc v1.61.0
 	google.golang.org/protobuf v1.32.0
 )
@@ -15,6 +18,7 @@ require (
 	github.com/eapache/go-resiliency v1.6.0 // indirect
 	github.com/eapache/go-xerial-snappy v0.0.0-20230731223053-c322873962e3 // indirect
 	github.com/eapache/queue v1.1.0 // indirect
+	github.com/go-jose/go-jose/v4 v4.0.1 // indirect
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
@@ -27,6 +31,7 @@ require (
 	github.com/klauspost/compress v1.17.8 // indirect
 	github.com/pierrec/lz4/v4 v4.1.21 // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475 // indirect
+	google.golang.org/appengine v1.6.8 // indirect
 )
 
 require (
@@ -37,3 +42,5 @@ require (
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
 )
+
+replace github.com/Azanul/wuphf-dot-com/events => ../events
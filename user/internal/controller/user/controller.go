@@ -2,97 +2,273 @@ package user
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"time"
 
+	"github.com/Azanul/wuphf-dot-com/events"
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"github.com/Azanul/wuphf-dot-com/user/internal/idp"
 	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
 	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
 	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const (
+	// EmailVerificationEvent asks the notification service to email a verification link
+	EmailVerificationEvent = "email_verification"
+	// PasswordResetEvent asks the notification service to email a password reset code
+	PasswordResetEvent = "password_reset"
+	// ReceiverVerificationEvent asks the notification service to deliver a verification code to a new receiver
+	ReceiverVerificationEvent = "receiver_verification"
+)
+
+// maxBatchGetUsers caps how many users can be fetched at once
+const maxBatchGetUsers = 100
+
 type userRepository interface {
 	Get(ctx context.Context, id string) (*model.User, error)
-	Post(ctx context.Context, user *model.User) error
+	Post(ctx context.Context, user *model.User, events ...*model.OutboxEvent) error
 	GetIDbyEmail(ctx context.Context, email string) (string, error)
+	Verify(ctx context.Context, id string) error
+	UpdatePassword(ctx context.Context, id, password string) error
+	PostResetCode(ctx context.Context, code *model.ResetCode) error
+	GetResetCode(ctx context.Context, userID string) (*model.ResetCode, error)
+	IncrementResetCodeAttempts(ctx context.Context, userID string) error
+	DeleteResetCode(ctx context.Context, userID string) error
+	PostMFA(ctx context.Context, mfa *model.MFA) error
+	GetMFA(ctx context.Context, userID string) (*model.MFA, error)
+	EnableMFA(ctx context.Context, userID string) error
+	DeleteMFA(ctx context.Context, userID string) error
+	UseMFAStep(ctx context.Context, userID string, step int64) error
+	PostRecoveryCodes(ctx context.Context, userID string, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID, hash string) error
+	PostIdentity(ctx context.Context, identity *model.Identity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error)
+	PostOAuthState(ctx context.Context, state *model.OAuthState) error
+	ConsumeOAuthState(ctx context.Context, state string) (*model.OAuthState, error)
+	PostReceiver(ctx context.Context, receiver *model.Receiver) error
+	GetReceiver(ctx context.Context, id string) (*model.Receiver, error)
+	ListReceivers(ctx context.Context, userID string) ([]*model.Receiver, error)
+	UpdateReceiverAddress(ctx context.Context, id, address string) error
+	DeleteReceiver(ctx context.Context, id string) error
+	SetReceiverCode(ctx context.Context, id, hash string, expiresAt time.Time) error
+	IncrementReceiverCodeAttempts(ctx context.Context, id string) error
+	VerifyReceiver(ctx context.Context, id string) error
 }
 
 // Controller defines a user service controller
 type Controller struct {
 	repo          userRepository
+	tokens        tokenRepository
+	attempts      loginAttemptRepository
 	kafkaProducer sarama.AsyncProducer
+	keys          *auth.KeySet
+	verifyURL     string
+	now           func() time.Time
+	providers     map[string]idp.Provider
 }
 
-// New creates a user service controller
-func New(repo userRepository, kafkaProducer sarama.AsyncProducer) *Controller {
-	return &Controller{repo, kafkaProducer}
+// New creates a user service controller, verifyURL is the page email verification links point to
+func New(repo userRepository, tokens tokenRepository, attempts loginAttemptRepository, kafkaProducer sarama.AsyncProducer, keys *auth.KeySet, verifyURL string) *Controller {
+	return &Controller{repo, tokens, attempts, kafkaProducer, keys, verifyURL, time.Now, map[string]idp.Provider{}}
 }
 
 // Post new user
-func (c *Controller) Post(ctx context.Context, email, password string) (string, string, error) {
+func (c *Controller) Post(ctx context.Context, email, password string) (string, *Tokens, error) {
+	email, err := model.NormalizeReceiverAddress(model.ChannelEmail, email)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", repository.ErrInvalidReceiver, err)
+	}
 	user, err := model.NewUser(email, password)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
 	_, err = c.repo.GetIDbyEmail(ctx, email)
 	if err == nil {
-		return "", "", repository.ErrDuplicate
+		return "", nil, repository.ErrDuplicate
 	}
-	err = c.repo.Post(ctx, user)
+	registered, err := c.registeredEvent(user)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
-
-	message, err := json.Marshal(map[string]any{"sender": user.ID, "chat_id": "", "msg": "Wuphf"})
+	// The event is published by the outbox relay, it's only stored if the user is
+	err = c.repo.Post(ctx, user, registered)
 	if err != nil {
-		log.Fatalf("Failed to create json data: %v", err)
+		return "", nil, err
 	}
-	c.kafkaProducer.Input() <- &sarama.ProducerMessage{
-		Topic: "notifications",
-		Value: sarama.StringEncoder(message),
+
+	if err := c.requestVerification(user); err != nil {
+		return "", nil, err
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	tokens, err := c.newSession(ctx, user)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
 
-	return user.ID, token, nil
+	return user.ID, tokens, nil
 }
 
-// Get returns user by id
+// Get returns user by id along with their receivers
 func (c *Controller) Get(ctx context.Context, id string) (*model.User, error) {
 	res, err := c.repo.Get(ctx, id)
 	if err != nil && errors.Is(err, repository.ErrNotFound) {
 		return nil, repository.ErrNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
+	res.Receivers, err = c.repo.ListReceivers(ctx, id)
 	return res, err
 }
 
-// Login new user
-func (c *Controller) Login(ctx context.Context, email, password string) (string, string, error) {
-	id, err := c.repo.GetIDbyEmail(ctx, email)
+// Profile returns the public view of a user by id, without their receivers
+func (c *Controller) Profile(ctx context.Context, id string) (*model.User, error) {
+	res, err := c.repo.Get(ctx, id)
+	if err != nil && errors.Is(err, repository.ErrNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Receivers = nil
+	return res, nil
+}
+
+// BatchGet returns the users with the given ids, unknown ids are skipped
+func (c *Controller) BatchGet(ctx context.Context, ids []string) ([]*model.User, error) {
+	if len(ids) > maxBatchGetUsers {
+		return nil, repository.ErrBatchTooLarge
+	}
+	res := []*model.User{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		user, err := c.Get(ctx, id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, user)
+	}
+	return res, nil
+}
+
+// LookupByEmail returns the user registered with the email
+func (c *Controller) LookupByEmail(ctx context.Context, email string) (*model.User, error) {
+	id, err := c.repo.GetIDbyEmail(ctx, model.NormalizeEmail(email))
 	if err != nil {
-		return "", "", repository.ErrNotFound
+		return nil, err
+	}
+	return c.Get(ctx, id)
+}
+
+// Login existing user, ip identifies the client for brute-force protection.
+//
+// Users with two-factor authentication enabled only get an MFA challenge token,
+// which LoginMFA exchanges for a session together with a code.
+func (c *Controller) Login(ctx context.Context, email, password, ip string) (string, *Tokens, error) {
+	email = model.NormalizeEmail(email)
+	if err := c.checkLoginAllowed(ctx, email, ip); err != nil {
+		return "", nil, err
+	}
+
+	// Unknown emails fail like wrong passwords, so logins don't reveal which accounts exist
+	id, err := c.repo.GetIDbyEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		checkDummyPassword(password)
+		if err := c.recordLoginFailure(ctx, email, ip); err != nil {
+			return "", nil, err
+		}
+		return "", nil, repository.ErrInvalidCredentials
+	} else if err != nil {
+		return "", nil, err
 	}
 
 	user, err := c.repo.Get(ctx, id)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
-	hashed_password, err := model.HashPassword(password)
+	if !user.CheckPassword(password) {
+		if err := c.recordLoginFailure(ctx, email, ip); err != nil {
+			return "", nil, err
+		}
+		return "", nil, repository.ErrInvalidCredentials
+	}
+
+	// Failures are only reset once the second factor passed too, otherwise a
+	// stolen password would reset the lockout for guessing codes
+	challenge, err := c.mfaChallenge(ctx, user)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
+	}
+	if challenge != "" {
+		return user.ID, &Tokens{MFAChallenge: challenge}, nil
 	}
-	if user.Password == hashed_password {
-		return "", "", repository.ErrInvalidCredentials
+
+	if err := c.attempts.ResetLoginAttempts(ctx, accountKey(email)); err != nil {
+		return "", nil, err
+	}
+
+	tokens, err := c.newSession(ctx, user)
+	if err != nil {
+		return "", nil, err
 	}
 
-	token, err := auth.GenerateToken(id)
+	return user.ID, tokens, nil
+}
+
+// registeredEvent returns the outbox event announcing a new user, the notification service sends them the welcome Wuphf
+func (c *Controller) registeredEvent(user *model.User) (*model.OutboxEvent, error) {
+	event := &eventsv1.UserRegistered{
+		Id:        uuid.New().String(),
+		UserId:    user.ID,
+		Email:     user.Email,
+		CreatedAt: timestamppb.New(c.now()),
+	}
+	payload, err := events.Marshal(event)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
+	return model.NewOutboxEvent("notifications", events.Type(event), events.Version, payload, c.now()), nil
+}
+
+// publishAccountEvent asks the notification service to deliver an account message to the user's email
+func (c *Controller) publishAccountEvent(eventType string, user *model.User, msg string) error {
+	return c.publish(&eventsv1.AccountMessage{
+		Id:        uuid.New().String(),
+		Type:      eventType,
+		UserId:    user.ID,
+		Channel:   model.ChannelEmail,
+		Receiver:  user.Email,
+		Msg:       msg,
+		CreatedAt: timestamppb.New(c.now()),
+	})
+}
 
-	return user.ID, token, nil
+// publish sends the event to the notification service, headed with its type and schema version
+func (c *Controller) publish(event proto.Message) error {
+	payload, err := events.Marshal(event)
+	if err != nil {
+		return err
+	}
+	c.kafkaProducer.Input() <- &sarama.ProducerMessage{
+		Topic: "notifications",
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(events.TypeHeader), Value: []byte(events.Type(event))},
+			{Key: []byte(events.VersionHeader), Value: []byte(events.Version)},
+		},
+		Value: sarama.ByteEncoder(payload),
+	}
+	return nil
 }
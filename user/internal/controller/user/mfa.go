@@ -0,0 +1,193 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+const (
+	// mfaIssuer is the name authenticator apps list the account under
+	mfaIssuer = "Wuphf"
+	// recoveryCodeCount is how many recovery codes are issued when two-factor authentication is enabled
+	recoveryCodeCount = 10
+)
+
+// EnrollMFA generates a new TOTP secret for the user, returning it and the otpauth URI to scan.
+//
+// The secret only protects logins once ConfirmMFA proved the user's authenticator produces codes for it.
+func (c *Controller) EnrollMFA(ctx context.Context, userID string) (string, string, error) {
+	user, err := c.Get(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	mfa, err := c.repo.GetMFA(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return "", "", err
+	}
+	if mfa != nil && mfa.Enabled {
+		return "", "", repository.ErrDuplicate
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := c.repo.PostMFA(ctx, &model.MFA{UserID: userID, Secret: secret}); err != nil {
+		return "", "", err
+	}
+	return secret, auth.TOTPURI(mfaIssuer, user.Email, secret), nil
+}
+
+// ConfirmMFA enables two-factor authentication once the user proves their authenticator works,
+// returning the one-time recovery codes for when it is lost
+func (c *Controller) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	mfa, err := c.repo.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled {
+		return nil, repository.ErrDuplicate
+	}
+	if err := c.checkTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = generateRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(userID, codes[i])
+	}
+	if err := c.repo.PostRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	if err := c.repo.EnableMFA(ctx, userID); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA turns off two-factor authentication, the user proves they still hold a factor with a code or recovery code
+func (c *Controller) DisableMFA(ctx context.Context, userID, code string) error {
+	mfa, err := c.repo.GetMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if mfa.Enabled {
+		if err := c.checkSecondFactor(ctx, mfa, code); err != nil {
+			return err
+		}
+	}
+	return c.repo.DeleteMFA(ctx, userID)
+}
+
+// LoginMFA completes a login challenged for a second factor, code is either a TOTP code or a recovery code
+func (c *Controller) LoginMFA(ctx context.Context, challenge, code, ip string) (string, *Tokens, error) {
+	claims, err := auth.ParseMFAChallenge(challenge, c.keys.VerificationKeys())
+	if err != nil {
+		return "", nil, repository.ErrInvalidCredentials
+	}
+	if err := c.checkLoginAllowed(ctx, claims.Email, ip); err != nil {
+		return "", nil, err
+	}
+
+	mfa, err := c.repo.GetMFA(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", nil, repository.ErrInvalidCredentials
+		}
+		return "", nil, err
+	}
+	if err := c.checkSecondFactor(ctx, mfa, code); err != nil {
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			if err := c.recordLoginFailure(ctx, claims.Email, ip); err != nil {
+				return "", nil, err
+			}
+		}
+		return "", nil, err
+	}
+	if err := c.attempts.ResetLoginAttempts(ctx, accountKey(claims.Email)); err != nil {
+		return "", nil, err
+	}
+
+	user, err := c.Get(ctx, claims.UserID)
+	if err != nil {
+		return "", nil, err
+	}
+	tokens, err := c.newSession(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+	return user.ID, tokens, nil
+}
+
+// mfaChallenge returns a challenge token if the user has to complete a second factor to log in, or an empty string
+func (c *Controller) mfaChallenge(ctx context.Context, user *model.User) (string, error) {
+	mfa, err := c.repo.GetMFA(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !mfa.Enabled {
+		return "", nil
+	}
+	return c.keys.GenerateMFAChallenge(user)
+}
+
+// checkSecondFactor accepts a TOTP code, falling back to consuming a recovery code
+func (c *Controller) checkSecondFactor(ctx context.Context, mfa *model.MFA, code string) error {
+	if !mfa.Enabled {
+		return repository.ErrInvalidCredentials
+	}
+	err := c.checkTOTP(ctx, mfa, code)
+	if !errors.Is(err, repository.ErrInvalidCredentials) {
+		return err
+	}
+	if err := c.repo.UseRecoveryCode(ctx, mfa.UserID, hashRecoveryCode(mfa.UserID, code)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// checkTOTP validates a TOTP code, every code is accepted at most once
+func (c *Controller) checkTOTP(ctx context.Context, mfa *model.MFA, code string) error {
+	step, ok := auth.ValidateTOTP(mfa.Secret, code, c.now())
+	if !ok {
+		return repository.ErrInvalidCredentials
+	}
+	if err := c.repo.UseMFAStep(ctx, mfa.UserID, step); err != nil {
+		if errors.Is(err, repository.ErrTokenReused) {
+			return repository.ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func hashRecoveryCode(userID, code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return auth.HashToken(userID + ":" + code)
+}
@@ -0,0 +1,135 @@
+package user
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+func TestMFA(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+
+	repo := memory.New()
+	ctrl := New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), nil, auth.NewKeySet(key), "")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctrl.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	user, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(ctx, user); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+
+	var secret string
+	var recoveryCodes []string
+	code := func() string {
+		c, err := auth.GenerateTOTP(secret, now)
+		if err != nil {
+			t.Fatalf("Error generating code: %v", err)
+		}
+		return c
+	}
+
+	// Test enrolling and confirming a second factor
+	t.Run("TestEnroll", func(t *testing.T) {
+		var uri string
+		secret, uri, err = ctrl.EnrollMFA(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error enrolling MFA: %v", err)
+		}
+		if uri == "" {
+			t.Errorf("Expected otpauth URI")
+		}
+
+		if _, err := ctrl.ConfirmMFA(ctx, user.ID, "000000"); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+		recoveryCodes, err = ctrl.ConfirmMFA(ctx, user.ID, code())
+		if err != nil {
+			t.Fatalf("Error confirming MFA: %v", err)
+		}
+		if len(recoveryCodes) != recoveryCodeCount {
+			t.Errorf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+		}
+		if _, _, err := ctrl.EnrollMFA(ctx, user.ID); err != repository.ErrDuplicate {
+			t.Errorf("Expected %v, got %v", repository.ErrDuplicate, err)
+		}
+	})
+
+	// Test login requires the second factor
+	t.Run("TestLogin", func(t *testing.T) {
+		_, tokens, err := ctrl.Login(ctx, user.Email, "password", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Error logging in: %v", err)
+		}
+		if tokens.AccessToken != "" || tokens.MFAChallenge == "" {
+			t.Fatalf("Expected only an MFA challenge, got %v", tokens)
+		}
+		if _, err := ctrl.ValidateToken(ctx, tokens.MFAChallenge); err == nil {
+			t.Errorf("Expected MFA challenge to be rejected as access token")
+		}
+
+		// The code used to confirm enrollment is spent
+		if _, _, err := ctrl.LoginMFA(ctx, tokens.MFAChallenge, code(), "127.0.0.1"); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+
+		now = now.Add(auth.TOTPPeriod)
+		id, session, err := ctrl.LoginMFA(ctx, tokens.MFAChallenge, code(), "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Error completing login: %v", err)
+		}
+		if id != user.ID || session.AccessToken == "" || session.RefreshToken == "" {
+			t.Errorf("Unexpected login result: %s %v", id, session)
+		}
+		if _, err := ctrl.ValidateToken(ctx, session.AccessToken); err != nil {
+			t.Errorf("Error validating access token: %v", err)
+		}
+	})
+
+	// Test recovery codes are single use
+	t.Run("TestRecoveryCode", func(t *testing.T) {
+		_, tokens, err := ctrl.Login(ctx, user.Email, "password", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Error logging in: %v", err)
+		}
+		if _, _, err := ctrl.LoginMFA(ctx, tokens.MFAChallenge, recoveryCodes[0], "127.0.0.1"); err != nil {
+			t.Errorf("Error logging in with recovery code: %v", err)
+		}
+		if _, _, err := ctrl.LoginMFA(ctx, tokens.MFAChallenge, recoveryCodes[0], "127.0.0.1"); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+	})
+
+	// Test disabling the second factor
+	t.Run("TestDisable", func(t *testing.T) {
+		now = now.Add(auth.TOTPPeriod)
+		if err := ctrl.DisableMFA(ctx, user.ID, code()); err != nil {
+			t.Fatalf("Error disabling MFA: %v", err)
+		}
+		_, tokens, err := ctrl.Login(ctx, user.Email, "password", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Error logging in: %v", err)
+		}
+		if tokens.AccessToken == "" || tokens.MFAChallenge != "" {
+			t.Errorf("Expected a session without MFA, got %v", tokens)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/idp"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// oauthStateTTL is how long a user has to complete a login at the identity provider
+const oauthStateTTL = 10 * time.Minute
+
+// RegisterProvider makes an identity provider available for logins
+func (c *Controller) RegisterProvider(p idp.Provider) {
+	c.providers[p.Name()] = p
+}
+
+// StartOAuth begins a login with an identity provider, returning the URL to send the user to and the state
+// the browser has to keep, e.g. in a cookie, and present to CompleteOAuth
+func (c *Controller) StartOAuth(ctx context.Context, provider string) (string, string, error) {
+	p, ok := c.providers[provider]
+	if !ok {
+		return "", "", repository.ErrNotFound
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := randomToken()
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = v
+	}
+	state := &model.OAuthState{
+		State:     values[0],
+		Provider:  provider,
+		Nonce:     values[1],
+		Verifier:  values[2],
+		ExpiresAt: time.Now().Add(oauthStateTTL),
+	}
+	if err := c.repo.PostOAuthState(ctx, state); err != nil {
+		return "", "", err
+	}
+	return p.AuthCodeURL(state.State, state.Nonce, state.Verifier), state.State, nil
+}
+
+// CompleteOAuth finishes a login with an identity provider, creating or linking the user the provider vouches for.
+//
+// The state the provider returned has to match the one the browser kept when the login started, which binds the
+// login to that browser, so nobody can complete their own login in a victim's browser and log them into it.
+//
+// Like Login, users with two-factor authentication enabled only get an MFA challenge token.
+func (c *Controller) CompleteOAuth(ctx context.Context, provider, state, browserState, code string) (string, *Tokens, error) {
+	p, ok := c.providers[provider]
+	if !ok {
+		return "", nil, repository.ErrNotFound
+	}
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return "", nil, repository.ErrInvalidCredentials
+	}
+	stored, err := c.repo.ConsumeOAuthState(ctx, state)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", nil, repository.ErrInvalidCredentials
+		}
+		return "", nil, err
+	}
+	if stored.Provider != provider || time.Now().After(stored.ExpiresAt) {
+		return "", nil, repository.ErrInvalidCredentials
+	}
+
+	identity, err := p.Exchange(ctx, code, stored.Nonce, stored.Verifier)
+	if err != nil {
+		log.Printf("Identity provider %s exchange error: %v\n", provider, err)
+		return "", nil, repository.ErrInvalidCredentials
+	}
+	user, err := c.identityUser(ctx, provider, identity)
+	if err != nil {
+		return "", nil, err
+	}
+
+	challenge, err := c.mfaChallenge(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+	if challenge != "" {
+		return user.ID, &Tokens{MFAChallenge: challenge}, nil
+	}
+
+	tokens, err := c.newSession(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+	return user.ID, tokens, nil
+}
+
+// identityUser returns the user linked to an external identity, linking or creating one by email on first login
+func (c *Controller) identityUser(ctx context.Context, provider string, identity *idp.Identity) (*model.User, error) {
+	linked, err := c.repo.GetIdentity(ctx, provider, identity.Subject)
+	if err == nil {
+		return c.Get(ctx, linked.UserID)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	email := model.NormalizeEmail(identity.Email)
+	if email == "" || !identity.EmailVerified {
+		return nil, repository.ErrUnverifiedEmail
+	}
+
+	var user *model.User
+	id, err := c.repo.GetIDbyEmail(ctx, email)
+	switch {
+	case err == nil:
+		if user, err = c.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		// Whoever registered an unverified address first could have set the
+		// password, linking it would let them into the provider user's account
+		if !user.Verified {
+			return nil, repository.ErrDuplicate
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		if user, err = model.NewExternalUser(email); err != nil {
+			return nil, err
+		}
+		user.Verified = true
+		for _, r := range user.Receivers {
+			r.Verified = true
+		}
+		registered, err := c.registeredEvent(user)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.repo.Post(ctx, user, registered); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = c.repo.PostIdentity(ctx, &model.Identity{
+		Provider:  provider,
+		Subject:   identity.Subject,
+		UserID:    user.ID,
+		Email:     email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// randomToken returns an unguessable URL safe token, long enough to serve as a PKCE code verifier
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,187 @@
+package user
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/url"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/idp"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"github.com/IBM/sarama/mocks"
+)
+
+// fakeProvider vouches for whichever identity is set, issuing the state as the code
+type fakeProvider struct {
+	identity *idp.Identity
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state)
+}
+
+func (p *fakeProvider) Exchange(_ context.Context, code, nonce, verifier string) (*idp.Identity, error) {
+	i := *p.identity
+	return &i, nil
+}
+
+func TestOAuth(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+
+	producer := mocks.NewAsyncProducer(t, nil)
+	defer producer.Close()
+	repo := memory.New()
+	ctrl := New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), producer, auth.NewKeySet(key), "")
+	provider := &fakeProvider{}
+	ctrl.RegisterProvider(provider)
+
+	ctx := context.Background()
+	login := func() (string, *Tokens, error) {
+		authURL, browserState, err := ctrl.StartOAuth(ctx, provider.Name())
+		if err != nil {
+			t.Fatalf("Error starting OAuth: %v", err)
+		}
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatalf("Error parsing authorization URL: %v", err)
+		}
+		state := u.Query().Get("state")
+		return ctrl.CompleteOAuth(ctx, provider.Name(), state, browserState, state)
+	}
+
+	var userID string
+
+	// Test the first login creates a verified user
+	t.Run("TestNewUser", func(t *testing.T) {
+		provider.identity = &idp.Identity{Subject: "subject1", Email: "user1@example.com", EmailVerified: true}
+		id, tokens, err := login()
+		if err != nil {
+			t.Fatalf("Error completing OAuth: %v", err)
+		}
+		if tokens.AccessToken == "" {
+			t.Errorf("Expected a session, got %v", tokens)
+		}
+		u, err := ctrl.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Error retrieving user: %v", err)
+		}
+		if u.Email != "user1@example.com" || !u.Verified {
+			t.Errorf("Unexpected user: %v", u)
+		}
+		if pending, err := repo.ListOutbox(ctx, 10); err != nil || len(pending) != 1 || pending[0].Type != "UserRegistered" {
+			t.Errorf("Expected the user registered event in the outbox, got %v, %v", pending, err)
+		}
+		userID = id
+	})
+
+	// Test later logins find the linked user even if the email changed
+	t.Run("TestLinkedUser", func(t *testing.T) {
+		provider.identity = &idp.Identity{Subject: "subject1", Email: "renamed@example.com", EmailVerified: true}
+		id, _, err := login()
+		if err != nil {
+			t.Fatalf("Error completing OAuth: %v", err)
+		}
+		if id != userID {
+			t.Errorf("Expected user %s, got %s", userID, id)
+		}
+	})
+
+	// Test unverified password accounts are not linked
+	t.Run("TestUnverifiedAccount", func(t *testing.T) {
+		u, err := model.NewUser("user2@example.com", "password")
+		if err != nil {
+			t.Fatalf("Error creating user: %v", err)
+		}
+		if err := repo.Post(ctx, u); err != nil {
+			t.Fatalf("Error posting user: %v", err)
+		}
+		provider.identity = &idp.Identity{Subject: "subject2", Email: u.Email, EmailVerified: true}
+		if _, _, err := login(); err != repository.ErrDuplicate {
+			t.Errorf("Expected %v, got %v", repository.ErrDuplicate, err)
+		}
+
+		if err := repo.Verify(ctx, u.ID); err != nil {
+			t.Fatalf("Error verifying user: %v", err)
+		}
+		id, _, err := login()
+		if err != nil {
+			t.Fatalf("Error completing OAuth: %v", err)
+		}
+		if id != u.ID {
+			t.Errorf("Expected user %s, got %s", u.ID, id)
+		}
+	})
+
+	// Test provider emails are matched to accounts whatever their case
+	t.Run("TestEmailCase", func(t *testing.T) {
+		provider.identity = &idp.Identity{Subject: "subject4", Email: " User2@Example.COM", EmailVerified: true}
+		id, err := repo.GetIDbyEmail(ctx, "user2@example.com")
+		if err != nil {
+			t.Fatalf("Error retrieving user: %v", err)
+		}
+		if linked, _, err := login(); err != nil || linked != id {
+			t.Errorf("Expected user %s, got %s, %v", id, linked, err)
+		}
+	})
+
+	// Test emails the provider didn't verify are rejected
+	t.Run("TestUnverifiedEmail", func(t *testing.T) {
+		provider.identity = &idp.Identity{Subject: "subject3", Email: "user3@example.com"}
+		if _, _, err := login(); err != repository.ErrUnverifiedEmail {
+			t.Errorf("Expected %v, got %v", repository.ErrUnverifiedEmail, err)
+		}
+	})
+
+	// Test states are single use
+	t.Run("TestStateReuse", func(t *testing.T) {
+		provider.identity = &idp.Identity{Subject: "subject1", Email: "user1@example.com", EmailVerified: true}
+		authURL, _, err := ctrl.StartOAuth(ctx, provider.Name())
+		if err != nil {
+			t.Fatalf("Error starting OAuth: %v", err)
+		}
+		u, _ := url.Parse(authURL)
+		state := u.Query().Get("state")
+		if _, _, err := ctrl.CompleteOAuth(ctx, provider.Name(), state, state, "code"); err != nil {
+			t.Fatalf("Error completing OAuth: %v", err)
+		}
+		if _, _, err := ctrl.CompleteOAuth(ctx, provider.Name(), state, state, "code"); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+	})
+
+	// Test logins only complete in the browser that started them
+	t.Run("TestBrowserBinding", func(t *testing.T) {
+		provider.identity = &idp.Identity{Subject: "subject1", Email: "user1@example.com", EmailVerified: true}
+		authURL, browserState, err := ctrl.StartOAuth(ctx, provider.Name())
+		if err != nil {
+			t.Fatalf("Error starting OAuth: %v", err)
+		}
+		u, _ := url.Parse(authURL)
+		state := u.Query().Get("state")
+		_, otherState, err := ctrl.StartOAuth(ctx, provider.Name())
+		if err != nil {
+			t.Fatalf("Error starting OAuth: %v", err)
+		}
+		for _, victimState := range []string{"", otherState} {
+			if _, _, err := ctrl.CompleteOAuth(ctx, provider.Name(), state, victimState, "code"); err != repository.ErrInvalidCredentials {
+				t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+			}
+		}
+		if _, _, err := ctrl.CompleteOAuth(ctx, provider.Name(), state, browserState, "code"); err != nil {
+			t.Errorf("Error completing OAuth in the browser that started it: %v", err)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+const (
+	// resetCodeDigits is the length of password reset codes
+	resetCodeDigits = 8
+	// resetCodeTTL is how long a password reset code is valid for
+	resetCodeTTL = 15 * time.Minute
+	// maxResetCodeAttempts is how many wrong guesses invalidate a password reset code
+	maxResetCodeAttempts = 5
+)
+
+// ForgotPassword emails the user a one-time code to reset their password with.
+//
+// Unknown emails are ignored so the response doesn't reveal which accounts exist.
+func (c *Controller) ForgotPassword(ctx context.Context, email string) error {
+	id, err := c.repo.GetIDbyEmail(ctx, model.NormalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	user, err := c.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	code, err := generateCode(resetCodeDigits)
+	if err != nil {
+		return err
+	}
+	err = c.repo.PostResetCode(ctx, &model.ResetCode{
+		UserID:    user.ID,
+		Hash:      hashResetCode(user.ID, code),
+		ExpiresAt: time.Now().Add(resetCodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.publishAccountEvent(PasswordResetEvent, user, fmt.Sprintf("Your Wuphf password reset code is %s, it expires in %d minutes", code, int(resetCodeTTL.Minutes())))
+}
+
+// ResetPassword sets a new password if the reset code matches, ending every existing session
+func (c *Controller) ResetPassword(ctx context.Context, email, code, password string) error {
+	id, err := c.repo.GetIDbyEmail(ctx, model.NormalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.ErrInvalidCredentials
+		}
+		return err
+	}
+	stored, err := c.repo.GetResetCode(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.ErrInvalidCredentials
+		}
+		return err
+	}
+	if time.Now().After(stored.ExpiresAt) || stored.Attempts >= maxResetCodeAttempts {
+		if err := c.repo.DeleteResetCode(ctx, id); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		return repository.ErrInvalidCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hashResetCode(id, code))) != 1 {
+		if err := c.repo.IncrementResetCodeAttempts(ctx, id); err != nil {
+			return err
+		}
+		return repository.ErrInvalidCredentials
+	}
+
+	// Deleting the code first makes it single use even if resets race
+	if err := c.repo.DeleteResetCode(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.ErrInvalidCredentials
+		}
+		return err
+	}
+	hashed, err := model.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := c.repo.UpdatePassword(ctx, id, hashed); err != nil {
+		return err
+	}
+	if err := c.attempts.ResetLoginAttempts(ctx, accountKey(email)); err != nil {
+		return err
+	}
+	return c.tokens.RevokeUserSessions(ctx, id)
+}
+
+// generateCode returns a random numeric code of the given length
+func generateCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+func hashResetCode(userID, code string) string {
+	return auth.HashToken(userID + ":" + code)
+}
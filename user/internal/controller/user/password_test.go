@@ -0,0 +1,65 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+func TestResetPassword(t *testing.T) {
+	ctrl, repo := newTestController(t)
+	ctx := context.Background()
+	user, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(ctx, user); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+
+	// The user is logged in on two devices
+	var sessions []*Tokens
+	for i := 0; i < 2; i++ {
+		_, tokens, err := ctrl.Login(ctx, user.Email, "password", "192.0.2.1")
+		if err != nil {
+			t.Fatalf("Error logging in: %v", err)
+		}
+		sessions = append(sessions, tokens)
+	}
+
+	err = repo.PostResetCode(ctx, &model.ResetCode{UserID: user.ID, Hash: hashResetCode(user.ID, "123456"), ExpiresAt: time.Now().Add(resetCodeTTL)})
+	if err != nil {
+		t.Fatalf("Error posting reset code: %v", err)
+	}
+	if err := ctrl.ResetPassword(ctx, user.Email, "654321", "new password"); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for a wrong code, got %v", repository.ErrInvalidCredentials, err)
+	}
+	if err := ctrl.ResetPassword(ctx, user.Email, "123456", "new password"); err != nil {
+		t.Fatalf("Error resetting password: %v", err)
+	}
+
+	// Test the reset ends every existing session
+	for _, tokens := range sessions {
+		if _, _, err := ctrl.Refresh(ctx, tokens.RefreshToken); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v for the refresh token, got %v", repository.ErrInvalidCredentials, err)
+		}
+		if _, err := ctrl.ValidateToken(ctx, tokens.AccessToken); err != auth.ErrInvalidToken {
+			t.Errorf("Expected %v for the access token, got %v", auth.ErrInvalidToken, err)
+		}
+	}
+
+	// Test only the new password logs in, and the code can't be used again
+	if _, _, err := ctrl.Login(ctx, user.Email, "password", "192.0.2.1"); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for the old password, got %v", repository.ErrInvalidCredentials, err)
+	}
+	if _, _, err := ctrl.Login(ctx, user.Email, "new password", "192.0.2.1"); err != nil {
+		t.Errorf("Error logging in with the new password: %v", err)
+	}
+	if err := ctrl.ResetPassword(ctx, user.Email, "123456", "another password"); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for a used code, got %v", repository.ErrInvalidCredentials, err)
+	}
+}
@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// receiverCodeDigits is the length of receiver verification codes
+	receiverCodeDigits = 6
+	// receiverCodeTTL is how long a receiver verification code is valid for
+	receiverCodeTTL = 15 * time.Minute
+	// maxReceiverCodeAttempts is how many wrong guesses invalidate a receiver verification code
+	maxReceiverCodeAttempts = 5
+)
+
+// ListReceivers returns the receivers of a user
+func (c *Controller) ListReceivers(ctx context.Context, userID string) ([]*model.Receiver, error) {
+	return c.repo.ListReceivers(ctx, userID)
+}
+
+// AddReceiver adds a channel to notify the user on and sends a verification code through it
+func (c *Controller) AddReceiver(ctx context.Context, userID, channel, address string) (*model.Receiver, error) {
+	receiver, err := model.NewReceiver(userID, channel, address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", repository.ErrInvalidReceiver, err)
+	}
+	if err := c.repo.PostReceiver(ctx, receiver); err != nil {
+		return nil, err
+	}
+	if err := c.sendReceiverCode(ctx, receiver); err != nil {
+		return nil, err
+	}
+	return receiver, nil
+}
+
+// UpdateReceiver changes the address of a receiver, it has to be verified again before it is used
+func (c *Controller) UpdateReceiver(ctx context.Context, userID, id, address string) (*model.Receiver, error) {
+	receiver, err := c.getReceiver(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	address, err = model.NormalizeReceiverAddress(receiver.Channel, address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", repository.ErrInvalidReceiver, err)
+	}
+	if address == receiver.Address {
+		return receiver, nil
+	}
+	if err := c.repo.UpdateReceiverAddress(ctx, id, address); err != nil {
+		return nil, err
+	}
+	receiver.Address, receiver.Verified = address, false
+	if err := c.sendReceiverCode(ctx, receiver); err != nil {
+		return nil, err
+	}
+	return receiver, nil
+}
+
+// DeleteReceiver removes a receiver of the user
+func (c *Controller) DeleteReceiver(ctx context.Context, userID, id string) error {
+	if _, err := c.getReceiver(ctx, userID, id); err != nil {
+		return err
+	}
+	return c.repo.DeleteReceiver(ctx, id)
+}
+
+// VerifyReceiver marks a receiver as verified if the code sent through it matches
+func (c *Controller) VerifyReceiver(ctx context.Context, userID, id, code string) (*model.Receiver, error) {
+	receiver, err := c.getReceiver(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if receiver.Verified {
+		return nil, repository.ErrTokenReused
+	}
+	if receiver.CodeHash == "" || time.Now().After(receiver.CodeExpiresAt) || receiver.CodeAttempts >= maxReceiverCodeAttempts {
+		return nil, repository.ErrInvalidCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(receiver.CodeHash), []byte(hashReceiverCode(id, code))) != 1 {
+		if err := c.repo.IncrementReceiverCodeAttempts(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, repository.ErrInvalidCredentials
+	}
+	if err := c.repo.VerifyReceiver(ctx, id); err != nil {
+		return nil, err
+	}
+	receiver.Verified = true
+	return receiver, nil
+}
+
+// ResendReceiverCode sends a new verification code to an unverified receiver
+func (c *Controller) ResendReceiverCode(ctx context.Context, userID, id string) error {
+	receiver, err := c.getReceiver(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if receiver.Verified {
+		return repository.ErrTokenReused
+	}
+	return c.sendReceiverCode(ctx, receiver)
+}
+
+// getReceiver returns the receiver if it belongs to the user
+func (c *Controller) getReceiver(ctx context.Context, userID, id string) (*model.Receiver, error) {
+	receiver, err := c.repo.GetReceiver(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if receiver.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return receiver, nil
+}
+
+// sendReceiverCode asks the notification service to deliver a new verification code through the receiver
+func (c *Controller) sendReceiverCode(ctx context.Context, receiver *model.Receiver) error {
+	code, err := generateCode(receiverCodeDigits)
+	if err != nil {
+		return err
+	}
+	if err := c.repo.SetReceiverCode(ctx, receiver.ID, hashReceiverCode(receiver.ID, code), time.Now().Add(receiverCodeTTL)); err != nil {
+		return err
+	}
+
+	return c.publish(&eventsv1.AccountMessage{
+		Id:        uuid.New().String(),
+		Type:      ReceiverVerificationEvent,
+		UserId:    receiver.UserID,
+		Channel:   receiver.Channel,
+		Receiver:  receiver.Address,
+		Msg:       fmt.Sprintf("Your Wuphf verification code is %s, it expires in %d minutes", code, int(receiverCodeTTL.Minutes())),
+		CreatedAt: timestamppb.New(c.now()),
+	})
+}
+
+func hashReceiverCode(receiverID, code string) string {
+	return auth.HashToken(receiverID + ":" + code)
+}
@@ -0,0 +1,207 @@
+package user
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/events"
+	eventsv1 "github.com/Azanul/wuphf-dot-com/events/gen/v1"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestReceivers(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	defer producer.Close()
+	repo := memory.New()
+	ctrl := New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), producer, auth.NewKeySet(key), "")
+
+	ctx := context.Background()
+	user, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(ctx, user); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+
+	// readCode returns the verification code carried by the next published event
+	readCode := func() string {
+		msg := <-producer.Successes()
+		b, err := msg.Value.Encode()
+		if err != nil {
+			t.Fatalf("Error encoding message: %v", err)
+		}
+		headers := map[string]string{}
+		for _, h := range msg.Headers {
+			headers[string(h.Key)] = string(h.Value)
+		}
+		e, err := events.Unmarshal(headers[events.TypeHeader], headers[events.VersionHeader], b)
+		if err != nil {
+			t.Fatalf("Error unmarshaling event: %v", err)
+		}
+		event, ok := e.(*eventsv1.AccountMessage)
+		if !ok || event.Type != ReceiverVerificationEvent {
+			t.Fatalf("Unexpected event %v", e)
+		}
+		prefix := "Your Wuphf verification code is "
+		return event.Msg[len(prefix) : len(prefix)+receiverCodeDigits]
+	}
+
+	// Test registration seeds the email receiver
+	t.Run("TestEmailReceiver", func(t *testing.T) {
+		u, err := ctrl.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error retrieving user: %v", err)
+		}
+		if len(u.Receivers) != 1 || u.Receivers[0].Channel != model.ChannelEmail || u.Receivers[0].Address != user.Email {
+			t.Errorf("Expected the email receiver, got %v", u.Receivers)
+		}
+		if p := model.UserToProto(u); len(p.Receivers) != 1 || p.Receivers[0].Address != user.Email {
+			t.Errorf("Expected receivers in proto, got %v", p.Receivers)
+		}
+	})
+
+	// Test the public profile does not expose receivers
+	t.Run("TestProfile", func(t *testing.T) {
+		u, err := ctrl.Profile(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error retrieving profile: %v", err)
+		}
+		if u.ID != user.ID || len(u.Receivers) != 0 {
+			t.Errorf("Expected profile without receivers, got %v", u)
+		}
+		if _, err := ctrl.Profile(ctx, "unknown"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test webhook receivers get their own secret to verify deliveries with
+	t.Run("TestWebhookSecret", func(t *testing.T) {
+		secrets := map[string]bool{}
+		for _, address := range []string{"https://example.com/hook1", "https://example.com/hook2"} {
+			producer.ExpectInputAndSucceed()
+			receiver, err := ctrl.AddReceiver(ctx, user.ID, model.ChannelWebhook, address)
+			if err != nil {
+				t.Fatalf("Error adding receiver: %v", err)
+			}
+			readCode()
+			if len(receiver.Secret) != 64 {
+				t.Errorf("Expected a secret, got %q", receiver.Secret)
+			}
+			if p := model.ReceiverToProto(receiver); p.Secret != receiver.Secret {
+				t.Errorf("Expected the secret in proto, got %q", p.Secret)
+			}
+			secrets[receiver.Secret] = true
+		}
+		if len(secrets) != 2 {
+			t.Errorf("Expected a secret per receiver, got %v", secrets)
+		}
+		producer.ExpectInputAndSucceed()
+		receiver, err := ctrl.AddReceiver(ctx, user.ID, model.ChannelSMS, "+14155550100")
+		if err != nil {
+			t.Fatalf("Error adding receiver: %v", err)
+		}
+		readCode()
+		if receiver.Secret != "" {
+			t.Errorf("Expected no secret for an SMS receiver, got %q", receiver.Secret)
+		}
+	})
+
+	// Test invalid addresses are rejected
+	t.Run("TestInvalidReceiver", func(t *testing.T) {
+		cases := map[string]string{
+			model.ChannelSMS:   "555-0123",
+			model.ChannelSlack: "https://example.com/hook",
+			model.ChannelPush:  `{"endpoint": "https://push.example.com/1"}`,
+			"pigeon":           "coo",
+		}
+		for channel, address := range cases {
+			if _, err := ctrl.AddReceiver(ctx, user.ID, channel, address); !errors.Is(err, repository.ErrInvalidReceiver) {
+				t.Errorf("Expected %v for %s %s, got %v", repository.ErrInvalidReceiver, channel, address, err)
+			}
+		}
+	})
+
+	// Test adding and verifying a receiver
+	t.Run("TestVerifyReceiver", func(t *testing.T) {
+		producer.ExpectInputAndSucceed()
+		receiver, err := ctrl.AddReceiver(ctx, user.ID, model.ChannelSMS, "+1 (415) 555-0123")
+		if err != nil {
+			t.Fatalf("Error adding receiver: %v", err)
+		}
+		code := readCode()
+		if receiver.Address != "+14155550123" || receiver.Verified {
+			t.Errorf("Unexpected receiver: %v", receiver)
+		}
+
+		if _, err := ctrl.VerifyReceiver(ctx, "other_user", receiver.ID, code); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+		}
+		if _, err := ctrl.VerifyReceiver(ctx, user.ID, receiver.ID, "wrong"); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+		if receiver, err = ctrl.VerifyReceiver(ctx, user.ID, receiver.ID, code); err != nil {
+			t.Fatalf("Error verifying receiver: %v", err)
+		}
+		if !receiver.Verified {
+			t.Errorf("Expected receiver to be verified")
+		}
+
+		// Changing the address needs verification again
+		producer.ExpectInputAndSucceed()
+		if receiver, err = ctrl.UpdateReceiver(ctx, user.ID, receiver.ID, "+14155550124"); err != nil {
+			t.Fatalf("Error updating receiver: %v", err)
+		}
+		readCode()
+		if receiver.Verified {
+			t.Errorf("Expected updated receiver to be unverified")
+		}
+
+		if err := ctrl.DeleteReceiver(ctx, user.ID, receiver.ID); err != nil {
+			t.Errorf("Error deleting receiver: %v", err)
+		}
+	})
+
+	// Test codes stop working after too many wrong guesses
+	t.Run("TestReceiverCodeAttempts", func(t *testing.T) {
+		producer.ExpectInputAndSucceed()
+		receiver, err := ctrl.AddReceiver(ctx, user.ID, model.ChannelWebhook, "https://example.com/hook")
+		if err != nil {
+			t.Fatalf("Error adding receiver: %v", err)
+		}
+		code := readCode()
+		for i := 0; i < maxReceiverCodeAttempts; i++ {
+			ctrl.VerifyReceiver(ctx, user.ID, receiver.ID, "wrong")
+		}
+		if _, err := ctrl.VerifyReceiver(ctx, user.ID, receiver.ID, code); err != repository.ErrInvalidCredentials {
+			t.Errorf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+
+		producer.ExpectInputAndSucceed()
+		if err := ctrl.ResendReceiverCode(ctx, user.ID, receiver.ID); err != nil {
+			t.Fatalf("Error resending code: %v", err)
+		}
+		code = readCode()
+		if _, err := ctrl.VerifyReceiver(ctx, user.ID, receiver.ID, code); err != nil {
+			t.Errorf("Error verifying receiver: %v", err)
+		}
+	})
+}
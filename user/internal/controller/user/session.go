@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"github.com/google/uuid"
+)
+
+type tokenRepository interface {
+	PostRefreshToken(ctx context.Context, token *model.RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (*model.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, hash string) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID string) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	ListRevokedSessions(ctx context.Context, since time.Time) ([]*model.RevokedSession, error)
+}
+
+// Tokens defines the tokens issued for a session, or the challenge to complete before one is issued
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	MFAChallenge string
+}
+
+// Refresh exchanges a refresh token for a new pair of tokens in the same session.
+//
+// Refresh tokens are single use, presenting one a second time means it leaked,
+// so the whole session is revoked.
+func (c *Controller) Refresh(ctx context.Context, refreshToken string) (string, *Tokens, error) {
+	hash := auth.HashToken(refreshToken)
+	stored, err := c.tokens.GetRefreshToken(ctx, hash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", nil, repository.ErrInvalidCredentials
+		}
+		return "", nil, err
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return "", nil, repository.ErrInvalidCredentials
+	}
+	revoked, err := c.tokens.IsSessionRevoked(ctx, stored.SessionID)
+	if err != nil {
+		return "", nil, err
+	}
+	if revoked {
+		return "", nil, repository.ErrInvalidCredentials
+	}
+
+	if err := c.tokens.UseRefreshToken(ctx, hash); err != nil {
+		if errors.Is(err, repository.ErrTokenReused) {
+			if err := c.tokens.RevokeSession(ctx, stored.SessionID); err != nil {
+				return "", nil, err
+			}
+			return "", nil, repository.ErrInvalidCredentials
+		}
+		return "", nil, err
+	}
+
+	user, err := c.Get(ctx, stored.UserID)
+	if err != nil {
+		return "", nil, err
+	}
+	tokens, err := c.issueTokens(ctx, user, stored.SessionID)
+	if err != nil {
+		return "", nil, err
+	}
+	return user.ID, tokens, nil
+}
+
+// Logout revokes the session the refresh token belongs to
+func (c *Controller) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := c.tokens.GetRefreshToken(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.ErrInvalidCredentials
+		}
+		return err
+	}
+	return c.tokens.RevokeSession(ctx, stored.SessionID)
+}
+
+// LogoutToken revokes the session the access token belongs to
+func (c *Controller) LogoutToken(ctx context.Context, accessToken string) error {
+	claims, err := auth.ParseToken(accessToken, c.keys.VerificationKeys())
+	if err != nil {
+		return repository.ErrInvalidCredentials
+	}
+	return c.tokens.RevokeSession(ctx, claims.SessionID)
+}
+
+// ValidateToken returns the user the token was issued to
+func (c *Controller) ValidateToken(ctx context.Context, token string) (*model.User, error) {
+	claims, err := auth.ParseToken(token, c.keys.VerificationKeys())
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := c.tokens.IsSessionRevoked(ctx, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, auth.ErrInvalidToken
+	}
+	return c.Get(ctx, claims.UserID)
+}
+
+// SigningKeys returns the keys tokens can currently be verified with
+func (c *Controller) SigningKeys() []auth.VerificationKey {
+	return c.keys.VerificationKeys()
+}
+
+// RevokedSessions returns sessions revoked after the given time
+func (c *Controller) RevokedSessions(ctx context.Context, since time.Time) ([]*model.RevokedSession, error) {
+	return c.tokens.ListRevokedSessions(ctx, since)
+}
+
+// newSession issues the tokens for a new session of the user
+func (c *Controller) newSession(ctx context.Context, user *model.User) (*Tokens, error) {
+	return c.issueTokens(ctx, user, uuid.New().String())
+}
+
+func (c *Controller) issueTokens(ctx context.Context, user *model.User, sessionID string) (*Tokens, error) {
+	accessToken, err := c.keys.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = c.tokens.PostRefreshToken(ctx, &model.RefreshToken{
+		Hash:      hash,
+		SessionID: sessionID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
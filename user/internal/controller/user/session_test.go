@@ -0,0 +1,76 @@
+package user
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// newTestController creates a controller backed by memory repositories, signing with a fresh key
+func newTestController(t *testing.T) (*Controller, *memory.Repository) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+	repo := memory.New()
+	return New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), nil, auth.NewKeySet(key), ""), repo
+}
+
+func TestRefresh(t *testing.T) {
+	ctrl, repo := newTestController(t)
+	ctx := context.Background()
+	user, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(ctx, user); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+
+	_, first, err := ctrl.Login(ctx, user.Email, "password", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Error logging in: %v", err)
+	}
+
+	// Test refresh tokens rotate within the session
+	_, second, err := ctrl.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatalf("Expected a new refresh token")
+	}
+	if _, err := ctrl.ValidateToken(ctx, second.AccessToken); err != nil {
+		t.Fatalf("Error validating the refreshed token: %v", err)
+	}
+
+	// Test presenting a rotated refresh token again revokes the whole family
+	if _, _, err := ctrl.Refresh(ctx, first.RefreshToken); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for the reused token, got %v", repository.ErrInvalidCredentials, err)
+	}
+	if _, _, err := ctrl.Refresh(ctx, second.RefreshToken); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for the newer token of the family, got %v", repository.ErrInvalidCredentials, err)
+	}
+	if _, err := ctrl.ValidateToken(ctx, second.AccessToken); err != auth.ErrInvalidToken {
+		t.Errorf("Expected %v for the family's access token, got %v", auth.ErrInvalidToken, err)
+	}
+
+	// Test other sessions of the user are left alone
+	_, other, err := ctrl.Login(ctx, user.Email, "password", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Error logging in: %v", err)
+	}
+	if _, _, err := ctrl.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("Error refreshing another session: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+const (
+	// loginFailureWindow is how long a failed login counts towards a lockout
+	loginFailureWindow = 15 * time.Minute
+	// maxAccountFailures is how many failed logins an account allows before locking
+	maxAccountFailures = 5
+	// maxIPFailures is how many failed logins a client address allows before locking
+	maxIPFailures = 20
+	// baseLockout is the first lockout, every further failure doubles it
+	baseLockout = 30 * time.Second
+	// maxLockout caps the lockout
+	maxLockout = time.Hour
+)
+
+type loginAttemptRepository interface {
+	GetLoginAttempts(ctx context.Context, key string) (*model.LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, key string, at, windowStart time.Time) (*model.LoginAttempts, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+func accountKey(email string) string { return "account:" + model.NormalizeEmail(email) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+var (
+	dummyPasswordOnce sync.Once
+	dummyPassword     string
+)
+
+// checkDummyPassword spends as long as checking a password of an existing account,
+// so failed logins of unknown emails can't be told apart by their timing
+func checkDummyPassword(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPassword, _ = model.HashPassword("wuphf")
+	})
+	(&model.User{Password: dummyPassword}).CheckPassword(password)
+}
+
+// checkLoginAllowed returns repository.ErrAccountLocked if the account or client address is locked out
+func (c *Controller) checkLoginAllowed(ctx context.Context, email, ip string) error {
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		a, err := c.attempts.GetLoginAttempts(ctx, key)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		if time.Now().Before(a.LockedUntil) {
+			return repository.ErrAccountLocked
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login against the account and client address, locking them out past their limits
+func (c *Controller) recordLoginFailure(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	limits := map[string]int{accountKey(email): maxAccountFailures, ipKey(ip): maxIPFailures}
+	for key, limit := range limits {
+		a, err := c.attempts.RecordLoginFailure(ctx, key, now, now.Add(-loginFailureWindow))
+		if err != nil {
+			return err
+		}
+		if a.Failures >= limit {
+			if err := c.attempts.LockLogin(ctx, key, now.Add(lockoutDuration(a.Failures-limit))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockoutDuration doubles the lockout for every failure past the limit
+func lockoutDuration(excess int) time.Duration {
+	d := baseLockout
+	for i := 0; i < excess && d < maxLockout; i++ {
+		d *= 2
+	}
+	if d > maxLockout {
+		d = maxLockout
+	}
+	return d
+}
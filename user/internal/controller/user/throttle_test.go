@@ -0,0 +1,61 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+func TestLogin(t *testing.T) {
+	ctrl, repo := newTestController(t)
+	ctx := context.Background()
+	user, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(ctx, user); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+
+	// Test the password is checked against its bcrypt hash, whatever the case of the email
+	if user.Password == "password" {
+		t.Fatalf("Expected the password to be hashed")
+	}
+	id, tokens, err := ctrl.Login(ctx, " Test@Example.com ", "password", "192.0.2.1")
+	if err != nil || id != user.ID || tokens.AccessToken == "" {
+		t.Fatalf("Expected to log in, got %s, %v, %v", id, tokens, err)
+	}
+
+	// Test unknown emails fail like wrong passwords
+	if _, _, err := ctrl.Login(ctx, user.Email, "wrong", "192.0.2.1"); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for a wrong password, got %v", repository.ErrInvalidCredentials, err)
+	}
+	if _, _, err := ctrl.Login(ctx, "unknown@example.com", "password", "192.0.2.1"); err != repository.ErrInvalidCredentials {
+		t.Errorf("Expected %v for an unknown email, got %v", repository.ErrInvalidCredentials, err)
+	}
+
+	// Test failures with case variants of the email count towards the same lockout, which holds
+	// even for the right password
+	for _, email := range []string{"TEST@example.com", "test@EXAMPLE.com", " test@example.com", "Test@example.com"} {
+		if _, _, err := ctrl.Login(ctx, email, "wrong", "192.0.2.2"); err != repository.ErrInvalidCredentials {
+			t.Fatalf("Expected %v, got %v", repository.ErrInvalidCredentials, err)
+		}
+	}
+	if _, _, err := ctrl.Login(ctx, user.Email, "password", "192.0.2.3"); err != repository.ErrAccountLocked {
+		t.Errorf("Expected %v, got %v", repository.ErrAccountLocked, err)
+	}
+	if _, _, err := ctrl.Login(ctx, "TEST@EXAMPLE.COM", "password", "192.0.2.3"); err != repository.ErrAccountLocked {
+		t.Errorf("Expected %v, got %v", repository.ErrAccountLocked, err)
+	}
+
+	// Test the client address is locked out past its own limit, across accounts
+	for i := 0; i < maxIPFailures; i++ {
+		ctrl.Login(ctx, fmt.Sprintf("unknown%d@example.com", i), "wrong", "192.0.2.4")
+	}
+	if _, _, err := ctrl.Login(ctx, "other@example.com", "password", "192.0.2.4"); err != repository.ErrAccountLocked {
+		t.Errorf("Expected %v, got %v", repository.ErrAccountLocked, err)
+	}
+}
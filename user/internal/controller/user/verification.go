@@ -0,0 +1,63 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// requestVerification asks the notification service to email the user a verification link
+func (c *Controller) requestVerification(user *model.User) error {
+	token, err := c.keys.GenerateVerificationToken(user)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(c.verifyURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	return c.publishAccountEvent(EmailVerificationEvent, user, "Verify your Wuphf account: "+link.String())
+}
+
+// Verify marks the email the verification token was issued for as verified.
+//
+// A token can only be used while the account is unverified, so it is single use.
+func (c *Controller) Verify(ctx context.Context, token string) (string, error) {
+	claims, err := auth.ParseVerificationToken(token, c.keys.VerificationKeys())
+	if err != nil {
+		return "", repository.ErrInvalidCredentials
+	}
+	user, err := c.Get(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", repository.ErrInvalidCredentials
+		}
+		return "", err
+	}
+	if user.Email != claims.Email {
+		return "", repository.ErrInvalidCredentials
+	}
+	if user.Verified {
+		return "", repository.ErrTokenReused
+	}
+	if err := c.repo.Verify(ctx, user.ID); err != nil {
+		return "", err
+	}
+	// The link reached the account email, so it is verified as a receiver too
+	for _, r := range user.Receivers {
+		if r.Channel == model.ChannelEmail && r.Address == user.Email && !r.Verified {
+			if err := c.repo.VerifyReceiver(ctx, r.ID); err != nil {
+				return "", err
+			}
+		}
+	}
+	return user.ID, nil
+}
@@ -2,14 +2,21 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/Azanul/wuphf-dot-com/user/gen"
 	"github.com/Azanul/wuphf-dot-com/user/internal/controller/user"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
-
-	"github.com/golang-jwt/jwt"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// signingKeysMaxAge is how long clients may cache the published signing keys
+const signingKeysMaxAge = 5 * time.Minute
+
 // Handler defines a user gRPC handler
 type Handler struct {
 	gen.UnimplementedAuthServiceServer
@@ -23,30 +30,86 @@ func New(ctrl *user.Controller) *Handler {
 
 // ValidateToken validates a JWT token
 func (h *Handler) ValidateToken(ctx context.Context, req *gen.TokenRequest) (*gen.TokenResponse, error) {
-	tokenString := req.GetToken()
+	user, err := h.ctrl.ValidateToken(ctx, req.GetToken())
+	if err != nil {
+		return &gen.TokenResponse{Valid: false}, err
+	}
+
+	return &gen.TokenResponse{Valid: true, User: model.UserToProto(user)}, nil
+}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
+// GetSigningKeys publishes the keys tokens can be verified with
+func (h *Handler) GetSigningKeys(_ context.Context, _ *gen.SigningKeysRequest) (*gen.SigningKeysResponse, error) {
+	resp := &gen.SigningKeysResponse{MaxAge: int64(signingKeysMaxAge.Seconds())}
+	for _, k := range h.ctrl.SigningKeys() {
+		der, err := k.MarshalPublicKey()
+		if err != nil {
+			return nil, err
 		}
-		return auth.JWTKey, nil
-	})
+		resp.Keys = append(resp.Keys, &gen.SigningKey{Kid: k.ID, Alg: k.Algorithm, Key: der})
+	}
+	return resp, nil
+}
+
+// ListRevokedSessions publishes the sessions revoked since the requested unix time
+func (h *Handler) ListRevokedSessions(ctx context.Context, req *gen.RevokedSessionsRequest) (*gen.RevokedSessionsResponse, error) {
+	sessions, err := h.ctrl.RevokedSessions(ctx, time.Unix(req.GetSince(), 0))
 	if err != nil {
-		return &gen.TokenResponse{Valid: false}, err
+		return nil, err
 	}
 
-	if token.Valid {
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := claims["user_id"].(string)
+	resp := &gen.RevokedSessionsResponse{TokenTtl: int64(auth.AccessTokenTTL.Seconds())}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, &gen.RevokedSession{SessionId: s.SessionID, RevokedAt: s.RevokedAt.Unix()})
+	}
+	return resp, nil
+}
 
-			user, err := h.ctrl.Get(ctx, userID)
-			if err != nil {
-				return &gen.TokenResponse{Valid: false}, err
-			}
+// GetUser returns a user by id
+func (h *Handler) GetUser(ctx context.Context, req *gen.GetUserRequest) (*gen.UserResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	u, err := h.ctrl.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &gen.UserResponse{User: model.UserToProto(u)}, nil
+}
 
-			return &gen.TokenResponse{Valid: true, User: &gen.User{Id: user.ID, Email: user.Email}}, nil
-		}
+// BatchGetUsers returns the users with the requested ids, unknown ids are left out of the response
+func (h *Handler) BatchGetUsers(ctx context.Context, req *gen.BatchGetUsersRequest) (*gen.BatchGetUsersResponse, error) {
+	users, err := h.ctrl.BatchGet(ctx, req.GetIds())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &gen.BatchGetUsersResponse{}
+	for _, u := range users {
+		resp.Users = append(resp.Users, model.UserToProto(u))
 	}
+	return resp, nil
+}
 
-	return &gen.TokenResponse{Valid: false}, nil
+// LookupByEmail returns the user registered with the requested email
+func (h *Handler) LookupByEmail(ctx context.Context, req *gen.LookupByEmailRequest) (*gen.UserResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	u, err := h.ctrl.LookupByEmail(ctx, req.GetEmail())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &gen.UserResponse{User: model.UserToProto(u)}, nil
+}
+
+// toStatus maps controller errors to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrBatchTooLarge):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
 }
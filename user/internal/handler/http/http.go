@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"github.com/Azanul/wuphf-dot-com/user/internal/controller/user"
 	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
 )
 
 // Handler defines a user HTTP handler
@@ -35,18 +38,18 @@ func (h *Handler) User(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		if m, err = h.ctrl.Get(ctx, id); err == nil {
+		if m, err = h.ctrl.Profile(ctx, id); err == nil {
 			w.WriteHeader(http.StatusOK)
 		}
 	case http.MethodPost:
-		var token string
+		var tokens *user.Tokens
 		email := req.FormValue("email")
 		password := req.FormValue("password")
-		m, token, err = h.ctrl.Post(ctx, email, password)
+		m, tokens, err = h.ctrl.Post(ctx, email, password)
 		if err == nil {
-			w.Header().Add("AUTHORIZATION", token)
+			w.Header().Add("AUTHORIZATION", tokens.AccessToken)
 			w.WriteHeader(http.StatusCreated)
-			m = map[string]string{"user_id": m.(string)}
+			m = map[string]string{"user_id": m.(string), "refresh_token": tokens.RefreshToken}
 		}
 	}
 
@@ -56,6 +59,89 @@ func (h *Handler) User(w http.ResponseWriter, req *http.Request) {
 		} else if errors.Is(err, repository.ErrDuplicate) {
 			m = "user already exists"
 			w.WriteHeader(http.StatusBadRequest)
+		} else if errors.Is(err, repository.ErrInvalidReceiver) {
+			m = "invalid email"
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// addedReceiver is the response to adding a receiver, the only one showing the secret of webhook receivers
+type addedReceiver struct {
+	*model.Receiver
+	Secret string `json:"secret,omitempty"`
+}
+
+// Receivers handles requests of the authenticated user under /user/receivers:
+// GET and POST /user/receivers, PUT and DELETE /user/receivers/{id},
+// POST /user/receivers/{id}/verify and POST /user/receivers/{id}/resend
+func (h *Handler) Receivers(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	u, err := h.ctrl.ValidateToken(ctx, req.Header.Get("Authorization"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(req.URL.Path, "/user/receivers"), "/"), "/")
+
+	switch {
+	case id == "" && req.Method == http.MethodGet:
+		if m, err = h.ctrl.ListReceivers(ctx, u.ID); err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+	case id == "" && req.Method == http.MethodPost:
+		var receiver *model.Receiver
+		if receiver, err = h.ctrl.AddReceiver(ctx, u.ID, req.FormValue("channel"), req.FormValue("address")); err == nil {
+			w.WriteHeader(http.StatusCreated)
+			m = addedReceiver{receiver, receiver.Secret}
+		}
+	case id != "" && action == "" && req.Method == http.MethodPut:
+		if m, err = h.ctrl.UpdateReceiver(ctx, u.ID, id, req.FormValue("address")); err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+	case id != "" && action == "" && req.Method == http.MethodDelete:
+		if err = h.ctrl.DeleteReceiver(ctx, u.ID, id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case id != "" && action == "verify" && req.Method == http.MethodPost:
+		if m, err = h.ctrl.VerifyReceiver(ctx, u.ID, id, req.FormValue("code")); err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+	case id != "" && action == "resend" && req.Method == http.MethodPost:
+		if err = h.ctrl.ResendReceiverCode(ctx, u.ID, id); err == nil {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, repository.ErrInvalidReceiver) {
+			m = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else if errors.Is(err, repository.ErrDuplicate) {
+			m = "receiver already exists"
+			w.WriteHeader(http.StatusConflict)
+		} else if errors.Is(err, repository.ErrInvalidCredentials) {
+			m = "invalid or expired verification code"
+			w.WriteHeader(http.StatusBadRequest)
+		} else if errors.Is(err, repository.ErrTokenReused) {
+			m = "receiver already verified"
+			w.WriteHeader(http.StatusConflict)
 		} else {
 			log.Printf("Repository get error: %v\n", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -76,14 +162,14 @@ func (h *Handler) Register(w http.ResponseWriter, req *http.Request) {
 
 	switch req.Method {
 	case http.MethodPost:
-		var token string
+		var tokens *user.Tokens
 		email := req.FormValue("email")
 		password := req.FormValue("password")
-		m, token, err = h.ctrl.Post(ctx, email, password)
+		m, tokens, err = h.ctrl.Post(ctx, email, password)
 		if err == nil {
-			w.Header().Add("AUTHORIZATION", token)
+			w.Header().Add("AUTHORIZATION", tokens.AccessToken)
 			w.WriteHeader(http.StatusCreated)
-			m = map[string]string{"user_id": m.(string)}
+			m = map[string]string{"user_id": m.(string), "refresh_token": tokens.RefreshToken}
 		}
 	}
 
@@ -93,6 +179,9 @@ func (h *Handler) Register(w http.ResponseWriter, req *http.Request) {
 		} else if errors.Is(err, repository.ErrDuplicate) {
 			m = "user already exists"
 			w.WriteHeader(http.StatusBadRequest)
+		} else if errors.Is(err, repository.ErrInvalidReceiver) {
+			m = "invalid email"
+			w.WriteHeader(http.StatusBadRequest)
 		} else {
 			log.Printf("Repository get error: %v\n", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -113,20 +202,131 @@ func (h *Handler) Login(w http.ResponseWriter, req *http.Request) {
 
 	switch req.Method {
 	case http.MethodPost:
-		var token string
+		var tokens *user.Tokens
 		email := req.FormValue("email")
 		password := req.FormValue("password")
-		m, token, err = h.ctrl.Login(ctx, email, password)
+		m, tokens, err = h.ctrl.Login(ctx, email, password, clientIP(req))
+		if err == nil && tokens.MFAChallenge != "" {
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"user_id": m.(string), "status": "mfa_required", "challenge_token": tokens.MFAChallenge}
+		} else if err == nil {
+			w.Header().Add("AUTHORIZATION", tokens.AccessToken)
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"user_id": m.(string), "refresh_token": tokens.RefreshToken}
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, repository.ErrInvalidCredentials) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if errors.Is(err, repository.ErrAccountLocked) {
+			m = "too many failed login attempts, try again later"
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// LoginMFA handles POST /auth/login/mfa requests, exchanging an MFA challenge token and code for a session
+func (h *Handler) LoginMFA(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodPost:
+		var tokens *user.Tokens
+		challenge := req.FormValue("challenge_token")
+		code := req.FormValue("code")
+		if challenge == "" || code == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m, tokens, err = h.ctrl.LoginMFA(ctx, challenge, code, clientIP(req))
 		if err == nil {
-			w.Header().Add("AUTHORIZATION", token)
+			w.Header().Add("AUTHORIZATION", tokens.AccessToken)
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"user_id": m.(string), "refresh_token": tokens.RefreshToken}
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCredentials) || errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if errors.Is(err, repository.ErrAccountLocked) {
+			m = "too many failed login attempts, try again later"
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// MFA handles POST /auth/mfa/enroll, /auth/mfa/confirm and /auth/mfa/disable requests of the authenticated user
+func (h *Handler) MFA(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := h.ctrl.ValidateToken(ctx, req.Header.Get("Authorization"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch strings.TrimPrefix(req.URL.Path, "/auth/mfa/") {
+	case "enroll":
+		var secret, uri string
+		if secret, uri, err = h.ctrl.EnrollMFA(ctx, u.ID); err == nil {
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"secret": secret, "otpauth_uri": uri}
+		}
+	case "confirm":
+		var codes []string
+		if codes, err = h.ctrl.ConfirmMFA(ctx, u.ID, req.FormValue("code")); err == nil {
 			w.WriteHeader(http.StatusOK)
-			m = map[string]string{"user_id": m.(string)}
+			m = map[string]any{"enabled": true, "recovery_codes": codes}
 		}
+	case "disable":
+		if err = h.ctrl.DisableMFA(ctx, u.ID, req.FormValue("code")); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
+			m = "two-factor authentication is not enrolled"
 			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, repository.ErrDuplicate) {
+			m = "two-factor authentication is already enabled"
+			w.WriteHeader(http.StatusConflict)
+		} else if errors.Is(err, repository.ErrInvalidCredentials) {
+			m = "invalid code"
+			w.WriteHeader(http.StatusBadRequest)
 		} else {
 			log.Printf("Repository get error: %v\n", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -138,3 +338,274 @@ func (h *Handler) Login(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 }
+
+// oauthStateCookie keeps the state of a login with an identity provider in the browser that started it
+const oauthStateCookie = "oauth_state"
+
+// OAuth handles GET /auth/oauth/{provider}/start and /auth/oauth/{provider}/callback requests
+func (h *Handler) OAuth(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	provider, action, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/auth/oauth/"), "/")
+
+	switch action {
+	case "start":
+		var url, state string
+		if url, state, err = h.ctrl.StartOAuth(ctx, provider); err == nil {
+			// The callback only completes in the browser holding the state
+			http.SetCookie(w, &http.Cookie{
+				Name:     oauthStateCookie,
+				Value:    state,
+				Path:     "/auth/oauth/",
+				HttpOnly: true,
+				Secure:   req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, req, url, http.StatusFound)
+		}
+	case "callback":
+		if e := req.FormValue("error"); e != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			m = map[string]string{"error": e, "error_description": req.FormValue("error_description")}
+			break
+		}
+		var tokens *user.Tokens
+		state := req.FormValue("state")
+		code := req.FormValue("code")
+		if state == "" || code == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var browserState string
+		if cookie, err := req.Cookie(oauthStateCookie); err == nil {
+			browserState = cookie.Value
+		}
+		http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/auth/oauth/", MaxAge: -1})
+		m, tokens, err = h.ctrl.CompleteOAuth(ctx, provider, state, browserState, code)
+		if err == nil && tokens.MFAChallenge != "" {
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"user_id": m.(string), "status": "mfa_required", "challenge_token": tokens.MFAChallenge}
+		} else if err == nil {
+			w.Header().Add("AUTHORIZATION", tokens.AccessToken)
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"user_id": m.(string), "refresh_token": tokens.RefreshToken}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			m = "unknown identity provider"
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, repository.ErrInvalidCredentials) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if errors.Is(err, repository.ErrUnverifiedEmail) {
+			m = "the identity provider has not verified your email"
+			w.WriteHeader(http.StatusForbidden)
+		} else if errors.Is(err, repository.ErrDuplicate) {
+			m = "an account with this email already exists, log in with your password and verify your email first"
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// Refresh handles POST /auth/refresh requests
+func (h *Handler) Refresh(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodPost:
+		var tokens *user.Tokens
+		refreshToken := req.FormValue("refresh_token")
+		if refreshToken == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m, tokens, err = h.ctrl.Refresh(ctx, refreshToken)
+		if err == nil {
+			w.Header().Add("AUTHORIZATION", tokens.AccessToken)
+			w.WriteHeader(http.StatusOK)
+			m = map[string]string{"user_id": m.(string), "refresh_token": tokens.RefreshToken}
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCredentials) || errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// Logout handles POST /auth/logout requests
+func (h *Handler) Logout(w http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodPost:
+		if refreshToken := req.FormValue("refresh_token"); refreshToken != "" {
+			err = h.ctrl.Logout(ctx, refreshToken)
+		} else if accessToken := req.Header.Get("Authorization"); accessToken != "" {
+			err = h.ctrl.LogoutToken(ctx, accessToken)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// Verify handles GET and POST /auth/verify requests
+func (h *Handler) Verify(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodGet, http.MethodPost:
+		token := req.FormValue("token")
+		if token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if m, err = h.ctrl.Verify(ctx, token); err == nil {
+			w.WriteHeader(http.StatusOK)
+			m = map[string]any{"user_id": m.(string), "verified": true}
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			m = "invalid or expired verification link"
+			w.WriteHeader(http.StatusBadRequest)
+		} else if errors.Is(err, repository.ErrTokenReused) {
+			m = "email already verified"
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// ForgotPassword handles POST /auth/password/forgot requests
+func (h *Handler) ForgotPassword(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodPost:
+		email := req.FormValue("email")
+		if email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := h.ctrl.ForgotPassword(ctx, email); err != nil {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// ResetPassword handles POST /auth/password/reset requests
+func (h *Handler) ResetPassword(w http.ResponseWriter, req *http.Request) {
+	var err error
+	var m any
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodPost:
+		email := req.FormValue("email")
+		code := req.FormValue("code")
+		password := req.FormValue("password")
+		if email == "" || code == "" || password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err = h.ctrl.ResetPassword(ctx, email, code, password); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			m = "invalid or expired reset code"
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	if m != nil && !(reflect.ValueOf(m).Kind() == reflect.Ptr && reflect.ValueOf(m).IsNil()) && m != "" {
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			log.Printf("Response encode error: %v\n", err)
+		}
+	}
+}
+
+// clientIP returns the address of the client, as recorded by the gateway's reverse proxy if present
+func clientIP(req *http.Request) string {
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		// The proxy appends the address it saw, earlier entries are client supplied
+		addrs := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addrs[len(addrs)-1])
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
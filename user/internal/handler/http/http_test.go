@@ -0,0 +1,123 @@
+package http
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/controller/user"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestLogin(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+	repo := memory.New()
+	h := New(user.New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), nil, auth.NewKeySet(key), ""))
+
+	u, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(context.Background(), u); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+
+	login := func(email, password string) int {
+		form := url.Values{"email": {email}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.Login(w, req)
+		return w.Code
+	}
+
+	// Test unknown emails and wrong passwords get the same response
+	if code := login("unknown@example.com", "password"); code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for an unknown email, got %d", http.StatusUnauthorized, code)
+	}
+	if code := login(u.Email, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for a wrong password, got %d", http.StatusUnauthorized, code)
+	}
+
+	// Test locked out accounts are told to slow down
+	for i := 0; i < 4; i++ {
+		login(u.Email, "wrong")
+	}
+	if code := login(u.Email, "password"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestReceivers(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+	producer := mocks.NewAsyncProducer(t, nil)
+	defer producer.Close()
+	repo := memory.New()
+	ctrl := user.New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), producer, auth.NewKeySet(key), "")
+	h := New(ctrl)
+
+	ctx := context.Background()
+	u, err := model.NewUser("test@example.com", "password")
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if err := repo.Post(ctx, u); err != nil {
+		t.Fatalf("Error posting user: %v", err)
+	}
+	_, tokens, err := ctrl.Login(ctx, u.Email, "password", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Error logging in: %v", err)
+	}
+
+	serve := func(method string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/user/receivers", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", tokens.AccessToken)
+		w := httptest.NewRecorder()
+		h.Receivers(w, req)
+		return w
+	}
+
+	// Test the secret of a webhook receiver is shown when it's added, and never again
+	producer.ExpectInputAndSucceed()
+	w := serve(http.MethodPost, url.Values{"channel": {model.ChannelWebhook}, "address": {"https://example.com/hook"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	var added struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&added); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if added.ID == "" || added.Secret == "" {
+		t.Errorf("Expected the receiver with its secret, got %+v", added)
+	}
+	if w := serve(http.MethodGet, nil); w.Code != http.StatusOK || strings.Contains(w.Body.String(), added.Secret) {
+		t.Errorf("Expected the receivers without the secret, got %d: %s", w.Code, w.Body)
+	}
+}
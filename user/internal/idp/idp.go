@@ -0,0 +1,21 @@
+// Package idp implements logins through external identity providers
+package idp
+
+import "context"
+
+// Identity defines the user an identity provider authenticated
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider defines an identity provider users can log in with through the authorization code flow with PKCE
+type Provider interface {
+	// Name identifies the provider in URLs and linked identities
+	Name() string
+	// AuthCodeURL returns the URL to send the user to, the code challenge is derived from verifier
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange redeems an authorization code and returns the identity it was issued for
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error)
+}
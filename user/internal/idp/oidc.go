@@ -0,0 +1,101 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDC defines an OpenID Connect identity provider
+type OIDC struct {
+	name     string
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC discovers the OpenID Connect provider at issuer, redirectURL is where the provider sends the user back to
+func NewOIDC(ctx context.Context, name, issuer, clientID, clientSecret, redirectURL string) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDC{
+		name: name,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// Name identifies the provider in URLs and linked identities
+func (p *OIDC) Name() string {
+	return p.name
+}
+
+// AuthCodeURL returns the URL to send the user to, the code challenge is derived from verifier
+func (p *OIDC) AuthCodeURL(state, nonce, verifier string) string {
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems an authorization code and verifies the ID token issued with it
+func (p *OIDC) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return &Identity{Subject: idToken.Subject, Email: claims.Email, EmailVerified: claims.EmailVerified}, nil
+}
+
+// LoadOIDCProviders configures the providers named in OIDC_PROVIDERS, each from
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+// Callbacks are expected at <redirectBase>/<name>/callback.
+func LoadOIDCProviders(ctx context.Context, redirectBase string) ([]Provider, error) {
+	var providers []Provider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p, err := NewOIDC(ctx, name,
+			os.Getenv(prefix+"ISSUER"),
+			os.Getenv(prefix+"CLIENT_ID"),
+			os.Getenv(prefix+"CLIENT_SECRET"),
+			strings.TrimSuffix(redirectBase, "/")+"/"+name+"/callback",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("identity provider %s: %w", name, err)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
@@ -0,0 +1,145 @@
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// testProvider is a stand-in OpenID Connect provider issuing codes for a single user
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	// authorization requests by the code issued for them
+	requests map[string]url.Values
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	p := &testProvider{key: key, requests: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		authReq, ok := p.requests[req.FormValue("code")]
+		delete(p.requests, req.FormValue("code"))
+		sum := sha256.Sum256([]byte(req.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authReq.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            p.URL,
+			"sub":            "subject1",
+			"aud":            authReq.Get("client_id"),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          authReq.Get("nonce"),
+			"email":          "user1@example.com",
+			"email_verified": true,
+		})
+		token.Header["kid"] = "test-key"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("Error signing id_token: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access_token",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// authorize plays the user consenting at the provider, returning the code the provider redirects back with
+func (p *testProvider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Error parsing authorization URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Expected a PKCE challenge, got %v", q)
+	}
+	code := "code" + q.Get("state")
+	p.requests[code] = q
+	return code
+}
+
+func TestOIDC(t *testing.T) {
+	server := newTestProvider(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	p, err := NewOIDC(ctx, "test", server.URL, "client1", "secret1", "http://localhost/auth/oauth/test/callback")
+	if err != nil {
+		t.Fatalf("Error discovering provider: %v", err)
+	}
+
+	// Test a complete authorization code flow
+	t.Run("TestExchange", func(t *testing.T) {
+		code := server.authorize(t, p.AuthCodeURL("state1", "nonce1", "verifier1-verifier1-verifier1-verifier1-verifier1"))
+		identity, err := p.Exchange(ctx, code, "nonce1", "verifier1-verifier1-verifier1-verifier1-verifier1")
+		if err != nil {
+			t.Fatalf("Error exchanging code: %v", err)
+		}
+		if identity.Subject != "subject1" || identity.Email != "user1@example.com" || !identity.EmailVerified {
+			t.Errorf("Unexpected identity: %v", identity)
+		}
+	})
+
+	// Test the code is useless without the PKCE verifier
+	t.Run("TestWrongVerifier", func(t *testing.T) {
+		code := server.authorize(t, p.AuthCodeURL("state2", "nonce2", "verifier2-verifier2-verifier2-verifier2-verifier2"))
+		if _, err := p.Exchange(ctx, code, "nonce2", "attacker-attacker-attacker-attacker-attacker-at"); err == nil {
+			t.Errorf("Expected exchange with the wrong verifier to fail")
+		}
+	})
+
+	// Test ID tokens issued for another login are rejected
+	t.Run("TestWrongNonce", func(t *testing.T) {
+		code := server.authorize(t, p.AuthCodeURL("state3", "nonce3", "verifier3-verifier3-verifier3-verifier3-verifier3"))
+		if _, err := p.Exchange(ctx, code, "nonce4", "verifier3-verifier3-verifier3-verifier3-verifier3"); err == nil {
+			t.Errorf("Expected exchange with the wrong nonce to fail")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// Package outbox publishes the events stored in the outbox to Kafka
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/events"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	// DefaultInterval is how often the outbox is checked for new events
+	DefaultInterval = time.Second
+	// DefaultMaxDelay caps the delay between retries while publishing fails
+	DefaultMaxDelay = time.Minute
+	// batchSize is how many events are published per check
+	batchSize = 100
+)
+
+type outboxRepository interface {
+	ListOutbox(ctx context.Context, limit int) ([]*model.OutboxEvent, error)
+	MarkOutboxSent(ctx context.Context, id string, sentAt time.Time) error
+}
+
+// Relay publishes outbox events in the order they were stored. An event is published at least once,
+// it's published again if marking it sent fails, which consumers dedupe by the event id.
+type Relay struct {
+	repo     outboxRepository
+	producer sarama.SyncProducer
+	// Interval is how often the outbox is checked for new events
+	Interval time.Duration
+	// MaxDelay caps the delay between retries, which doubles with every failure
+	MaxDelay time.Duration
+}
+
+// NewRelay creates a relay publishing the repository's outbox through the producer
+func NewRelay(repo outboxRepository, producer sarama.SyncProducer) *Relay {
+	return &Relay{repo: repo, producer: producer, Interval: DefaultInterval, MaxDelay: DefaultMaxDelay}
+}
+
+// Run publishes events until ctx is done, backing off while publishing fails
+func (r *Relay) Run(ctx context.Context) {
+	delay := r.Interval
+	for {
+		if err := r.Flush(ctx); err != nil {
+			log.Printf("Error relaying outbox events, retrying in %v: %v\n", delay, err)
+			delay = min(delay*2, r.MaxDelay)
+		} else {
+			delay = r.Interval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Flush publishes the unsent events, stopping at the first failure so events stay in order
+func (r *Relay) Flush(ctx context.Context) error {
+	for {
+		pending, err := r.repo.ListOutbox(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range pending {
+			if err := r.publish(event); err != nil {
+				return err
+			}
+			if err := r.repo.MarkOutboxSent(ctx, event.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+		if len(pending) < batchSize {
+			return nil
+		}
+	}
+}
+
+// publish sends the event and waits until the brokers acknowledged it
+func (r *Relay) publish(event *model.OutboxEvent) error {
+	_, _, err := r.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: event.Topic,
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(events.TypeHeader), Value: []byte(event.Type)},
+			{Key: []byte(events.VersionHeader), Value: []byte(event.Version)},
+		},
+		Value: sarama.ByteEncoder(event.Payload),
+	})
+	return err
+}
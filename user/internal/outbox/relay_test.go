@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/events"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user, err := model.NewUser(email, "password")
+		if err != nil {
+			t.Fatalf("Error creating user: %v", err)
+		}
+		event := model.NewOutboxEvent("notifications", "UserRegistered", events.Version, []byte(user.ID), time.Now())
+		if err := repo.Post(ctx, user, event); err != nil {
+			t.Fatalf("Error posting user: %v", err)
+		}
+	}
+
+	// Test events stay in the outbox when publishing fails, and later ones aren't published ahead of them
+	t.Run("TestPublishFails", func(t *testing.T) {
+		producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+		producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+		if err := NewRelay(repo, producer).Flush(ctx); !errors.Is(err, sarama.ErrOutOfBrokers) {
+			t.Errorf("Expected %v, got %v", sarama.ErrOutOfBrokers, err)
+		}
+		if err := producer.Close(); err != nil {
+			t.Errorf("Error closing producer: %v", err)
+		}
+		if pending, err := repo.ListOutbox(ctx, batchSize); err != nil || len(pending) != 2 {
+			t.Errorf("Expected 2 pending events, got %v, %v", pending, err)
+		}
+	})
+
+	// Test events are published with their type and version and marked sent
+	t.Run("TestPublish", func(t *testing.T) {
+		producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+		for i := 0; i < 2; i++ {
+			producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				if len(msg.Headers) != 2 || string(msg.Headers[0].Value) != "UserRegistered" || string(msg.Headers[1].Value) != events.Version {
+					return errors.New("expected the event type and version headers")
+				}
+				return nil
+			})
+		}
+		if err := NewRelay(repo, producer).Flush(ctx); err != nil {
+			t.Errorf("Error flushing outbox: %v", err)
+		}
+		if err := producer.Close(); err != nil {
+			t.Errorf("Error closing producer: %v", err)
+		}
+		if pending, err := repo.ListOutbox(ctx, batchSize); err != nil || len(pending) != 0 {
+			t.Errorf("Expected no pending events, got %v, %v", pending, err)
+		}
+	})
+}
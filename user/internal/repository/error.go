@@ -6,3 +6,8 @@ import "errors"
 var ErrNotFound = errors.New("not found")
 var ErrDuplicate = errors.New("duplicate found")
 var ErrInvalidCredentials = errors.New("invalid credentials")
+var ErrTokenReused = errors.New("token already used")
+var ErrAccountLocked = errors.New("account locked")
+var ErrUnverifiedEmail = errors.New("email not verified")
+var ErrInvalidReceiver = errors.New("invalid receiver")
+var ErrBatchTooLarge = errors.New("batch too large")
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PostIdentity links an external identity to a user
+func (r *Repository) PostIdentity(_ context.Context, identity *model.Identity) error {
+	r.Lock()
+	defer r.Unlock()
+	key := identity.Provider + ":" + identity.Subject
+	if _, ok := r.identities[key]; ok {
+		return repository.ErrDuplicate
+	}
+	i := *identity
+	r.identities[key] = &i
+	return nil
+}
+
+// GetIdentity retrieves the linked identity of a provider's user
+func (r *Repository) GetIdentity(_ context.Context, provider, subject string) (*model.Identity, error) {
+	r.RLock()
+	defer r.RUnlock()
+	i, ok := r.identities[provider+":"+subject]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *i
+	return &res, nil
+}
+
+// PostOAuthState stores an authorization request in flight
+func (r *Repository) PostOAuthState(_ context.Context, state *model.OAuthState) error {
+	r.Lock()
+	defer r.Unlock()
+	s := *state
+	r.oauthStates[state.State] = &s
+	return nil
+}
+
+// ConsumeOAuthState retrieves and removes an authorization request, so every state is used at most once
+func (r *Repository) ConsumeOAuthState(_ context.Context, state string) (*model.OAuthState, error) {
+	r.Lock()
+	defer r.Unlock()
+	s, ok := r.oauthStates[state]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	delete(r.oauthStates, state)
+	return s, nil
+}
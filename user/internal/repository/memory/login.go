@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// LoginAttemptRepository defines a memory failed login repository
+type LoginAttemptRepository struct {
+	sync.RWMutex
+	data map[string]*model.LoginAttempts
+}
+
+// NewLoginAttemptRepository creates a new memory failed login repository
+func NewLoginAttemptRepository() *LoginAttemptRepository {
+	return &LoginAttemptRepository{data: map[string]*model.LoginAttempts{}}
+}
+
+// GetLoginAttempts retrieves the failed logins for a key
+func (r *LoginAttemptRepository) GetLoginAttempts(_ context.Context, key string) (*model.LoginAttempts, error) {
+	r.RLock()
+	defer r.RUnlock()
+	a, ok := r.data[key]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *a
+	return &res, nil
+}
+
+// RecordLoginFailure counts a failed login, failures before windowStart are forgotten
+func (r *LoginAttemptRepository) RecordLoginFailure(_ context.Context, key string, at, windowStart time.Time) (*model.LoginAttempts, error) {
+	r.Lock()
+	defer r.Unlock()
+	a, ok := r.data[key]
+	if !ok {
+		a = &model.LoginAttempts{Key: key}
+		r.data[key] = a
+	}
+	if a.LastFailureAt.Before(windowStart) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = at
+	res := *a
+	return &res, nil
+}
+
+// LockLogin blocks logins for a key until the given time
+func (r *LoginAttemptRepository) LockLogin(_ context.Context, key string, until time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+	a, ok := r.data[key]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	a.LockedUntil = until
+	return nil
+}
+
+// ResetLoginAttempts forgets the failed logins for a key
+func (r *LoginAttemptRepository) ResetLoginAttempts(_ context.Context, key string) error {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.data, key)
+	return nil
+}
@@ -11,25 +11,51 @@ import (
 // Repository defines a memory user repository
 type Repository struct {
 	sync.RWMutex
-	data     map[string]*model.User
-	emailMap map[string]string
+	data        map[string]*model.User
+	emailMap    map[string]string
+	resetCodes  map[string]*model.ResetCode
+	mfa         map[string]*model.MFA
+	recovery    map[string]map[string]bool
+	identities  map[string]*model.Identity
+	oauthStates map[string]*model.OAuthState
+	receivers   map[string]*model.Receiver
+	outbox      []*model.OutboxEvent
 }
 
 // New creates a new memory repository
 func New() *Repository {
-	return &Repository{data: map[string]*model.User{}, emailMap: map[string]string{}}
+	return &Repository{
+		data:        map[string]*model.User{},
+		emailMap:    map[string]string{},
+		resetCodes:  map[string]*model.ResetCode{},
+		mfa:         map[string]*model.MFA{},
+		recovery:    map[string]map[string]bool{},
+		identities:  map[string]*model.Identity{},
+		oauthStates: map[string]*model.OAuthState{},
+		receivers:   map[string]*model.Receiver{},
+	}
 }
 
-// Post adds a new user
-func (r *Repository) Post(_ context.Context, user *model.User) error {
+// Post adds a new user along with their receivers and the events announcing them
+func (r *Repository) Post(_ context.Context, user *model.User, events ...*model.OutboxEvent) error {
 	r.Lock()
 	defer r.Unlock()
-	r.data[user.ID] = user
+	u := *user
+	u.Receivers = nil
+	r.data[user.ID] = &u
 	r.emailMap[user.Email] = user.ID
+	for _, receiver := range user.Receivers {
+		rc := *receiver
+		r.receivers[receiver.ID] = &rc
+	}
+	for _, event := range events {
+		e := *event
+		r.outbox = append(r.outbox, &e)
+	}
 	return nil
 }
 
-// Get user by id
+// Get user by id, without their receivers
 func (r *Repository) Get(_ context.Context, id string) (*model.User, error) {
 	r.RLock()
 	defer r.RUnlock()
@@ -37,7 +63,8 @@ func (r *Repository) Get(_ context.Context, id string) (*model.User, error) {
 	if !ok {
 		return nil, repository.ErrNotFound
 	}
-	return m, nil
+	res := *m
+	return &res, nil
 }
 
 // Get user id by email
@@ -50,3 +77,71 @@ func (r *Repository) GetIDbyEmail(_ context.Context, email string) (string, erro
 	}
 	return id, nil
 }
+
+// Verify marks the user's email as verified
+func (r *Repository) Verify(_ context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+	m, ok := r.data[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	m.Verified = true
+	return nil
+}
+
+// UpdatePassword replaces the user's hashed password
+func (r *Repository) UpdatePassword(_ context.Context, id, password string) error {
+	r.Lock()
+	defer r.Unlock()
+	m, ok := r.data[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	m.Password = password
+	return nil
+}
+
+// PostResetCode stores a password reset code, replacing any outstanding code of the user
+func (r *Repository) PostResetCode(_ context.Context, code *model.ResetCode) error {
+	r.Lock()
+	defer r.Unlock()
+	c := *code
+	r.resetCodes[code.UserID] = &c
+	return nil
+}
+
+// GetResetCode retrieves the outstanding password reset code of a user
+func (r *Repository) GetResetCode(_ context.Context, userID string) (*model.ResetCode, error) {
+	r.RLock()
+	defer r.RUnlock()
+	c, ok := r.resetCodes[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *c
+	return &res, nil
+}
+
+// IncrementResetCodeAttempts counts a wrong guess of the user's password reset code
+func (r *Repository) IncrementResetCodeAttempts(_ context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+	c, ok := r.resetCodes[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	c.Attempts++
+	return nil
+}
+
+// DeleteResetCode removes the outstanding password reset code of a user
+func (r *Repository) DeleteResetCode(_ context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.resetCodes[userID]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.resetCodes, userID)
+	return nil
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PostMFA stores the user's second factor, replacing any existing one
+func (r *Repository) PostMFA(_ context.Context, mfa *model.MFA) error {
+	r.Lock()
+	defer r.Unlock()
+	m := *mfa
+	r.mfa[mfa.UserID] = &m
+	return nil
+}
+
+// GetMFA retrieves the user's second factor
+func (r *Repository) GetMFA(_ context.Context, userID string) (*model.MFA, error) {
+	r.RLock()
+	defer r.RUnlock()
+	m, ok := r.mfa[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *m
+	return &res, nil
+}
+
+// EnableMFA marks the user's second factor as confirmed
+func (r *Repository) EnableMFA(_ context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+	m, ok := r.mfa[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	m.Enabled = true
+	return nil
+}
+
+// DeleteMFA removes the user's second factor along with its recovery codes
+func (r *Repository) DeleteMFA(_ context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.mfa[userID]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.mfa, userID)
+	delete(r.recovery, userID)
+	return nil
+}
+
+// UseMFAStep records the TOTP time step a code was accepted for, steps at or before the last used one are rejected
+func (r *Repository) UseMFAStep(_ context.Context, userID string, step int64) error {
+	r.Lock()
+	defer r.Unlock()
+	m, ok := r.mfa[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if step <= m.LastUsedStep {
+		return repository.ErrTokenReused
+	}
+	m.LastUsedStep = step
+	return nil
+}
+
+// PostRecoveryCodes replaces the user's recovery codes with the given hashes
+func (r *Repository) PostRecoveryCodes(_ context.Context, userID string, hashes []string) error {
+	r.Lock()
+	defer r.Unlock()
+	codes := map[string]bool{}
+	for _, h := range hashes {
+		codes[h] = true
+	}
+	r.recovery[userID] = codes
+	return nil
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes
+func (r *Repository) UseRecoveryCode(_ context.Context, userID, hash string) error {
+	r.Lock()
+	defer r.Unlock()
+	if !r.recovery[userID][hash] {
+		return repository.ErrNotFound
+	}
+	delete(r.recovery[userID], hash)
+	return nil
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// ListOutbox returns up to limit unsent events, oldest first
+func (r *Repository) ListOutbox(_ context.Context, limit int) ([]*model.OutboxEvent, error) {
+	r.RLock()
+	defer r.RUnlock()
+	res := []*model.OutboxEvent{}
+	for _, event := range r.outbox {
+		if len(res) >= limit {
+			break
+		}
+		if event.SentAt == nil {
+			e := *event
+			res = append(res, &e)
+		}
+	}
+	return res, nil
+}
+
+// MarkOutboxSent records that the event was published
+func (r *Repository) MarkOutboxSent(_ context.Context, id string, sentAt time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, event := range r.outbox {
+		if event.ID == id {
+			event.SentAt = &sentAt
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PostReceiver adds a receiver to a user
+func (r *Repository) PostReceiver(_ context.Context, receiver *model.Receiver) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.hasReceiver(receiver.UserID, receiver.Channel, receiver.Address) {
+		return repository.ErrDuplicate
+	}
+	rc := *receiver
+	r.receivers[receiver.ID] = &rc
+	return nil
+}
+
+// GetReceiver retrieves a receiver by id
+func (r *Repository) GetReceiver(_ context.Context, id string) (*model.Receiver, error) {
+	r.RLock()
+	defer r.RUnlock()
+	rc, ok := r.receivers[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *rc
+	return &res, nil
+}
+
+// ListReceivers retrieves the receivers of a user, oldest first
+func (r *Repository) ListReceivers(_ context.Context, userID string) ([]*model.Receiver, error) {
+	r.RLock()
+	defer r.RUnlock()
+	res := []*model.Receiver{}
+	for _, rc := range r.receivers {
+		if rc.UserID == userID {
+			c := *rc
+			res = append(res, &c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res, nil
+}
+
+// UpdateReceiverAddress changes the address of a receiver, which has to be verified again
+func (r *Repository) UpdateReceiverAddress(_ context.Context, id, address string) error {
+	r.Lock()
+	defer r.Unlock()
+	rc, ok := r.receivers[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if r.hasReceiver(rc.UserID, rc.Channel, address) {
+		return repository.ErrDuplicate
+	}
+	rc.Address = address
+	rc.Verified = false
+	rc.CodeHash, rc.CodeExpiresAt, rc.CodeAttempts = "", time.Time{}, 0
+	return nil
+}
+
+// DeleteReceiver removes a receiver
+func (r *Repository) DeleteReceiver(_ context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.receivers[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.receivers, id)
+	return nil
+}
+
+// SetReceiverCode stores the verification code of a receiver, replacing any outstanding code
+func (r *Repository) SetReceiverCode(_ context.Context, id, hash string, expiresAt time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+	rc, ok := r.receivers[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	rc.CodeHash, rc.CodeExpiresAt, rc.CodeAttempts = hash, expiresAt, 0
+	return nil
+}
+
+// IncrementReceiverCodeAttempts counts a wrong guess of a receiver's verification code
+func (r *Repository) IncrementReceiverCodeAttempts(_ context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+	rc, ok := r.receivers[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	rc.CodeAttempts++
+	return nil
+}
+
+// VerifyReceiver marks a receiver as verified and discards its verification code
+func (r *Repository) VerifyReceiver(_ context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+	rc, ok := r.receivers[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	rc.Verified = true
+	rc.CodeHash, rc.CodeExpiresAt, rc.CodeAttempts = "", time.Time{}, 0
+	return nil
+}
+
+func (r *Repository) hasReceiver(userID, channel, address string) bool {
+	for _, rc := range r.receivers {
+		if rc.UserID == userID && rc.Channel == channel && rc.Address == address {
+			return true
+		}
+	}
+	return false
+}
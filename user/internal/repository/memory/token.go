@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// TokenRepository defines a memory refresh token and revocation repository
+type TokenRepository struct {
+	sync.RWMutex
+	refreshTokens map[string]*model.RefreshToken
+	revoked       map[string]time.Time
+}
+
+// NewTokenRepository creates a new memory token repository
+func NewTokenRepository() *TokenRepository {
+	return &TokenRepository{refreshTokens: map[string]*model.RefreshToken{}, revoked: map[string]time.Time{}}
+}
+
+// PostRefreshToken adds a new refresh token
+func (r *TokenRepository) PostRefreshToken(_ context.Context, token *model.RefreshToken) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.refreshTokens[token.Hash]; ok {
+		return repository.ErrDuplicate
+	}
+	t := *token
+	r.refreshTokens[token.Hash] = &t
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token by hash
+func (r *TokenRepository) GetRefreshToken(_ context.Context, hash string) (*model.RefreshToken, error) {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.refreshTokens[hash]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	res := *t
+	return &res, nil
+}
+
+// UseRefreshToken marks a refresh token as used, a token can only be used once
+func (r *TokenRepository) UseRefreshToken(_ context.Context, hash string) error {
+	r.Lock()
+	defer r.Unlock()
+	t, ok := r.refreshTokens[hash]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if t.UsedAt != nil {
+		return repository.ErrTokenReused
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return nil
+}
+
+// RevokeSession stops accepting tokens issued for the session
+func (r *TokenRepository) RevokeSession(_ context.Context, sessionID string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.revoked[sessionID]; !ok {
+		r.revoked[sessionID] = time.Now()
+	}
+	return nil
+}
+
+// RevokeUserSessions stops accepting tokens issued for any session of the user
+func (r *TokenRepository) RevokeUserSessions(_ context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	for _, t := range r.refreshTokens {
+		if _, ok := r.revoked[t.SessionID]; t.UserID == userID && !ok {
+			r.revoked[t.SessionID] = now
+		}
+	}
+	return nil
+}
+
+// IsSessionRevoked reports whether the session has been revoked
+func (r *TokenRepository) IsSessionRevoked(_ context.Context, sessionID string) (bool, error) {
+	r.RLock()
+	defer r.RUnlock()
+	_, ok := r.revoked[sessionID]
+	return ok, nil
+}
+
+// ListRevokedSessions retrieves sessions revoked after the given time
+func (r *TokenRepository) ListRevokedSessions(_ context.Context, since time.Time) ([]*model.RevokedSession, error) {
+	r.RLock()
+	defer r.RUnlock()
+	var sessions []*model.RevokedSession
+	for id, revokedAt := range r.revoked {
+		if revokedAt.After(since) {
+			sessions = append(sessions, &model.RevokedSession{SessionID: id, RevokedAt: revokedAt})
+		}
+	}
+	return sessions, nil
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+func TestTokenRepository(t *testing.T) {
+	repo := NewTokenRepository()
+
+	ctx := context.Background()
+	token := &model.RefreshToken{
+		Hash:      "test_hash",
+		SessionID: "test_session_id",
+		UserID:    "test_user_id",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	// Test PostRefreshToken & GetRefreshToken
+	t.Run("TestPostRefreshToken", func(t *testing.T) {
+		if err := repo.PostRefreshToken(ctx, token); err != nil {
+			t.Errorf("Error posting refresh token: %v", err)
+		}
+
+		retrievedToken, err := repo.GetRefreshToken(ctx, token.Hash)
+		if err != nil {
+			t.Fatalf("Error retrieving refresh token: %v", err)
+		}
+		if retrievedToken.SessionID != token.SessionID || retrievedToken.UserID != token.UserID || retrievedToken.UsedAt != nil {
+			t.Errorf("Retrieved refresh token does not match original token: %v != %v", token, retrievedToken)
+		}
+	})
+
+	// Test UseRefreshToken only succeeds once
+	t.Run("TestUseRefreshToken", func(t *testing.T) {
+		if err := repo.UseRefreshToken(ctx, token.Hash); err != nil {
+			t.Errorf("Error using refresh token: %v", err)
+		}
+		if err := repo.UseRefreshToken(ctx, token.Hash); err != repository.ErrTokenReused {
+			t.Errorf("Expected %v, got %v", repository.ErrTokenReused, err)
+		}
+		if err := repo.UseRefreshToken(ctx, "unknown_hash"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test RevokeSession & IsSessionRevoked
+	t.Run("TestRevokeSession", func(t *testing.T) {
+		since := time.Now().Add(-time.Second)
+		if err := repo.RevokeSession(ctx, token.SessionID); err != nil {
+			t.Errorf("Error revoking session: %v", err)
+		}
+
+		revoked, err := repo.IsSessionRevoked(ctx, token.SessionID)
+		if err != nil {
+			t.Errorf("Error checking session: %v", err)
+		}
+		if !revoked {
+			t.Errorf("Expected session %s to be revoked", token.SessionID)
+		}
+
+		sessions, err := repo.ListRevokedSessions(ctx, since)
+		if err != nil {
+			t.Errorf("Error listing revoked sessions: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].SessionID != token.SessionID {
+			t.Errorf("Expected revoked session %s, got %v", token.SessionID, sessions)
+		}
+	})
+	// Test RevokeUserSessions
+	t.Run("TestRevokeUserSessions", func(t *testing.T) {
+		other := &model.RefreshToken{Hash: "other_hash", SessionID: "other_session_id", UserID: token.UserID, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := repo.PostRefreshToken(ctx, other); err != nil {
+			t.Errorf("Error posting refresh token: %v", err)
+		}
+		if err := repo.RevokeUserSessions(ctx, token.UserID); err != nil {
+			t.Errorf("Error revoking user sessions: %v", err)
+		}
+		revoked, err := repo.IsSessionRevoked(ctx, other.SessionID)
+		if err != nil {
+			t.Errorf("Error checking session: %v", err)
+		}
+		if !revoked {
+			t.Errorf("Expected session %s to be revoked", other.SessionID)
+		}
+	})
+}
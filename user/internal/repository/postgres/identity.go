@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PostIdentity links an external identity to a user
+func (r *UserRepository) PostIdentity(ctx context.Context, identity *model.Identity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, subject) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrDuplicate
+	}
+	return nil
+}
+
+// GetIdentity retrieves the linked identity of a provider's user
+func (r *UserRepository) GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at FROM user_identities WHERE provider = $1 AND subject = $2
+	`
+	identity := &model.Identity{}
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+// PostOAuthState stores an authorization request in flight
+func (r *UserRepository) PostOAuthState(ctx context.Context, state *model.OAuthState) error {
+	query := `
+		INSERT INTO oauth_states (state, provider, nonce, verifier, expires_at) VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, state.State, state.Provider, state.Nonce, state.Verifier, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOAuthState retrieves and removes an authorization request, so every state is used at most once
+func (r *UserRepository) ConsumeOAuthState(ctx context.Context, state string) (*model.OAuthState, error) {
+	query := `
+		DELETE FROM oauth_states WHERE state = $1 RETURNING state, provider, nonce, verifier, expires_at
+	`
+	s := &model.OAuthState{}
+	err := r.db.QueryRowContext(ctx, query, state).Scan(&s.State, &s.Provider, &s.Nonce, &s.Verifier, &s.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// LoginAttemptRepository defines a PostgreSQL failed login repository
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository creates a new PostgreSQL failed login repository
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// GetLoginAttempts retrieves the failed logins for a key
+func (r *LoginAttemptRepository) GetLoginAttempts(ctx context.Context, key string) (*model.LoginAttempts, error) {
+	query := `
+		SELECT attempt_key, failures, last_failure_at, locked_until FROM login_attempts WHERE attempt_key = $1
+	`
+	a := &model.LoginAttempts{}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&a.Key, &a.Failures, &a.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	a.LockedUntil = lockedUntil.Time
+	return a, nil
+}
+
+// RecordLoginFailure counts a failed login, failures before windowStart are forgotten
+func (r *LoginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, at, windowStart time.Time) (*model.LoginAttempts, error) {
+	query := `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (attempt_key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = $2
+		RETURNING attempt_key, failures, last_failure_at, locked_until
+	`
+	a := &model.LoginAttempts{}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, key, at, windowStart).Scan(&a.Key, &a.Failures, &a.LastFailureAt, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	a.LockedUntil = lockedUntil.Time
+	return a, nil
+}
+
+// LockLogin blocks logins for a key until the given time
+func (r *LoginAttemptRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	query := `
+		UPDATE login_attempts SET locked_until = $2 WHERE attempt_key = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, key, until)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// ResetLoginAttempts forgets the failed logins for a key
+func (r *LoginAttemptRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	query := `
+		DELETE FROM login_attempts WHERE attempt_key = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, key)
+	return err
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+)
+
+func TestLoginAttemptRepository(t *testing.T) {
+	db, err := setupTestDB()
+	if err != nil {
+		t.Fatalf("Error setting up test database: %v\n", err)
+	}
+	defer teardownTestDB(db)
+
+	repo := NewLoginAttemptRepository(db)
+
+	ctx := context.Background()
+	key := "account:test@example.com"
+	now := time.Now()
+
+	// Test RecordLoginFailure counts failures within the window
+	t.Run("TestRecordLoginFailure", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			a, err := repo.RecordLoginFailure(ctx, key, now, now.Add(-time.Minute))
+			if err != nil {
+				t.Fatalf("Error recording login failure: %v\n", err)
+			}
+			if a.Failures != i {
+				t.Errorf("Expected %d failures, got %d\n", i, a.Failures)
+			}
+		}
+
+		a, err := repo.RecordLoginFailure(ctx, key, now.Add(time.Hour), now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Error recording login failure: %v\n", err)
+		}
+		if a.Failures != 1 {
+			t.Errorf("Expected failures outside the window to be forgotten, got %d\n", a.Failures)
+		}
+	})
+
+	// Test LockLogin & GetLoginAttempts
+	t.Run("TestLockLogin", func(t *testing.T) {
+		until := now.Add(time.Minute)
+		if err := repo.LockLogin(ctx, key, until); err != nil {
+			t.Errorf("Error locking login: %v\n", err)
+		}
+		a, err := repo.GetLoginAttempts(ctx, key)
+		if err != nil {
+			t.Fatalf("Error getting login attempts: %v\n", err)
+		}
+		if a.LockedUntil.Unix() != until.Unix() {
+			t.Errorf("Expected login locked until %v, got %v\n", until, a.LockedUntil)
+		}
+	})
+
+	// Test ResetLoginAttempts
+	t.Run("TestResetLoginAttempts", func(t *testing.T) {
+		if err := repo.ResetLoginAttempts(ctx, key); err != nil {
+			t.Errorf("Error resetting login attempts: %v\n", err)
+		}
+		if _, err := repo.GetLoginAttempts(ctx, key); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+}
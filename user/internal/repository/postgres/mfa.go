@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PostMFA stores the user's second factor, replacing any existing one
+func (r *UserRepository) PostMFA(ctx context.Context, mfa *model.MFA) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret, enabled, last_used_step) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, enabled = $3, last_used_step = $4
+	`
+	_, err := r.db.ExecContext(ctx, query, mfa.UserID, mfa.Secret, mfa.Enabled, mfa.LastUsedStep)
+	return err
+}
+
+// GetMFA retrieves the user's second factor
+func (r *UserRepository) GetMFA(ctx context.Context, userID string) (*model.MFA, error) {
+	query := `
+		SELECT user_id, secret, enabled, last_used_step FROM user_mfa WHERE user_id = $1
+	`
+	mfa := &model.MFA{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// EnableMFA marks the user's second factor as confirmed
+func (r *UserRepository) EnableMFA(ctx context.Context, userID string) error {
+	query := `
+		UPDATE user_mfa SET enabled = TRUE WHERE user_id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteMFA removes the user's second factor along with its recovery codes
+func (r *UserRepository) DeleteMFA(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseMFAStep records the TOTP time step a code was accepted for, steps at or before the last used one are rejected
+func (r *UserRepository) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	query := `
+		UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := r.GetMFA(ctx, userID); err != nil {
+			return err
+		}
+		return repository.ErrTokenReused
+	}
+	return nil
+}
+
+// PostRecoveryCodes replaces the user's recovery codes with the given hashes
+func (r *UserRepository) PostRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	query := `
+		DELETE FROM mfa_recovery_codes WHERE user_id = $1 AND code_hash = $2
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// postOutboxEvent adds the event to the outbox within the transaction of the change it announces
+func postOutboxEvent(ctx context.Context, tx *sql.Tx, event *model.OutboxEvent) error {
+	query := `
+		INSERT INTO outbox (id, topic, event_type, version, payload, created_at) VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := tx.ExecContext(ctx, query, event.ID, event.Topic, event.Type, event.Version, event.Payload, event.CreatedAt)
+	return err
+}
+
+// ListOutbox returns up to limit unsent events, oldest first
+func (r *UserRepository) ListOutbox(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	query := `
+		SELECT id, topic, event_type, version, payload, created_at FROM outbox
+		WHERE sent_at IS NULL ORDER BY created_at, id LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []*model.OutboxEvent{}
+	for rows.Next() {
+		event := &model.OutboxEvent{}
+		if err := rows.Scan(&event.ID, &event.Topic, &event.Type, &event.Version, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, event)
+	}
+	return res, rows.Err()
+}
+
+// MarkOutboxSent records that the event was published
+func (r *UserRepository) MarkOutboxSent(ctx context.Context, id string, sentAt time.Time) error {
+	query := `
+		UPDATE outbox SET sent_at = $2 WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id, sentAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
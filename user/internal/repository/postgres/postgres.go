@@ -18,23 +18,45 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// Post adds a new user
-func (r *UserRepository) Post(ctx context.Context, user *model.User) error {
+// Post adds a new user along with their receivers and the events announcing them
+func (r *UserRepository) Post(ctx context.Context, user *model.User, events ...*model.OutboxEvent) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO users (id, email, password) VALUES ($1, $2, $3)
+		INSERT INTO users (id, email, password, verified) VALUES ($1, $2, $3, $4)
 	`
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.Password)
-	return err
+	if _, err := tx.ExecContext(ctx, query, user.ID, user.Email, user.Password, user.Verified); err != nil {
+		return err
+	}
+	for _, receiver := range user.Receivers {
+		query := `
+			INSERT INTO user_receivers (id, user_id, channel, address, verified, created_at, secret) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+		_, err := tx.ExecContext(ctx, query, receiver.ID, user.ID, receiver.Channel, receiver.Address, receiver.Verified, receiver.CreatedAt, receiver.Secret)
+		if err != nil {
+			return err
+		}
+	}
+	for _, event := range events {
+		if err := postOutboxEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// Get retrieves a user by id
+// Get retrieves a user by id, without their receivers
 func (r *UserRepository) Get(ctx context.Context, id string) (*model.User, error) {
 	query := `
-		SELECT id, email, password FROM users WHERE id = $1
+		SELECT id, email, password, verified FROM users WHERE id = $1
 	`
 	row := r.db.QueryRowContext(ctx, query, id)
 	user := &model.User{}
-	err := row.Scan(&user.ID, &user.Email, &user.Password)
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Verified)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, repository.ErrNotFound
@@ -59,3 +81,105 @@ func (r *UserRepository) GetIDByEmail(ctx context.Context, email string) (string
 	}
 	return id, nil
 }
+
+// Verify marks the user's email as verified
+func (r *UserRepository) Verify(ctx context.Context, id string) error {
+	query := `
+		UPDATE users SET verified = TRUE WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// UpdatePassword replaces the user's hashed password
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, password string) error {
+	query := `
+		UPDATE users SET password = $2 WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id, password)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// PostResetCode stores a password reset code, replacing any outstanding code of the user
+func (r *UserRepository) PostResetCode(ctx context.Context, code *model.ResetCode) error {
+	query := `
+		INSERT INTO password_reset_codes (user_id, code_hash, expires_at, attempts) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET code_hash = $2, expires_at = $3, attempts = $4
+	`
+	_, err := r.db.ExecContext(ctx, query, code.UserID, code.Hash, code.ExpiresAt, code.Attempts)
+	return err
+}
+
+// GetResetCode retrieves the outstanding password reset code of a user
+func (r *UserRepository) GetResetCode(ctx context.Context, userID string) (*model.ResetCode, error) {
+	query := `
+		SELECT user_id, code_hash, expires_at, attempts FROM password_reset_codes WHERE user_id = $1
+	`
+	code := &model.ResetCode{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&code.UserID, &code.Hash, &code.ExpiresAt, &code.Attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return code, nil
+}
+
+// IncrementResetCodeAttempts counts a wrong guess of the user's password reset code
+func (r *UserRepository) IncrementResetCodeAttempts(ctx context.Context, userID string) error {
+	query := `
+		UPDATE password_reset_codes SET attempts = attempts + 1 WHERE user_id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteResetCode removes the outstanding password reset code of a user
+func (r *UserRepository) DeleteResetCode(ctx context.Context, userID string) error {
+	query := `
+		DELETE FROM password_reset_codes WHERE user_id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
 	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
 )
 
@@ -112,4 +114,216 @@ func TestUserRepository(t *testing.T) {
 			t.Errorf("Retrieved user ID does not match original user ID")
 		}
 	})
+	// Test Verify
+	t.Run("TestVerify", func(t *testing.T) {
+		if err := repo.Verify(ctx, user.ID); err != nil {
+			t.Errorf("Error verifying user: %v\n", err)
+		}
+		retrievedUser, err := repo.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error retrieving user: %v\n", err)
+		}
+		if !retrievedUser.Verified {
+			t.Errorf("Expected user to be verified")
+		}
+	})
+
+	// Test reset codes
+	t.Run("TestResetCode", func(t *testing.T) {
+		code := &model.ResetCode{UserID: user.ID, Hash: "test_hash", ExpiresAt: time.Now().Add(time.Minute)}
+		if err := repo.PostResetCode(ctx, code); err != nil {
+			t.Errorf("Error posting reset code: %v\n", err)
+		}
+		if err := repo.IncrementResetCodeAttempts(ctx, user.ID); err != nil {
+			t.Errorf("Error incrementing reset code attempts: %v\n", err)
+		}
+		retrievedCode, err := repo.GetResetCode(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error retrieving reset code: %v\n", err)
+		}
+		if retrievedCode.Hash != code.Hash || retrievedCode.Attempts != 1 {
+			t.Errorf("Retrieved reset code does not match original code: %v != %v", code, retrievedCode)
+		}
+		if err := repo.DeleteResetCode(ctx, user.ID); err != nil {
+			t.Errorf("Error deleting reset code: %v\n", err)
+		}
+		if _, err := repo.GetResetCode(ctx, user.ID); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test MFA
+	t.Run("TestMFA", func(t *testing.T) {
+		if err := repo.PostMFA(ctx, &model.MFA{UserID: user.ID, Secret: "test_secret"}); err != nil {
+			t.Errorf("Error posting MFA: %v\n", err)
+		}
+		if err := repo.EnableMFA(ctx, user.ID); err != nil {
+			t.Errorf("Error enabling MFA: %v\n", err)
+		}
+		mfa, err := repo.GetMFA(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error retrieving MFA: %v\n", err)
+		}
+		if mfa.Secret != "test_secret" || !mfa.Enabled {
+			t.Errorf("Retrieved MFA does not match original: %v", mfa)
+		}
+
+		if err := repo.UseMFAStep(ctx, user.ID, 10); err != nil {
+			t.Errorf("Error using MFA step: %v\n", err)
+		}
+		if err := repo.UseMFAStep(ctx, user.ID, 10); err != repository.ErrTokenReused {
+			t.Errorf("Expected %v, got %v\n", repository.ErrTokenReused, err)
+		}
+
+		if err := repo.PostRecoveryCodes(ctx, user.ID, []string{"hash1", "hash2"}); err != nil {
+			t.Errorf("Error posting recovery codes: %v\n", err)
+		}
+		if err := repo.UseRecoveryCode(ctx, user.ID, "hash1"); err != nil {
+			t.Errorf("Error using recovery code: %v\n", err)
+		}
+		if err := repo.UseRecoveryCode(ctx, user.ID, "hash1"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+
+		if err := repo.DeleteMFA(ctx, user.ID); err != nil {
+			t.Errorf("Error deleting MFA: %v\n", err)
+		}
+		if _, err := repo.GetMFA(ctx, user.ID); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+		if err := repo.UseRecoveryCode(ctx, user.ID, "hash2"); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test linked identities
+	t.Run("TestIdentity", func(t *testing.T) {
+		identity := &model.Identity{Provider: "test", Subject: "test_subject", UserID: user.ID, Email: user.Email, CreatedAt: time.Now()}
+		if err := repo.PostIdentity(ctx, identity); err != nil {
+			t.Errorf("Error posting identity: %v\n", err)
+		}
+		if err := repo.PostIdentity(ctx, identity); err != repository.ErrDuplicate {
+			t.Errorf("Expected %v, got %v\n", repository.ErrDuplicate, err)
+		}
+		retrievedIdentity, err := repo.GetIdentity(ctx, identity.Provider, identity.Subject)
+		if err != nil {
+			t.Fatalf("Error retrieving identity: %v\n", err)
+		}
+		if retrievedIdentity.UserID != user.ID {
+			t.Errorf("Retrieved identity does not match original identity: %v != %v", identity, retrievedIdentity)
+		}
+		if _, err := repo.GetIdentity(ctx, "other", identity.Subject); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test OAuth states are single use
+	t.Run("TestOAuthState", func(t *testing.T) {
+		state := &model.OAuthState{State: "test_state", Provider: "test", Nonce: "test_nonce", Verifier: "test_verifier", ExpiresAt: time.Now().Add(time.Minute)}
+		if err := repo.PostOAuthState(ctx, state); err != nil {
+			t.Errorf("Error posting OAuth state: %v\n", err)
+		}
+		retrievedState, err := repo.ConsumeOAuthState(ctx, state.State)
+		if err != nil {
+			t.Fatalf("Error consuming OAuth state: %v\n", err)
+		}
+		if retrievedState.Provider != state.Provider || retrievedState.Verifier != state.Verifier || retrievedState.Nonce != state.Nonce {
+			t.Errorf("Retrieved OAuth state does not match original state: %v != %v", state, retrievedState)
+		}
+		if _, err := repo.ConsumeOAuthState(ctx, state.State); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test receivers
+	t.Run("TestReceivers", func(t *testing.T) {
+		receiver, err := model.NewReceiver(user.ID, model.ChannelSMS, "+14155550123")
+		if err != nil {
+			t.Fatalf("Error creating receiver: %v\n", err)
+		}
+		if err := repo.PostReceiver(ctx, receiver); err != nil {
+			t.Errorf("Error posting receiver: %v\n", err)
+		}
+		duplicate, _ := model.NewReceiver(user.ID, model.ChannelSMS, "+14155550123")
+		if err := repo.PostReceiver(ctx, duplicate); err != repository.ErrDuplicate {
+			t.Errorf("Expected %v, got %v\n", repository.ErrDuplicate, err)
+		}
+
+		if err := repo.SetReceiverCode(ctx, receiver.ID, "test_hash", time.Now().Add(time.Minute)); err != nil {
+			t.Errorf("Error setting receiver code: %v\n", err)
+		}
+		if err := repo.IncrementReceiverCodeAttempts(ctx, receiver.ID); err != nil {
+			t.Errorf("Error incrementing receiver code attempts: %v\n", err)
+		}
+		retrievedReceiver, err := repo.GetReceiver(ctx, receiver.ID)
+		if err != nil {
+			t.Fatalf("Error retrieving receiver: %v\n", err)
+		}
+		if retrievedReceiver.Address != receiver.Address || retrievedReceiver.CodeHash != "test_hash" || retrievedReceiver.CodeAttempts != 1 {
+			t.Errorf("Retrieved receiver does not match original receiver: %v != %v", receiver, retrievedReceiver)
+		}
+
+		if err := repo.VerifyReceiver(ctx, receiver.ID); err != nil {
+			t.Errorf("Error verifying receiver: %v\n", err)
+		}
+		if err := repo.UpdateReceiverAddress(ctx, receiver.ID, "+14155550124"); err != nil {
+			t.Errorf("Error updating receiver address: %v\n", err)
+		}
+		receivers, err := repo.ListReceivers(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error listing receivers: %v\n", err)
+		}
+		var found *model.Receiver
+		for _, r := range receivers {
+			if r.ID == receiver.ID {
+				found = r
+			}
+		}
+		if found == nil || found.Address != "+14155550124" || found.Verified {
+			t.Errorf("Expected updated unverified receiver, got %v", found)
+		}
+
+		webhook, err := model.NewReceiver(user.ID, model.ChannelWebhook, "https://example.com/hook")
+		if err != nil {
+			t.Fatalf("Error creating receiver: %v\n", err)
+		}
+		if err := repo.PostReceiver(ctx, webhook); err != nil {
+			t.Errorf("Error posting receiver: %v\n", err)
+		}
+		if retrieved, err := repo.GetReceiver(ctx, webhook.ID); err != nil || retrieved.Secret != webhook.Secret {
+			t.Errorf("Expected the webhook secret, got %v, %v\n", retrieved, err)
+		}
+
+		if err := repo.DeleteReceiver(ctx, receiver.ID); err != nil {
+			t.Errorf("Error deleting receiver: %v\n", err)
+		}
+		if _, err := repo.GetReceiver(ctx, receiver.ID); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
+
+	// Test outbox events are stored with the user and listed until they're sent
+	t.Run("TestOutbox", func(t *testing.T) {
+		other, err := model.NewUser("outbox@example.com", "password")
+		if err != nil {
+			t.Fatalf("Error creating user: %v\n", err)
+		}
+		event := model.NewOutboxEvent("notifications", "UserRegistered", "1", []byte(other.ID), time.Now())
+		if err := repo.Post(ctx, other, event); err != nil {
+			t.Fatalf("Error posting user: %v\n", err)
+		}
+		pending, err := repo.ListOutbox(ctx, 10)
+		if err != nil || len(pending) != 1 || pending[0].ID != event.ID || string(pending[0].Payload) != other.ID {
+			t.Fatalf("Expected the outbox event, got %v, %v\n", pending, err)
+		}
+		if err := repo.MarkOutboxSent(ctx, event.ID, time.Now()); err != nil {
+			t.Errorf("Error marking event sent: %v\n", err)
+		}
+		if pending, err := repo.ListOutbox(ctx, 10); err != nil || len(pending) != 0 {
+			t.Errorf("Expected no pending events, got %v, %v\n", pending, err)
+		}
+		if err := repo.MarkOutboxSent(ctx, "unknown", time.Now()); err != repository.ErrNotFound {
+			t.Errorf("Expected %v, got %v\n", repository.ErrNotFound, err)
+		}
+	})
 }
@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// PostReceiver adds a receiver to a user
+func (r *UserRepository) PostReceiver(ctx context.Context, receiver *model.Receiver) error {
+	query := `
+		INSERT INTO user_receivers (id, user_id, channel, address, verified, created_at, secret) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, channel, address) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, receiver.ID, receiver.UserID, receiver.Channel, receiver.Address, receiver.Verified, receiver.CreatedAt, receiver.Secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrDuplicate
+	}
+	return nil
+}
+
+// GetReceiver retrieves a receiver by id
+func (r *UserRepository) GetReceiver(ctx context.Context, id string) (*model.Receiver, error) {
+	query := `
+		SELECT id, user_id, channel, address, verified, created_at, code_hash, code_expires_at, code_attempts, secret
+		FROM user_receivers WHERE id = $1
+	`
+	receiver, err := scanReceiver(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return receiver, nil
+}
+
+// ListReceivers retrieves the receivers of a user, oldest first
+func (r *UserRepository) ListReceivers(ctx context.Context, userID string) ([]*model.Receiver, error) {
+	query := `
+		SELECT id, user_id, channel, address, verified, created_at, code_hash, code_expires_at, code_attempts, secret
+		FROM user_receivers WHERE user_id = $1 ORDER BY created_at
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receivers := []*model.Receiver{}
+	for rows.Next() {
+		receiver, err := scanReceiver(rows)
+		if err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, receiver)
+	}
+	return receivers, rows.Err()
+}
+
+// UpdateReceiverAddress changes the address of a receiver, which has to be verified again
+func (r *UserRepository) UpdateReceiverAddress(ctx context.Context, id, address string) error {
+	query := `
+		UPDATE user_receivers SET address = $2, verified = FALSE, code_hash = '', code_expires_at = NULL, code_attempts = 0
+		WHERE id = $1 AND NOT EXISTS (
+			SELECT 1 FROM user_receivers o
+			WHERE o.user_id = user_receivers.user_id AND o.channel = user_receivers.channel AND o.address = $2
+		)
+	`
+	res, err := r.db.ExecContext(ctx, query, id, address)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := r.GetReceiver(ctx, id); err != nil {
+			return err
+		}
+		return repository.ErrDuplicate
+	}
+	return nil
+}
+
+// DeleteReceiver removes a receiver
+func (r *UserRepository) DeleteReceiver(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM user_receivers WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// SetReceiverCode stores the verification code of a receiver, replacing any outstanding code
+func (r *UserRepository) SetReceiverCode(ctx context.Context, id, hash string, expiresAt time.Time) error {
+	query := `
+		UPDATE user_receivers SET code_hash = $2, code_expires_at = $3, code_attempts = 0 WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id, hash, expiresAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// IncrementReceiverCodeAttempts counts a wrong guess of a receiver's verification code
+func (r *UserRepository) IncrementReceiverCodeAttempts(ctx context.Context, id string) error {
+	query := `
+		UPDATE user_receivers SET code_attempts = code_attempts + 1 WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// VerifyReceiver marks a receiver as verified and discards its verification code
+func (r *UserRepository) VerifyReceiver(ctx context.Context, id string) error {
+	query := `
+		UPDATE user_receivers SET verified = TRUE, code_hash = '', code_expires_at = NULL, code_attempts = 0 WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReceiver(row scanner) (*model.Receiver, error) {
+	receiver := &model.Receiver{}
+	var codeExpiresAt sql.NullTime
+	err := row.Scan(&receiver.ID, &receiver.UserID, &receiver.Channel, &receiver.Address, &receiver.Verified, &receiver.CreatedAt,
+		&receiver.CodeHash, &codeExpiresAt, &receiver.CodeAttempts, &receiver.Secret)
+	if err != nil {
+		return nil, err
+	}
+	receiver.CodeExpiresAt = codeExpiresAt.Time
+	return receiver, nil
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+// TokenRepository defines a PostgreSQL refresh token and revocation repository
+type TokenRepository struct {
+	db *sql.DB
+}
+
+// NewTokenRepository creates a new PostgreSQL token repository
+func NewTokenRepository(db *sql.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// PostRefreshToken adds a new refresh token
+func (r *TokenRepository) PostRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (token_hash, session_id, user_id, expires_at) VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.db.ExecContext(ctx, query, token.Hash, token.SessionID, token.UserID, token.ExpiresAt)
+	return err
+}
+
+// GetRefreshToken retrieves a refresh token by hash
+func (r *TokenRepository) GetRefreshToken(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	query := `
+		SELECT token_hash, session_id, user_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = $1
+	`
+	token := &model.RefreshToken{}
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(&token.Hash, &token.SessionID, &token.UserID, &token.ExpiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// UseRefreshToken marks a refresh token as used, a token can only be used once
+func (r *TokenRepository) UseRefreshToken(ctx context.Context, hash string) error {
+	query := `
+		UPDATE refresh_tokens SET used_at = $2 WHERE token_hash = $1 AND used_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, hash, time.Now())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := r.GetRefreshToken(ctx, hash); err != nil {
+			return err
+		}
+		return repository.ErrTokenReused
+	}
+	return nil
+}
+
+// RevokeSession stops accepting tokens issued for the session
+func (r *TokenRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	query := `
+		INSERT INTO revoked_sessions (session_id, revoked_at) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, query, sessionID, time.Now())
+	return err
+}
+
+// RevokeUserSessions stops accepting tokens issued for any session of the user
+func (r *TokenRepository) RevokeUserSessions(ctx context.Context, userID string) error {
+	query := `
+		INSERT INTO revoked_sessions (session_id, revoked_at)
+		SELECT DISTINCT session_id, $2::TIMESTAMPTZ FROM refresh_tokens WHERE user_id = $1
+		ON CONFLICT DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, time.Now())
+	return err
+}
+
+// IsSessionRevoked reports whether the session has been revoked
+func (r *TokenRepository) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_sessions WHERE session_id = $1)
+	`
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, query, sessionID).Scan(&revoked)
+	return revoked, err
+}
+
+// ListRevokedSessions retrieves sessions revoked after the given time
+func (r *TokenRepository) ListRevokedSessions(ctx context.Context, since time.Time) ([]*model.RevokedSession, error) {
+	query := `
+		SELECT session_id, revoked_at FROM revoked_sessions WHERE revoked_at > $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*model.RevokedSession
+	for rows.Next() {
+		session := &model.RevokedSession{}
+		if err := rows.Scan(&session.SessionID, &session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+)
+
+func TestTokenRepository(t *testing.T) {
+	db, err := setupTestDB()
+	if err != nil {
+		t.Fatalf("Error setting up test database: %v\n", err)
+	}
+	defer teardownTestDB(db)
+
+	repo := NewTokenRepository(db)
+
+	ctx := context.Background()
+	token := &model.RefreshToken{
+		Hash:      "test_hash",
+		SessionID: "test_session_id",
+		UserID:    "test_user_id",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	// Test PostRefreshToken & GetRefreshToken
+	t.Run("TestPostRefreshToken", func(t *testing.T) {
+		err := repo.PostRefreshToken(ctx, token)
+		if err != nil {
+			t.Errorf("Error posting refresh token: %v\n", err)
+		}
+
+		retrievedToken, err := repo.GetRefreshToken(ctx, token.Hash)
+		if err != nil {
+			t.Fatalf("Error retrieving refresh token: %v\n", err)
+		}
+		if retrievedToken.SessionID != token.SessionID || retrievedToken.UserID != token.UserID || retrievedToken.UsedAt != nil {
+			t.Errorf("Retrieved refresh token does not match original token: %v != %v", token, retrievedToken)
+		}
+	})
+
+	// Test UseRefreshToken only succeeds once
+	t.Run("TestUseRefreshToken", func(t *testing.T) {
+		if err := repo.UseRefreshToken(ctx, token.Hash); err != nil {
+			t.Errorf("Error using refresh token: %v\n", err)
+		}
+		if err := repo.UseRefreshToken(ctx, token.Hash); err != repository.ErrTokenReused {
+			t.Errorf("Expected %v, got %v\n", repository.ErrTokenReused, err)
+		}
+	})
+
+	// Test RevokeSession & IsSessionRevoked
+	t.Run("TestRevokeSession", func(t *testing.T) {
+		since := time.Now().Add(-time.Second)
+		if err := repo.RevokeSession(ctx, token.SessionID); err != nil {
+			t.Errorf("Error revoking session: %v\n", err)
+		}
+
+		revoked, err := repo.IsSessionRevoked(ctx, token.SessionID)
+		if err != nil {
+			t.Errorf("Error checking session: %v\n", err)
+		}
+		if !revoked {
+			t.Errorf("Expected session %s to be revoked", token.SessionID)
+		}
+
+		sessions, err := repo.ListRevokedSessions(ctx, since)
+		if err != nil {
+			t.Errorf("Error listing revoked sessions: %v\n", err)
+		}
+		if len(sessions) != 1 || sessions[0].SessionID != token.SessionID {
+			t.Errorf("Expected revoked session %s, got %v", token.SessionID, sessions)
+		}
+	})
+}
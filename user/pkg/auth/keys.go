@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ErrUnsupportedKey is returned for keys that are neither RSA nor Ed25519
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// SigningKey defines a private key new tokens are signed with
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// NewSigningKey creates a signing key, picking RS256 or EdDSA from the key type
+func NewSigningKey(id string, key crypto.PrivateKey) (*SigningKey, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Key: k}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Key: k}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// VerificationKey returns the public half of the signing key
+func (k *SigningKey) VerificationKey() VerificationKey {
+	return VerificationKey{ID: k.ID, Algorithm: k.Method.Alg(), Key: k.Key.Public()}
+}
+
+// VerificationKey defines a public key tokens can be verified with
+type VerificationKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.PublicKey
+}
+
+// MarshalPublicKey encodes the key as DER so it can be published to other services.
+// Only RSA and Ed25519 public keys are published, a shared secret would let anyone forge tokens.
+func (k VerificationKey) MarshalPublicKey() ([]byte, error) {
+	if alg, err := algorithmFor(k.Key); err != nil || alg != k.Algorithm {
+		return nil, ErrUnsupportedKey
+	}
+	return x509.MarshalPKIXPublicKey(k.Key)
+}
+
+// ParseVerificationKey decodes a DER encoded public key published by MarshalPublicKey,
+// the algorithm has to match the key type
+func ParseVerificationKey(id, alg string, der []byte) (VerificationKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return VerificationKey{}, err
+	}
+	if keyAlg, err := algorithmFor(key); err != nil || keyAlg != alg {
+		return VerificationKey{}, ErrUnsupportedKey
+	}
+	return VerificationKey{ID: id, Algorithm: alg, Key: key}, nil
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens may still be verified with.
+//
+// Rotating to a new key keeps the previous one available for verification,
+// so tokens it signed stay valid until they expire or the key is retired.
+type KeySet struct {
+	sync.RWMutex
+	signing      *SigningKey
+	verification []VerificationKey
+}
+
+// NewKeySet creates a key set signing with the given key and also accepting the extra verification keys
+func NewKeySet(signing *SigningKey, verification ...VerificationKey) *KeySet {
+	ks := &KeySet{signing: signing}
+	ks.verification = append([]VerificationKey{signing.VerificationKey()}, verification...)
+	return ks
+}
+
+// Rotate makes the key the one new tokens are signed with
+func (ks *KeySet) Rotate(signing *SigningKey) {
+	ks.Lock()
+	defer ks.Unlock()
+	ks.signing = signing
+	ks.verification = append([]VerificationKey{signing.VerificationKey()}, ks.removeKey(signing.ID)...)
+}
+
+// Retire stops accepting tokens signed with the key, the active signing key can't be retired
+func (ks *KeySet) Retire(id string) {
+	ks.Lock()
+	defer ks.Unlock()
+	if ks.signing.ID == id {
+		return
+	}
+	ks.verification = ks.removeKey(id)
+}
+
+func (ks *KeySet) removeKey(id string) []VerificationKey {
+	keys := make([]VerificationKey, 0, len(ks.verification))
+	for _, k := range ks.verification {
+		if k.ID != id {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// SigningKey returns the key new tokens are signed with
+func (ks *KeySet) SigningKey() *SigningKey {
+	ks.RLock()
+	defer ks.RUnlock()
+	return ks.signing
+}
+
+// VerificationKeys returns the keys currently accepted for token verification
+func (ks *KeySet) VerificationKeys() []VerificationKey {
+	ks.RLock()
+	defer ks.RUnlock()
+	return append([]VerificationKey(nil), ks.verification...)
+}
+
+// LoadKeySet loads the key set described by the environment.
+//
+// JWT_KEYS_DIR points to a directory of PEM files named <kid>.pem. Private keys
+// (PKCS#8 or PKCS#1) can sign, public keys (PKIX) are only used for verification.
+// JWT_SIGNING_KEY_ID selects the key new tokens are signed with. Rotating means
+// adding the new private key, pointing JWT_SIGNING_KEY_ID at it and removing the
+// old file once every token it signed has expired.
+//
+// Without JWT_KEYS_DIR an ephemeral Ed25519 key is generated, which is only
+// suitable for a single replica in development.
+func LoadKeySet() (*KeySet, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		log.Println("JWT_KEYS_DIR not set, signing tokens with an ephemeral key")
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signing, err := NewSigningKey("ephemeral", key)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(signing), nil
+	}
+	return LoadKeySetFromDir(dir, os.Getenv("JWT_SIGNING_KEY_ID"))
+}
+
+// LoadKeySetFromDir loads every <kid>.pem key in the directory, signing with the key signingID
+func LoadKeySetFromDir(dir, signingID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var signing *SigningKey
+	var verification []VerificationKey
+	for _, f := range files {
+		id := strings.TrimSuffix(filepath.Base(f), ".pem")
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		private, public, err := parsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		if private == nil {
+			if id == signingID {
+				return nil, fmt.Errorf("key %s: signing key must be a private key", id)
+			}
+			alg, err := algorithmFor(public)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", id, err)
+			}
+			verification = append(verification, VerificationKey{ID: id, Algorithm: alg, Key: public})
+			continue
+		}
+
+		k, err := NewSigningKey(id, private)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if id == signingID {
+			signing = k
+		} else {
+			verification = append(verification, k.VerificationKey())
+		}
+	}
+
+	if signing == nil {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingID, dir)
+	}
+	return NewKeySet(signing, verification...), nil
+}
+
+func parsePEM(data []byte) (crypto.PrivateKey, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, jwt.ErrKeyMustBePEMEncoded
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		return nil, public, err
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		return private, nil, err
+	default:
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		return private, nil, err
+	}
+}
+
+func algorithmFor(key crypto.PublicKey) (string, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg(), nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	}
+	return "", ErrUnsupportedKey
+}
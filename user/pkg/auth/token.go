@@ -1,40 +1,155 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"time"
 
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
 	"github.com/golang-jwt/jwt"
 )
 
 var (
-	JWTKey = []byte("your-secret-key")
+	// AccessTokenTTL is how long access tokens are valid for
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long refresh tokens are valid for
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// VerificationTokenTTL is how long email verification links are valid for
+	VerificationTokenTTL = 24 * time.Hour
+	// MFAChallengeTTL is how long a user has to complete the second factor after their password
+	MFAChallengeTTL = 5 * time.Minute
+)
+
+const (
+	subjectAccess       = "auth"
+	subjectVerification = "verify_email"
+	subjectMFAChallenge = "mfa_challenge"
+)
+
+var (
+	// ErrUnknownKey is returned when a token is signed with a key that is not in the verification key set
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrInvalidToken is returned when a token fails verification
+	ErrInvalidToken = errors.New("invalid token")
 )
 
 // Claims defines the JWT claims structure
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`
+	Verified  bool   `json:"verified"`
 	jwt.StandardClaims
 }
 
-// GenerateToken generates a JWT token
-func GenerateToken(userID string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateToken generates a JWT access token signed with the active key of the key set
+func (ks *KeySet) GenerateToken(user *model.User, sessionID string) (string, error) {
+	return ks.sign(&Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		SessionID:      sessionID,
+		Verified:       user.Verified,
+		StandardClaims: standardClaims(subjectAccess, AccessTokenTTL),
+	})
+}
+
+// GenerateVerificationToken generates a token proving the user received mail at the address
+func (ks *KeySet) GenerateVerificationToken(user *model.User) (string, error) {
+	return ks.sign(&Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		StandardClaims: standardClaims(subjectVerification, VerificationTokenTTL),
+	})
+}
+
+// GenerateMFAChallenge generates a token proving the user passed the password step of a login
+func (ks *KeySet) GenerateMFAChallenge(user *model.User) (string, error) {
+	return ks.sign(&Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		StandardClaims: standardClaims(subjectMFAChallenge, MFAChallengeTTL),
+	})
+}
 
-	claims := &Claims{
-		UserID: userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-			IssuedAt:  time.Now().Unix(),
-			Subject:   "auth",
-		},
+func standardClaims(subject string, ttl time.Duration) jwt.StandardClaims {
+	return jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		IssuedAt:  time.Now().Unix(),
+		Subject:   subject,
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+func (ks *KeySet) sign(claims *Claims) (string, error) {
+	key := ks.SigningKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	tokenString, err := token.SignedString(JWTKey)
+	tokenString, err := token.SignedString(key.Key)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// ParseToken verifies a JWT access token against the given keys and returns its claims
+func ParseToken(tokenString string, keys []VerificationKey) (*Claims, error) {
+	return parse(tokenString, keys, subjectAccess)
+}
+
+// ParseVerificationToken verifies an email verification token against the given keys and returns its claims
+func ParseVerificationToken(tokenString string, keys []VerificationKey) (*Claims, error) {
+	return parse(tokenString, keys, subjectVerification)
+}
+
+// ParseMFAChallenge verifies an MFA challenge token against the given keys and returns its claims
+func ParseMFAChallenge(tokenString string, keys []VerificationKey) (*Claims, error) {
+	return parse(tokenString, keys, subjectMFAChallenge)
+}
+
+func parse(tokenString string, keys []VerificationKey, subject string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, k := range keys {
+			if k.ID != kid {
+				continue
+			}
+			if token.Method.Alg() != k.Algorithm {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return k.Key, nil
+		}
+		return nil, ErrUnknownKey
+	})
+	if err != nil {
+		var ve *jwt.ValidationError
+		if errors.As(err, &ve) && ve.Inner == ErrUnknownKey {
+			return nil, ErrUnknownKey
+		}
+		return nil, ErrInvalidToken
+	}
+	if !token.Valid || claims.UserID == "" || claims.Subject != subject {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// GenerateRefreshToken generates an opaque refresh token and the hash it should be stored under
+func GenerateRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken hashes an opaque token for storage and lookup
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func newRSAKey(t *testing.T, id string) *SigningKey {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating RSA key: %v", err)
+	}
+	key, err := NewSigningKey(id, private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+	return key
+}
+
+func newEd25519Key(t *testing.T, id string) *SigningKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating Ed25519 key: %v", err)
+	}
+	key, err := NewSigningKey(id, private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+	return key
+}
+
+func TestKeyRotation(t *testing.T) {
+	keyA := newRSAKey(t, "key-a")
+	keyB := newEd25519Key(t, "key-b")
+	ks := NewKeySet(keyA)
+
+	var tokenA string
+
+	// Test signing with key A
+	t.Run("TestSignWithKeyA", func(t *testing.T) {
+		var err error
+		tokenA, err = ks.GenerateToken(&model.User{ID: "user1", Email: "user1@example.com"}, "session1")
+		if err != nil {
+			t.Fatalf("Error generating token: %v", err)
+		}
+		claims, err := ParseToken(tokenA, ks.VerificationKeys())
+		if err != nil {
+			t.Fatalf("Error parsing token: %v", err)
+		}
+		if claims.UserID != "user1" || claims.Email != "user1@example.com" {
+			t.Errorf("Unexpected claims: %v", claims)
+		}
+	})
+
+	// Test rotating to key B keeps key A tokens valid
+	t.Run("TestRotateToKeyB", func(t *testing.T) {
+		ks.Rotate(keyB)
+		if ks.SigningKey().ID != keyB.ID {
+			t.Errorf("Expected signing key %s, got %s", keyB.ID, ks.SigningKey().ID)
+		}
+
+		tokenB, err := ks.GenerateToken(&model.User{ID: "user2", Email: "user2@example.com"}, "session1")
+		if err != nil {
+			t.Fatalf("Error generating token: %v", err)
+		}
+		if _, err := ParseToken(tokenB, ks.VerificationKeys()); err != nil {
+			t.Errorf("Error parsing key B token: %v", err)
+		}
+		if _, err := ParseToken(tokenA, ks.VerificationKeys()); err != nil {
+			t.Errorf("Error parsing key A token after rotation: %v", err)
+		}
+	})
+
+	// Test retiring key A rejects its tokens
+	t.Run("TestRetireKeyA", func(t *testing.T) {
+		ks.Retire(keyA.ID)
+		if _, err := ParseToken(tokenA, ks.VerificationKeys()); err != ErrUnknownKey {
+			t.Errorf("Expected %v, got %v", ErrUnknownKey, err)
+		}
+	})
+
+	// Test published keys round trip
+	t.Run("TestPublishedKeys", func(t *testing.T) {
+		token, err := ks.GenerateToken(&model.User{ID: "user3", Email: "user3@example.com"}, "session1")
+		if err != nil {
+			t.Fatalf("Error generating token: %v", err)
+		}
+		var published []VerificationKey
+		for _, k := range ks.VerificationKeys() {
+			der, err := k.MarshalPublicKey()
+			if err != nil {
+				t.Fatalf("Error marshaling key: %v", err)
+			}
+			key, err := ParseVerificationKey(k.ID, k.Algorithm, der)
+			if err != nil {
+				t.Fatalf("Error parsing key: %v", err)
+			}
+			published = append(published, key)
+		}
+		if _, err := ParseToken(token, published); err != nil {
+			t.Errorf("Error parsing token with published keys: %v", err)
+		}
+
+		// Shared secrets are never published, and published keys only verify their own algorithm
+		if _, err := (VerificationKey{ID: "hmac", Algorithm: jwt.SigningMethodHS256.Alg(), Key: []byte("secret")}).MarshalPublicKey(); err != ErrUnsupportedKey {
+			t.Errorf("Expected %v, got %v", ErrUnsupportedKey, err)
+		}
+		der, err := published[0].MarshalPublicKey()
+		if err != nil {
+			t.Fatalf("Error marshaling key: %v", err)
+		}
+		if _, err := ParseVerificationKey(published[0].ID, jwt.SigningMethodHS256.Alg(), der); err != ErrUnsupportedKey {
+			t.Errorf("Expected %v, got %v", ErrUnsupportedKey, err)
+		}
+	})
+
+	// Test tokens from a foreign key with a known kid are rejected
+	t.Run("TestForgedToken", func(t *testing.T) {
+		forged, err := NewKeySet(newEd25519Key(t, keyB.ID)).GenerateToken(&model.User{ID: "user1", Email: "user1@example.com"}, "session1")
+		if err != nil {
+			t.Fatalf("Error generating token: %v", err)
+		}
+		if _, err := ParseToken(forged, ks.VerificationKeys()); err != ErrInvalidToken {
+			t.Errorf("Expected %v, got %v", ErrInvalidToken, err)
+		}
+	})
+}
+
+func TestTokenPurpose(t *testing.T) {
+	ks := NewKeySet(newEd25519Key(t, "key-a"))
+	user := &model.User{ID: "user1", Email: "user1@example.com"}
+
+	accessToken, err := ks.GenerateToken(user, "session1")
+	if err != nil {
+		t.Fatalf("Error generating token: %v", err)
+	}
+	verificationToken, err := ks.GenerateVerificationToken(user)
+	if err != nil {
+		t.Fatalf("Error generating verification token: %v", err)
+	}
+
+	if _, err := ParseVerificationToken(verificationToken, ks.VerificationKeys()); err != nil {
+		t.Errorf("Error parsing verification token: %v", err)
+	}
+	if _, err := ParseToken(verificationToken, ks.VerificationKeys()); err != ErrInvalidToken {
+		t.Errorf("Expected verification token to be rejected as access token, got %v", err)
+	}
+	if _, err := ParseVerificationToken(accessToken, ks.VerificationKeys()); err != ErrInvalidToken {
+		t.Errorf("Expected access token to be rejected as verification token, got %v", err)
+	}
+}
+
+func TestLoadKeySetFromDir(t *testing.T) {
+	dir := t.TempDir()
+
+	keyA := newRSAKey(t, "key-a")
+	keyB := newEd25519Key(t, "key-b")
+
+	private, err := x509.MarshalPKCS8PrivateKey(keyB.Key)
+	if err != nil {
+		t.Fatalf("Error marshaling private key: %v", err)
+	}
+	public, err := keyA.VerificationKey().MarshalPublicKey()
+	if err != nil {
+		t.Fatalf("Error marshaling public key: %v", err)
+	}
+	files := map[string]*pem.Block{
+		"key-a.pem": {Type: "PUBLIC KEY", Bytes: public},
+		"key-b.pem": {Type: "PRIVATE KEY", Bytes: private},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("Error writing key file: %v", err)
+		}
+	}
+
+	tokenA, err := NewKeySet(keyA).GenerateToken(&model.User{ID: "user1", Email: "user1@example.com"}, "session1")
+	if err != nil {
+		t.Fatalf("Error generating token: %v", err)
+	}
+
+	ks, err := LoadKeySetFromDir(dir, "key-b")
+	if err != nil {
+		t.Fatalf("Error loading key set: %v", err)
+	}
+	if ks.SigningKey().ID != "key-b" {
+		t.Errorf("Expected signing key key-b, got %s", ks.SigningKey().ID)
+	}
+	if _, err := ParseToken(tokenA, ks.VerificationKeys()); err != nil {
+		t.Errorf("Error parsing token signed with retired key: %v", err)
+	}
+
+	if _, err := LoadKeySetFromDir(dir, "key-a"); err == nil {
+		t.Errorf("Expected error signing with a public key")
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the RFC 6238 SHA1 test key "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTP(t *testing.T) {
+	// Expected codes are the last six digits of the RFC 6238 test vectors
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range tests {
+		code, err := GenerateTOTP(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("Error generating code: %v", err)
+		}
+		if code != expected {
+			t.Errorf("Expected code %s at %d, got %s", expected, unix, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Error generating secret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, err := GenerateTOTP(secret, now)
+	if err != nil {
+		t.Fatalf("Error generating code: %v", err)
+	}
+
+	// Test the code is accepted within the allowed drift
+	for _, at := range []time.Time{now, now.Add(-TOTPPeriod), now.Add(TOTPPeriod)} {
+		step, ok := ValidateTOTP(secret, code, at)
+		if !ok {
+			t.Errorf("Expected code to be valid at %v", at)
+		}
+		if step != TOTPStep(now) {
+			t.Errorf("Expected step %d, got %d", TOTPStep(now), step)
+		}
+	}
+
+	// Test the code is rejected outside the allowed drift
+	if _, ok := ValidateTOTP(secret, code, now.Add(3*TOTPPeriod)); ok {
+		t.Errorf("Expected code to be rejected after drift window")
+	}
+	if _, ok := ValidateTOTP(secret, "abc", now); ok {
+		t.Errorf("Expected malformed code to be rejected")
+	}
+}
@@ -0,0 +1,95 @@
+// Package client gives other services access to users through the user service's gRPC API
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotFound is returned when the requested user doesn't exist
+	ErrNotFound = errors.New("user not found")
+	// ErrInvalidToken is returned when the user service rejects an access token
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Client defines a user service client
+type Client struct {
+	conn *grpc.ClientConn
+	auth gen.AuthServiceClient
+}
+
+// New creates a user service client connected to addr
+func New(addr string) (*Client, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, auth: gen.NewAuthServiceClient(conn)}, nil
+}
+
+// Close closes the connection to the user service
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// GetUser returns a user by id
+func (c *Client) GetUser(ctx context.Context, id string) (*model.User, error) {
+	resp, err := c.auth.GetUser(ctx, &gen.GetUserRequest{Id: id})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return model.UserFromProto(resp.GetUser()), nil
+}
+
+// BatchGetUsers returns the users with the given ids keyed by id, unknown ids are left out
+func (c *Client) BatchGetUsers(ctx context.Context, ids []string) (map[string]*model.User, error) {
+	resp, err := c.auth.BatchGetUsers(ctx, &gen.BatchGetUsersRequest{Ids: ids})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	users := make(map[string]*model.User, len(resp.GetUsers()))
+	for _, u := range resp.GetUsers() {
+		users[u.GetId()] = model.UserFromProto(u)
+	}
+	return users, nil
+}
+
+// LookupByEmail returns the user registered with the email
+func (c *Client) LookupByEmail(ctx context.Context, email string) (*model.User, error) {
+	resp, err := c.auth.LookupByEmail(ctx, &gen.LookupByEmailRequest{Email: email})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return model.UserFromProto(resp.GetUser()), nil
+}
+
+// ValidateToken returns the user an access token was issued to, for services authenticating requests themselves
+func (c *Client) ValidateToken(ctx context.Context, token string) (*model.User, error) {
+	resp, err := c.auth.ValidateToken(ctx, &gen.TokenRequest{Token: token})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	if !resp.GetValid() {
+		return nil, ErrInvalidToken
+	}
+	return model.UserFromProto(resp.GetUser()), nil
+}
+
+func fromStatus(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/Azanul/wuphf-dot-com/user/gen"
+	"github.com/Azanul/wuphf-dot-com/user/internal/controller/user"
+	grpchandler "github.com/Azanul/wuphf-dot-com/user/internal/handler/grpc"
+	"github.com/Azanul/wuphf-dot-com/user/internal/repository/memory"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/auth"
+	"github.com/Azanul/wuphf-dot-com/user/pkg/model"
+	"google.golang.org/grpc"
+)
+
+func TestClient(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key, err := auth.NewSigningKey("key-a", private)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+
+	ctx := context.Background()
+	repo := memory.New()
+	users := map[string]*model.User{}
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		u, err := model.NewUser(email, "password")
+		if err != nil {
+			t.Fatalf("Error creating user: %v", err)
+		}
+		if err := repo.Post(ctx, u); err != nil {
+			t.Fatalf("Error posting user: %v", err)
+		}
+		users[email] = u
+	}
+
+	ctrl := user.New(repo, memory.NewTokenRepository(), memory.NewLoginAttemptRepository(), nil, auth.NewKeySet(key), "")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	srv := grpc.NewServer()
+	gen.RegisterAuthServiceServer(srv, grpchandler.New(ctrl))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	c, err := New(lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+	defer c.Close()
+
+	alice := users["alice@example.com"]
+	bob := users["bob@example.com"]
+
+	// Test GetUser
+	t.Run("TestGetUser", func(t *testing.T) {
+		u, err := c.GetUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("Error getting user: %v", err)
+		}
+		if u.ID != alice.ID || u.Email != alice.Email || u.DisplayName() != "alice" {
+			t.Errorf("Retrieved user does not match original user: %v != %v", alice, u)
+		}
+		if len(u.Receivers) != 1 || u.Receivers[0].Channel != model.ChannelEmail || u.Receivers[0].Address != alice.Email {
+			t.Errorf("Expected the email receiver, got %v", u.Receivers)
+		}
+		if _, err := c.GetUser(ctx, "unknown"); err != ErrNotFound {
+			t.Errorf("Expected %v, got %v", ErrNotFound, err)
+		}
+	})
+
+	// Test BatchGetUsers
+	t.Run("TestBatchGetUsers", func(t *testing.T) {
+		res, err := c.BatchGetUsers(ctx, []string{alice.ID, bob.ID, "unknown", alice.ID})
+		if err != nil {
+			t.Fatalf("Error getting users: %v", err)
+		}
+		if len(res) != 2 || res[alice.ID].Email != alice.Email || res[bob.ID].Email != bob.Email {
+			t.Errorf("Unexpected users: %v", res)
+		}
+	})
+
+	// Test LookupByEmail
+	t.Run("TestLookupByEmail", func(t *testing.T) {
+		u, err := c.LookupByEmail(ctx, bob.Email)
+		if err != nil {
+			t.Fatalf("Error looking up user: %v", err)
+		}
+		if u.ID != bob.ID {
+			t.Errorf("Expected user %s, got %s", bob.ID, u.ID)
+		}
+		if _, err := c.LookupByEmail(ctx, "nobody@example.com"); err != ErrNotFound {
+			t.Errorf("Expected %v, got %v", ErrNotFound, err)
+		}
+	})
+
+	// Test ValidateToken
+	t.Run("TestValidateToken", func(t *testing.T) {
+		_, tokens, err := ctrl.Login(ctx, alice.Email, "password", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Error logging in: %v", err)
+		}
+		u, err := c.ValidateToken(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("Error validating token: %v", err)
+		}
+		if u.ID != alice.ID {
+			t.Errorf("Expected user %s, got %s", alice.ID, u.ID)
+		}
+		if _, err := c.ValidateToken(ctx, "invalid"); err != ErrInvalidToken {
+			t.Errorf("Expected %v, got %v", ErrInvalidToken, err)
+		}
+	})
+}
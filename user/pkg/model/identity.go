@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Identity defines an external identity provider account linked to a user
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OAuthState defines an authorization request in flight with an identity provider
+type OAuthState struct {
+	State     string    `json:"state"`
+	Provider  string    `json:"provider"`
+	Nonce     string    `json:"-"`
+	Verifier  string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginAttempts defines the recent failed logins for an account or client address
+type LoginAttempts struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
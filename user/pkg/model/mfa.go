@@ -0,0 +1,9 @@
+package model
+
+// MFA defines a user's TOTP second factor
+type MFA struct {
+	UserID       string `json:"user_id"`
+	Secret       string `json:"-"`
+	Enabled      bool   `json:"enabled"`
+	LastUsedStep int64  `json:"-"`
+}
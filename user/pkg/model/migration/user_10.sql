@@ -0,0 +1,11 @@
+CREATE TABLE outbox (
+    id VARCHAR(255) PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_unsent ON outbox (created_at) WHERE sent_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE user_receivers
+ADD COLUMN secret VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE refresh_tokens (
+    token_hash VARCHAR(255) PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE TABLE revoked_sessions (
+    session_id VARCHAR(255) PRIMARY KEY,
+    revoked_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE password_reset_codes (
+    user_id VARCHAR(255) PRIMARY KEY,
+    code_hash VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0
+);
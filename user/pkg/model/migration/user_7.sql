@@ -0,0 +1,12 @@
+CREATE TABLE user_mfa (
+    user_id VARCHAR(255) PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE mfa_recovery_codes (
+    user_id VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
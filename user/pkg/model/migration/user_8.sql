@@ -0,0 +1,16 @@
+CREATE TABLE user_identities (
+    provider VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE TABLE oauth_states (
+    state VARCHAR(255) PRIMARY KEY,
+    provider VARCHAR(255) NOT NULL,
+    nonce VARCHAR(255) NOT NULL,
+    verifier VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
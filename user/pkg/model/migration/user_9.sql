@@ -0,0 +1,18 @@
+CREATE TABLE user_receivers (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    channel VARCHAR(50) NOT NULL,
+    address TEXT NOT NULL,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    code_hash VARCHAR(255) NOT NULL DEFAULT '',
+    code_expires_at TIMESTAMPTZ,
+    code_attempts INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (user_id, channel, address)
+);
+
+INSERT INTO user_receivers (id, user_id, channel, address, verified, created_at)
+SELECT gen_random_uuid()::TEXT, id, 'email', email, verified, NOW() FROM users WHERE email IS NOT NULL;
+
+ALTER TABLE users
+DROP COLUMN receivers;
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent defines an event waiting to be published. It is stored in the same transaction as
+// the change it announces, so the event is published eventually even if the broker is down.
+type OutboxEvent struct {
+	ID        string     `json:"id"`
+	Topic     string     `json:"topic"`
+	Type      string     `json:"type"`
+	Version   string     `json:"version"`
+	Payload   []byte     `json:"payload"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// NewOutboxEvent creates an unsent event of the given type and schema version
+func NewOutboxEvent(topic, eventType, version string, payload []byte, createdAt time.Time) *OutboxEvent {
+	return &OutboxEvent{
+		ID:        uuid.New().String(),
+		Topic:     topic,
+		Type:      eventType,
+		Version:   version,
+		Payload:   payload,
+		CreatedAt: createdAt,
+	}
+}
@@ -6,16 +6,53 @@ import (
 
 // MetadataToProto converts a User struct into a generated proto counterpart.
 func UserToProto(m *User) *gen.User {
+	receivers := make([]*gen.Receiver, 0, len(m.Receivers))
+	for _, r := range m.Receivers {
+		receivers = append(receivers, ReceiverToProto(r))
+	}
 	return &gen.User{
-		Id:    m.ID,
-		Email: m.Email,
+		Id:          m.ID,
+		Email:       m.Email,
+		Receivers:   receivers,
+		Verified:    m.Verified,
+		DisplayName: m.DisplayName(),
 	}
 }
 
 // MetadataFromProto converts a generated proto counterpart into a User struct.
 func UserFromProto(m *gen.User) *User {
+	receivers := make([]*Receiver, 0, len(m.Receivers))
+	for _, r := range m.Receivers {
+		receiver := ReceiverFromProto(r)
+		receiver.UserID = m.Id
+		receivers = append(receivers, receiver)
+	}
 	return &User{
-		ID:    m.Id,
-		Email: m.Email,
+		ID:        m.Id,
+		Email:     m.Email,
+		Receivers: receivers,
+		Verified:  m.Verified,
+	}
+}
+
+// ReceiverToProto converts a Receiver struct into a generated proto counterpart.
+func ReceiverToProto(m *Receiver) *gen.Receiver {
+	return &gen.Receiver{
+		Id:       m.ID,
+		Channel:  m.Channel,
+		Address:  m.Address,
+		Verified: m.Verified,
+		Secret:   m.Secret,
+	}
+}
+
+// ReceiverFromProto converts a generated proto counterpart into a Receiver struct.
+func ReceiverFromProto(m *gen.Receiver) *Receiver {
+	return &Receiver{
+		ID:       m.Id,
+		Channel:  m.Channel,
+		Address:  m.Address,
+		Verified: m.Verified,
+		Secret:   m.Secret,
 	}
 }
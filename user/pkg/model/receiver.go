@@ -0,0 +1,140 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Channels users can be notified on
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelSlack   = "slack"
+	ChannelTeams   = "teams"
+	ChannelWebhook = "webhook"
+	ChannelPush    = "push"
+)
+
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Receiver defines a channel a user can be notified on, only verified receivers may be delivered to
+type Receiver struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Channel   string    `json:"channel"`
+	Address   string    `json:"address"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+	// Secret signs the deliveries to a webhook receiver, its owner is only shown it when the receiver is added
+	Secret string `json:"-"`
+
+	// Outstanding verification code, only the hash of the code itself is kept
+	CodeHash      string    `json:"-"`
+	CodeExpiresAt time.Time `json:"-"`
+	CodeAttempts  int       `json:"-"`
+}
+
+// PushSubscription defines the address of a push receiver, as returned by the browser's PushManager
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// NewReceiver creates an unverified receiver after validating the address for the channel
+func NewReceiver(userID, channel, address string) (*Receiver, error) {
+	address, err := NormalizeReceiverAddress(channel, address)
+	if err != nil {
+		return nil, err
+	}
+	receiver := &Receiver{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Channel:   channel,
+		Address:   address,
+		CreatedAt: time.Now(),
+	}
+	if channel == ChannelWebhook {
+		if receiver.Secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	return receiver, nil
+}
+
+// newWebhookSecret generates a random secret to sign a webhook receiver's deliveries with
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NormalizeReceiverAddress validates the address for the channel and returns it in canonical form
+func NormalizeReceiverAddress(channel, address string) (string, error) {
+	address = strings.TrimSpace(address)
+	switch channel {
+	case ChannelEmail:
+		a, err := mail.ParseAddress(address)
+		if err != nil {
+			return "", err
+		}
+		return NormalizeEmail(a.Address), nil
+	case ChannelSMS:
+		phone := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(address)
+		if !phonePattern.MatchString(phone) {
+			return "", errors.New("phone number must be in E.164 format, e.g. +14155550123")
+		}
+		return phone, nil
+	case ChannelSlack:
+		return webhookURL(address, "hooks.slack.com")
+	case ChannelTeams, ChannelWebhook:
+		return webhookURL(address, "")
+	case ChannelPush:
+		var sub PushSubscription
+		if err := json.Unmarshal([]byte(address), &sub); err != nil {
+			return "", fmt.Errorf("push subscription must be JSON: %w", err)
+		}
+		if _, err := webhookURL(sub.Endpoint, ""); err != nil {
+			return "", err
+		}
+		if sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+			return "", errors.New("push subscription is missing its keys")
+		}
+		b, err := json.Marshal(sub)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("unknown channel %q", channel)
+	}
+}
+
+// webhookURL checks the address is an https URL, on the given host if not empty
+func webhookURL(address, host string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", errors.New("URL must use https")
+	}
+	if host != "" && u.Host != host {
+		return "", fmt.Errorf("URL must be on %s", host)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// ResetCode defines an outstanding password reset code, only the hash of the code itself is kept
+type ResetCode struct {
+	UserID    string    `json:"user_id"`
+	Hash      string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Attempts  int       `json:"attempts"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// RefreshToken defines a stored refresh token, only the hash of the token itself is kept
+type RefreshToken struct {
+	Hash      string     `json:"-"`
+	SessionID string     `json:"session_id"`
+	UserID    string     `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// RevokedSession defines a session whose tokens are no longer accepted
+type RevokedSession struct {
+	SessionID string    `json:"session_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
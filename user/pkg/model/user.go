@@ -1,17 +1,18 @@
 package model
 
 import (
-	"encoding/json"
+	"strings"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	Password  string `json:"-"`
-	Receivers string `json:"receivers"`
+	ID        string      `json:"id"`
+	Email     string      `json:"email"`
+	Password  string      `json:"-"`
+	Receivers []*Receiver `json:"receivers,omitempty"`
+	Verified  bool        `json:"verified"`
 }
 
 func NewUser(email, password string) (*User, error) {
@@ -20,19 +21,41 @@ func NewUser(email, password string) (*User, error) {
 		return nil, err
 	}
 
-	receivers, err := json.Marshal(map[string]string{"email": email})
+	user, err := NewExternalUser(email)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hashedPassword
+	return user, nil
+}
+
+// NewExternalUser creates a user who logs in through an identity provider and has no password
+func NewExternalUser(email string) (*User, error) {
+	id := uuid.New().String()
+	receiver, err := NewReceiver(id, ChannelEmail, email)
 	if err != nil {
 		return nil, err
 	}
 
 	return &User{
-		ID:        uuid.New().String(),
+		ID:        id,
 		Email:     email,
-		Password:  hashedPassword,
-		Receivers: string(receivers),
+		Receivers: []*Receiver{receiver},
 	}, nil
 }
 
+// NormalizeEmail returns the email in the form accounts are stored and looked up by, emails differing only
+// in case or surrounding whitespace belong to the same account
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// DisplayName returns the name to show the user as, the part of their email before the @
+func (u *User) DisplayName() string {
+	name, _, _ := strings.Cut(u.Email, "@")
+	return name
+}
+
 func HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -40,3 +63,8 @@ func HashPassword(password string) (string, error) {
 	}
 	return string(hashedPassword), nil
 }
+
+// CheckPassword reports whether the password matches the user's hashed password
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
@@ -2,5 +2,88 @@ CREATE TABLE users (
     id VARCHAR(255) PRIMARY KEY,
     email VARCHAR(255) UNIQUE,
     password VARCHAR(255),
-    receivers TEXT
+    verified BOOLEAN NOT NULL DEFAULT FALSE
 );
+
+CREATE TABLE refresh_tokens (
+    token_hash VARCHAR(255) PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE TABLE revoked_sessions (
+    session_id VARCHAR(255) PRIMARY KEY,
+    revoked_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(255) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
+
+CREATE TABLE password_reset_codes (
+    user_id VARCHAR(255) PRIMARY KEY,
+    code_hash VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE user_mfa (
+    user_id VARCHAR(255) PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE mfa_recovery_codes (
+    user_id VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE user_identities (
+    provider VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE TABLE oauth_states (
+    state VARCHAR(255) PRIMARY KEY,
+    provider VARCHAR(255) NOT NULL,
+    nonce VARCHAR(255) NOT NULL,
+    verifier VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE user_receivers (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    channel VARCHAR(50) NOT NULL,
+    address TEXT NOT NULL,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    code_hash VARCHAR(255) NOT NULL DEFAULT '',
+    code_expires_at TIMESTAMPTZ,
+    code_attempts INTEGER NOT NULL DEFAULT 0,
+    secret VARCHAR(255) NOT NULL DEFAULT '',
+    UNIQUE (user_id, channel, address)
+);
+
+CREATE TABLE outbox (
+    id VARCHAR(255) PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_unsent ON outbox (created_at) WHERE sent_at IS NULL;